@@ -0,0 +1,83 @@
+package jsonmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Catalog provides translated messages for validation errors, keyed by
+// error code.
+type Catalog interface {
+	// Format returns the message for code in the given locale, or false if
+	// the catalog has no such message.
+	Format(locale, code string, params map[string]interface{}) (string, bool)
+}
+
+// MessageCatalog is a Catalog backed by message templates, indexed by locale
+// and then by error code. Templates may refer to error parameters as {name},
+// e.g. "darf höchstens {max} Zeichen lang sein". A regional locale such as
+// "de-CH" falls back to its language ("de") if it has no messages of its own.
+type MessageCatalog map[string]map[string]string
+
+func (c MessageCatalog) Format(locale, code string, params map[string]interface{}) (string, bool) {
+	messages, ok := c[locale]
+	if !ok {
+		if i := strings.IndexAny(locale, "-_"); i > 0 {
+			messages, ok = c[locale[:i]]
+		}
+	}
+	if !ok {
+		return "", false
+	}
+
+	tmpl, ok := messages[code]
+	if !ok {
+		return "", false
+	}
+
+	replacements := make([]string, 0, 2*len(params))
+	for k, v := range params {
+		replacements = append(replacements, "{"+k+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(replacements...).Replace(tmpl), true
+}
+
+type localeContext struct {
+	Context
+	locale string
+}
+
+// WithLocale returns a Context which causes TypeMapper.Unmarshal() to render
+// error messages in the given locale, using the TypeMapper's Catalog.
+func WithLocale(ctx Context, locale string) Context {
+	return &localeContext{
+		Context: ctx,
+		locale:  locale,
+	}
+}
+
+// LocaleFromContext returns the locale set with WithLocale(), if any.
+func LocaleFromContext(ctx Context) string {
+	if lc, ok := ctx.(*localeContext); ok {
+		return lc.locale
+	}
+	return ""
+}
+
+// Localize returns a copy of e with each message translated into the given
+// locale. Messages which the catalog doesn't cover are left unchanged.
+func (e *MultiValidationError) Localize(c Catalog, locale string) *MultiValidationError {
+	me := &MultiValidationError{
+		NestedErrors: make([]*FlattenedPathError, len(e.NestedErrors)),
+	}
+	for i, fe := range e.NestedErrors {
+		localized := *fe
+		if fe.Code != "" {
+			if msg, ok := c.Format(locale, fe.Code, fe.Params); ok {
+				localized.Message = msg
+			}
+		}
+		me.NestedErrors[i] = &localized
+	}
+	return me
+}
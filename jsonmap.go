@@ -2,14 +2,22 @@ package jsonmap
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/rnd42/go-jsonpointer"
+	"math"
+	"math/big"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
+	"unicode/utf8"
 )
 
 type Context interface{}
@@ -21,15 +29,71 @@ var (
 	nullRawMessage = RawMessage{nullJSONValue}
 )
 
+// Sentinel errors for use with errors.Is(). Every validation failure matches
+// ErrValidation, and failures with a corresponding code match the more
+// specific sentinels as well.
+var (
+	ErrValidation           = errors.New("validation failed")
+	ErrMissingRequiredField = errors.New("missing required field")
+)
+
+var sentinelCodes = map[error]string{
+	ErrMissingRequiredField: CodeMissingRequiredField,
+}
+
+func matchesSentinel(code string, target error) bool {
+	if target == ErrValidation {
+		return true
+	}
+	sentinelCode, ok := sentinelCodes[target]
+	return ok && sentinelCode == code
+}
+
 type FlattenedPathError struct {
-	Path    string
+	Path string
+	// GoPath identifies the Go struct field corresponding to Path, such as
+	// "OuterThing.InnerThings[0].Foo", for use in logs and metrics.
+	GoPath  string
 	Message string
+	Code    string
+	Params  map[string]interface{}
+	Cause   error
+	// Severity is SeverityWarning for errors collected with Warnings().
+	Severity Severity
 }
 
 func (e *FlattenedPathError) String() string {
 	return fmt.Sprintf("%s: %s\n", e.Path, e.Message)
 }
 
+func (e *FlattenedPathError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type flattenedPathErrorJSON struct {
+	Path    string                 `json:"path"`
+	Message string                 `json:"message"`
+	Code    string                 `json:"code,omitempty"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+func (e *FlattenedPathError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(flattenedPathErrorJSON{
+		Path:    e.Path,
+		Message: e.Message,
+		Code:    e.Code,
+		Params:  e.Params,
+	})
+}
+
+func (e *FlattenedPathError) Unwrap() error {
+	return e.Cause
+}
+
+func (e *FlattenedPathError) Is(target error) bool {
+	return matchesSentinel(e.Code, target)
+}
+
 func NewFlattenedPathError(path, message string) *FlattenedPathError {
 	return &FlattenedPathError{
 		Path:    path,
@@ -45,6 +109,17 @@ func (e *MultiValidationError) Errors() []*FlattenedPathError {
 	return e.NestedErrors
 }
 
+// ByPath groups the error messages by path, e.g. for displaying them next to
+// the corresponding form fields. Messages for each path are in the order they
+// were found.
+func (e *MultiValidationError) ByPath() map[string][]string {
+	grouped := make(map[string][]string)
+	for _, f := range e.NestedErrors {
+		grouped[f.Path] = append(grouped[f.Path], f.Message)
+	}
+	return grouped
+}
+
 func (e *MultiValidationError) Error() string {
 	b := strings.Builder{}
 	b.WriteString("Validation Errors: \n")
@@ -54,22 +129,218 @@ func (e *MultiValidationError) Error() string {
 	return b.String()
 }
 
+// MarshalJSON renders the errors in a form suitable for returning directly to
+// API clients, e.g. {"errors":[{"path":"/foo","message":"too long"}]}.
+func (e *MultiValidationError) MarshalJSON() ([]byte, error) {
+	errs := e.NestedErrors
+	if errs == nil {
+		errs = []*FlattenedPathError{}
+	}
+	return json.Marshal(struct {
+		Errors []*FlattenedPathError `json:"errors"`
+	}{errs})
+}
+
+// children returns each of the flattened errors. Is() and As() search them,
+// allowing errors.Is() and errors.As() to match against individual failures.
+// There is deliberately no Unwrap() []error, which errors.Is() would follow as
+// well from Go 1.20, searching every error twice at each level of nesting.
+func (e *MultiValidationError) children() []error {
+	errs := make([]error, len(e.NestedErrors))
+	for i, f := range e.NestedErrors {
+		errs[i] = f
+	}
+	return errs
+}
+
+func (e *MultiValidationError) Is(target error) bool {
+	return target == ErrValidation || anyIs(e.children(), target)
+}
+
+func (e *MultiValidationError) As(target interface{}) bool {
+	return anyAs(e.children(), target)
+}
+
+// anyIs reports whether errors.Is() matches target against any of errs.
+func anyIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyAs is like errors.As(), but tries each of errs in turn.
+func anyAs(errs []error, target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddError flattens err and any errors nested within it. Warnings are
+// skipped. Errors are kept sorted by path.
 func (e *MultiValidationError) AddError(err *ValidationError, path ...string) {
-	path = append(path, err.Field)
+	e.add(err, false, false, "", path)
+	e.sort()
+}
+
+// addWarnings flattens only the warnings within err.
+func (e *MultiValidationError) addWarnings(err *ValidationError, path ...string) {
+	e.add(err, true, false, "", path)
+	e.sort()
+}
+
+// sort orders the errors by path, so that they are reported in the same order
+// regardless of the order in which they were found. Errors with the same path
+// keep their order.
+func (e *MultiValidationError) sort() {
+	sort.SliceStable(e.NestedErrors, func(i, j int) bool {
+		return pathLess(e.NestedErrors[i].Path, e.NestedErrors[j].Path)
+	})
+}
+
+// pathLess compares two JSON pointers token by token, so that a value sorts
+// before anything within it and array indexes sort numerically.
+func pathLess(a, b string) bool {
+	aTokens := strings.Split(a, "/")
+	bTokens := strings.Split(b, "/")
+	for i := 0; i < len(aTokens) && i < len(bTokens); i++ {
+		if aTokens[i] == bTokens[i] {
+			continue
+		}
+		aIndex, aErr := strconv.ParseUint(aTokens[i], 10, 64)
+		bIndex, bErr := strconv.ParseUint(bTokens[i], 10, 64)
+		if aErr == nil && bErr == nil {
+			return aIndex < bIndex
+		}
+		return unescapeToken(aTokens[i]) < unescapeToken(bTokens[i])
+	}
+	return len(aTokens) < len(bTokens)
+}
+
+func unescapeToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+}
+
+func (e *MultiValidationError) add(err *ValidationError, warnings, inWarning bool, goPath string, path []string) {
+	inWarning = inWarning || err.Severity == SeverityWarning
+
+	// Errors without a field apply to the enclosing object itself
+	if err.Field != "" {
+		path = append(path, err.Field)
+		goPath = appendGoPath(goPath, err.goField, err.Field)
+	}
 	pointer := jsonpointer.NewJSONPointerFromTokens(&path)
-	if err.Message != "" {
+	if err.Message != "" && inWarning == warnings {
 		jsonpath := pointer.String()
-		e.NestedErrors = append(e.NestedErrors, NewFlattenedPathError(jsonpath, err.Message))
+		fe := NewFlattenedPathError(jsonpath, err.Message)
+		fe.GoPath = goPath
+		fe.Code = err.Code
+		fe.Params = err.Params
+		fe.Cause = err.Cause
+		if inWarning {
+			fe.Severity = SeverityWarning
+		}
+		e.NestedErrors = append(e.NestedErrors, fe)
 	}
 	for _, v := range err.NestedErrors {
-		e.AddError(v, path...)
+		e.add(v, warnings, inWarning, goPath, path)
+	}
+}
+
+// appendGoPath adds a struct field name or index expression to a Go path. If
+// the Go name of a field isn't known its JSON name is used instead.
+func appendGoPath(goPath, goField, field string) string {
+	if goField == "" {
+		goField = field
+	}
+	if goPath == "" || strings.HasPrefix(goField, "[") {
+		return goPath + goField
+	}
+	return goPath + "." + goField
+}
+
+// setRootGoPath prefixes each error's GoPath with the name of the root type.
+func (e *MultiValidationError) setRootGoPath(root string) {
+	for _, fe := range e.NestedErrors {
+		if fe.GoPath == "" {
+			fe.GoPath = root
+		} else {
+			fe.GoPath = appendGoPath(root, fe.GoPath, "")
+		}
+	}
+}
+
+// Machine readable error codes used by the built-in validators and TypeMaps.
+const (
+	CodeNotAString            = "not_a_string"
+	CodeNotABoolean           = "not_a_boolean"
+	CodeNotAnInteger          = "not_an_integer"
+	CodeNotAnObject           = "not_an_object"
+	CodeNotAList              = "not_a_list"
+	CodeNotAMap               = "not_a_map"
+	CodeMissingRequiredField  = "missing_required_field"
+	CodeTooShort              = "too_short"
+	CodeTooLong               = "too_long"
+	CodeTooLarge              = "too_large"
+	CodeOutOfRange            = "out_of_range"
+	CodePatternMismatch       = "pattern_mismatch"
+	CodeInvalidFormat         = "invalid_format"
+	CodeNotOneOf              = "not_one_of"
+	CodeTooFewElements        = "too_few_elements"
+	CodeTooManyElements       = "too_many_elements"
+	CodeDuplicateElement      = "duplicate_element"
+	CodeInvalidTypeIdentifier = "invalid_type_identifier"
+	CodeTooManyDigits         = "too_many_digits"
+	CodeWeakPassword          = "weak_password"
+	CodeCommonPassword        = "common_password"
+	CodeUnsupportedCardBrand  = "unsupported_card_brand"
+	CodeInvalidJSON           = "invalid_json"
+	CodeTooManyValues         = "too_many_values"
+	CodeValidationFailed      = "validation_failed"
+	CodeMutuallyExclusive     = "mutually_exclusive"
+	CodeRequiredTogether      = "required_together"
+	CodeTooManyErrors         = "too_many_errors"
+	CodeDeprecatedValue       = "deprecated_value"
+	CodeTrailingData          = "trailing_data"
+	CodePayloadTooLarge       = "payload_too_large"
+	CodeTooManyKeys           = "too_many_keys"
+	CodeNoMatchingVariant     = "no_matching_variant"
+	CodeAmbiguousVariant      = "ambiguous_variant"
+)
+
+// Severity distinguishes validation failures which reject the input from
+// warnings, which are reported but don't cause Unmarshal() to fail.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
 	}
+	return "error"
 }
 
 type ValidationError struct {
 	Field        string
 	Message      string
+	Code         string
+	Params       map[string]interface{}
+	Cause        error
 	NestedErrors []*ValidationError
+	// Severity applies to this error and everything nested within it.
+	Severity Severity
+
+	goField  string
+	redacted bool
 }
 
 func (e *ValidationError) ErrorMessage() string {
@@ -79,13 +350,42 @@ func (e *ValidationError) ErrorMessage() string {
 	return e.Message
 }
 
+// Error describes a single error by its message, or a tree of errors by the
+// JSON pointer path and message of each, one per line.
 func (e *ValidationError) Error() string {
-	prefix := e.Field
-	msg := e.ErrorMessage()
-	for _, f := range e.NestedErrors {
-		msg += prefix + f.ErrorMessage()
+	if len(e.NestedErrors) == 0 {
+		return e.ErrorMessage()
+	}
+
+	me := &MultiValidationError{}
+	me.AddError(e)
+
+	b := strings.Builder{}
+	for _, f := range me.NestedErrors {
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+// children returns the underlying cause, if any, followed by any nested
+// errors, which Is() and As() search.
+func (e *ValidationError) children() []error {
+	errs := []error{}
+	if e.Cause != nil {
+		errs = append(errs, e.Cause)
 	}
-	return msg
+	for _, nested := range e.NestedErrors {
+		errs = append(errs, nested)
+	}
+	return errs
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return matchesSentinel(e.Code, target) || anyIs(e.children(), target)
+}
+
+func (e *ValidationError) As(target interface{}) bool {
+	return anyAs(e.children(), target)
 }
 
 func (e *ValidationError) AddError(err *ValidationError) {
@@ -96,6 +396,31 @@ func (e *ValidationError) SetField(field string) {
 	e.Field = field
 }
 
+// WithCode sets a machine readable code, such as CodeTooLong, which clients
+// can branch on instead of parsing Message.
+func (e *ValidationError) WithCode(code string) *ValidationError {
+	e.Code = code
+	return e
+}
+
+// WithParam records a parameter of the failed check, such as "min" or "max",
+// so that clients can produce their own (e.g. translated) messages from Code
+// and Params instead of relying on the English Message.
+func (e *ValidationError) WithParam(key string, value interface{}) *ValidationError {
+	if e.Params == nil {
+		e.Params = map[string]interface{}{}
+	}
+	e.Params[key] = value
+	return e
+}
+
+// withGoField records the Go name of the field, or an index expression like
+// "[0]", corresponding to e.Field.
+func (e *ValidationError) withGoField(goField string) *ValidationError {
+	e.goField = goField
+	return e
+}
+
 func NewValidationErrorWithField(field, message string) *ValidationError {
 	return &ValidationError{
 		Field:   field,
@@ -117,6 +442,143 @@ func NewValidationError(reason string, a ...interface{}) *ValidationError {
 	}
 }
 
+// WrapFieldError converts an error returned while unmarshaling the named field
+// into a ValidationError, in the same way as the built-in TypeMaps. Errors
+// other than ValidationErrors are preserved as the Cause.
+func WrapFieldError(field string, err error) *ValidationError {
+	if e, ok := err.(*ValidationError); ok {
+		return AppendPath(e, field)
+	}
+
+	return &ValidationError{
+		Field:   field,
+		Message: err.Error(),
+		Cause:   err,
+	}
+}
+
+// AppendPath places err beneath token, a field name or index, so that a
+// TypeMap can report errors in the values it contains. Path tokens are added
+// from the innermost value outward.
+func AppendPath(err *ValidationError, token string) *ValidationError {
+	if err.Field == "" {
+		err.Field = token
+		return err
+	}
+
+	return &ValidationError{
+		Field:        token,
+		NestedErrors: []*ValidationError{err},
+	}
+}
+
+// NewWarning creates a non-fatal ValidationError. A Validator which returns a
+// value along with a warning accepts the value, and the warning is reported
+// to callers who ask for it with the Warnings() option.
+func NewWarning(reason string, a ...interface{}) *ValidationError {
+	return &ValidationError{
+		Message:  fmt.Sprintf(reason, a...),
+		Severity: SeverityWarning,
+	}
+}
+
+// IsWarning reports whether e consists only of warnings.
+func (e *ValidationError) IsWarning() bool {
+	return (e.Severity == SeverityWarning || len(e.NestedErrors) != 0) && !e.hasErrors()
+}
+
+// hasErrors reports whether e, or anything nested within it, is an error
+// rather than a warning.
+func (e *ValidationError) hasErrors() bool {
+	if e.Severity == SeverityWarning {
+		return false
+	}
+	if e.Message != "" {
+		return true
+	}
+	for _, nested := range e.NestedErrors {
+		if nested.hasErrors() {
+			return true
+		}
+	}
+	return false
+}
+
+// isWarning reports whether err should be treated as a success which carries
+// warnings.
+func isWarning(err error) bool {
+	e, ok := err.(*ValidationError)
+	return ok && e.IsWarning()
+}
+
+// A SchemaError reports a misconfigured TypeMap, such as a MappedField naming
+// a struct field which doesn't exist. These indicate a programming error
+// rather than invalid input, and can be detected up front with CheckSchema().
+type SchemaError struct {
+	// Type is the name of the Go type being mapped, if known.
+	Type    string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Type != "" {
+		return e.Type + ": " + e.Message
+	}
+	return e.Message
+}
+
+func newSchemaError(format string, a ...interface{}) *SchemaError {
+	return &SchemaError{
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// A SyntaxError is returned by TypeMapper.Unmarshal() when the input isn't
+// well-formed JSON, as opposed to well-formed JSON which fails validation.
+// This lets HTTP handlers distinguish malformed requests (400) from invalid
+// ones (422).
+type SyntaxError struct {
+	// Offset is the number of bytes read before the error was detected.
+	Offset int64
+	// Line and Column locate Offset in the input, counting from 1. Columns
+	// are counted in characters rather than bytes.
+	Line   int
+	Column int
+	// Code is always CodeInvalidJSON. Message may be reworded by the
+	// TypeMapper's ErrorFormatter or Catalog, which are passed the line and
+	// column as parameters.
+	Code    string
+	Message string
+	Err     *json.SyntaxError
+}
+
+func newSyntaxError(data []byte, err *json.SyntaxError) *SyntaxError {
+	offset := int(err.Offset)
+	if offset > len(data) {
+		offset = len(data)
+	}
+
+	read := data[:offset]
+	lineStart := bytes.LastIndexByte(read, '\n') + 1
+
+	return &SyntaxError{
+		Offset:  err.Offset,
+		Line:    bytes.Count(read, []byte{'\n'}) + 1,
+		Column:  utf8.RuneCount(read[lineStart:]),
+		Code:    CodeInvalidJSON,
+		Message: err.Error(),
+		Err:     err,
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s (line %d, column %d)", e.Message, e.Line, e.Column)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
 type Validator interface {
 	Validate(interface{}) (interface{}, error)
 }
@@ -131,6 +593,9 @@ type RegisterableTypeMap interface {
 	GetUnderlyingType() reflect.Type
 }
 
+// A MappedField maps a struct field to a member of a JSON object. Its value is
+// mapped by Contains, or validated and produced by Validator. If both are set,
+// Validator checks the value as a whole before it is mapped by Contains.
 type MappedField struct {
 	StructFieldName  string
 	StructGetterName string
@@ -139,6 +604,99 @@ type MappedField struct {
 	Validator        Validator
 	Optional         bool
 	ReadOnly         bool
+	// Sensitive fields never have their values echoed in errors, even when
+	// IncludeValues() is used.
+	Sensitive bool
+	// NilPolicy controls how a nil value is marshaled. It defaults to the
+	// NilPolicy of the TypeMapper.
+	NilPolicy NilPolicy
+	// EmptyAsArray marshals a nil slice as [] rather than null, as if the
+	// field's NilPolicy were NilAsEmpty.
+	EmptyAsArray bool
+	// EmptyAsObject marshals a nil map as {} rather than null, as if the
+	// field's NilPolicy were NilAsEmpty.
+	EmptyAsObject bool
+}
+
+// A NilPolicy determines how nil pointers, slices, maps and interfaces are
+// marshaled.
+type NilPolicy int
+
+const (
+	// NilDefault defers to the enclosing policy, which is NilAsNull unless
+	// the TypeMapper says otherwise.
+	NilDefault NilPolicy = iota
+	// NilAsNull marshals nil values as null.
+	NilAsNull
+	// NilAsEmpty marshals nil slices as [] and nil maps as {}, including
+	// through a pointer, for APIs which promise an array or object. Other
+	// nil values are still marshaled as null.
+	NilAsEmpty
+	// NilOmitted leaves fields with nil values out entirely.
+	NilOmitted
+)
+
+// marshalState carries the TypeMapper's settings through the Context passed
+// to Marshal().
+type marshalState struct {
+	Context
+
+	mapper    *TypeMapper
+	nilPolicy NilPolicy
+}
+
+// mapperFromContext returns the TypeMapper whose Marshal() or Unmarshal() is
+// in progress, if any.
+func mapperFromContext(ctx Context) *TypeMapper {
+	switch s := ctx.(type) {
+	case *unmarshalState:
+		return s.mapper
+	case *marshalState:
+		return s.mapper
+	default:
+		return nil
+	}
+}
+
+func nilPolicyFor(ctx Context, field MappedField, t reflect.Type) NilPolicy {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if (field.EmptyAsArray && t.Kind() == reflect.Slice) || (field.EmptyAsObject && t.Kind() == reflect.Map) {
+		return NilAsEmpty
+	}
+	if field.NilPolicy != NilDefault {
+		return field.NilPolicy
+	}
+	if s, ok := ctx.(*marshalState); ok && s.nilPolicy != NilDefault {
+		return s.nilPolicy
+	}
+	return NilAsNull
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// emptyJSONValue returns the empty JSON value for a nil value of type t under
+// NilAsEmpty.
+func emptyJSONValue(t reflect.Type) []byte {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return []byte("[]")
+	case reflect.Map:
+		return []byte("{}")
+	default:
+		return nullJSONValue
+	}
 }
 
 type StructMap struct {
@@ -165,9 +723,37 @@ func (sm StructMap) Unmarshal(ctx Context, parent *reflect.Value, partial interf
 
 	data, ok := partial.(map[string]interface{})
 	if !ok {
-		return NewValidationError("expected an object")
+		return NewValidationError("expected an object").WithCode(CodeNotAnObject)
+	}
+
+	dstValue = sm.allocate(dstValue)
+
+	errs := &ValidationError{}
+
+	for _, field := range sm.Fields {
+		if failingFast(ctx, errs) {
+			break
+		}
+		if field.ReadOnly {
+			continue
+		}
+
+		val, ok := data[field.JSONFieldName]
+		if err := sm.unmarshalField(ctx, dstValue, field, data, val, ok, errs); err != nil {
+			return err
+		}
+	}
+
+	if len(errs.NestedErrors) != 0 {
+		return errs
 	}
 
+	return nil
+}
+
+// allocate returns the struct which dstValue refers to, allocating a new one
+// if dstValue is a pointer or an interface{}.
+func (sm StructMap) allocate(dstValue reflect.Value) reflect.Value {
 	// In order to unmarshal into an interface{} we need to allocate an actual
 	// instance of this type of struct, and set the interface{} to point to the
 	// value.
@@ -181,67 +767,121 @@ func (sm StructMap) Unmarshal(ctx Context, parent *reflect.Value, partial interf
 		dstValue = dstValue.Elem()
 	}
 
-	errs := &ValidationError{}
-
-	for _, field := range sm.Fields {
-		if field.ReadOnly {
-			continue
-		}
+	return dstValue
+}
 
-		// TODO: Setters
-		dstField := dstValue.FieldByName(field.StructFieldName)
-		if !dstField.IsValid() {
-			panic("no such underlying field: " + field.StructFieldName)
-		}
+// unmarshalField maps val, the value of field in the input if present, onto
+// the struct. siblings holds the other members of the input object. Validation
+// errors are collected in errs, and only a SchemaError is returned.
+func (sm StructMap) unmarshalField(ctx Context, dstValue reflect.Value, field MappedField, siblings map[string]interface{}, val interface{}, present bool, errs *ValidationError) error {
+	// TODO: Setters
+	dstField := dstValue.FieldByName(field.StructFieldName)
+	if !dstField.IsValid() {
+		return newSchemaError("no such underlying field: %s", field.StructFieldName)
+	}
 
-		val, ok := data[field.JSONFieldName]
-		if !ok {
-			if field.Optional {
-				continue
-			} else {
-				err := NewValidationErrorWithField(field.JSONFieldName, "missing required field")
-				errs.AddError(err)
-				continue
-			}
+	if !present {
+		if !field.Optional {
+			err := NewValidationErrorWithField(field.JSONFieldName, "missing required field").WithCode(CodeMissingRequiredField).withGoField(field.StructFieldName)
+			collectError(ctx, errs, err)
 		}
+		return nil
+	}
 
-		if val == nil && field.Optional {
-			continue
-		}
+	if val == nil && field.Optional {
+		return nil
+	}
 
-		var err error
+	var err error
 
-		if field.Contains != nil {
-			err = field.Contains.Unmarshal(ctx, &dstValue, val, dstField)
-		} else if field.Validator != nil {
-			val, err = field.Validator.Validate(val)
-			// Check reflect.ValueOf(val).IsValid() instead of err == nil if returning the invalid input in Validate
-			if err == nil {
-				dstField.Set(reflect.ValueOf(val))
+	if field.Contains != nil {
+		if field.Validator != nil {
+			// Validate the value as a whole before mapping it. Any result
+			// is discarded, since Contains maps the original value.
+			_, verr := field.Validator.Validate(val)
+			applySeverity(ctx, verr)
+			if verr != nil && !isWarning(verr) {
+				return sm.collectFieldError(ctx, field, val, verr, errs)
 			}
+			if err := sm.collectFieldError(ctx, field, val, verr, errs); err != nil {
+				return err
+			}
+		}
+		if vt, ok := field.Contains.(*Discriminator); ok {
+			err = vt.unmarshalWithSiblings(ctx, &dstValue, sm, siblings, val, dstField)
 		} else {
-			panic("Field must have Contains or Validator: " + field.JSONFieldName)
+			err = field.Contains.Unmarshal(ctx, &dstValue, val, dstField)
 		}
-
-		if err != nil {
-			switch e := err.(type) {
-			case *ValidationError:
-				e.SetField(field.JSONFieldName)
-				errs.AddError(e)
-			default:
-				ve := NewValidationErrorWithField(field.JSONFieldName, e.Error())
-				errs.AddError(ve)
+	} else if field.Validator != nil {
+		var validated interface{}
+		validated, err = field.Validator.Validate(val)
+		// Check reflect.ValueOf(validated).IsValid() instead of err == nil if returning the invalid input in Validate
+		if applySeverity(ctx, err) {
+			setDowngraded(dstField, val)
+		} else if err == nil || isWarning(err) {
+			if validated == nil {
+				// A validator accepted null, e.g. Nullable()
+				dstField.Set(reflect.Zero(dstField.Type()))
+			} else {
+				dstField.Set(reflect.ValueOf(validated))
 			}
 		}
+	} else {
+		return newSchemaError("Field must have Contains or Validator: %s", field.JSONFieldName)
 	}
 
-	if len(errs.NestedErrors) != 0 {
-		return errs
+	return sm.collectFieldError(ctx, field, val, err, errs)
+}
+
+// collectFieldError adds err, returned while unmarshaling val into field, to
+// errs. A SchemaError is returned instead.
+func (sm StructMap) collectFieldError(ctx Context, field MappedField, val interface{}, err error, errs *ValidationError) error {
+	if err == nil {
+		return nil
 	}
 
+	switch e := err.(type) {
+	case *SchemaError:
+		return e
+	case *ValidationError:
+		describeValue(ctx, e, val)
+		if field.Sensitive {
+			redactValues(e)
+		}
+		e.SetField(field.JSONFieldName)
+		e.withGoField(field.StructFieldName)
+		collectError(ctx, errs, e)
+	default:
+		ve := WrapFieldError(field.JSONFieldName, e).withGoField(field.StructFieldName)
+		collectError(ctx, errs, ve)
+	}
 	return nil
 }
 
+// derivedTypeKeys returns the type identifiers to be written for empty
+// Discriminator switch fields in src, keyed by struct field name, where they
+// can be derived from the type of the value being switched.
+func (sm StructMap) derivedTypeKeys(src reflect.Value) map[string]string {
+	var derived map[string]string
+	for _, field := range sm.Fields {
+		vt, ok := field.Contains.(*Discriminator)
+		if !ok || field.StructFieldName == "" || vt.inlineProperty(&src) != "" || vt.SelectType != nil {
+			continue
+		}
+		switchField := src.FieldByName(vt.PropertyName)
+		if !switchField.IsValid() || !switchField.IsZero() {
+			continue
+		}
+		if key, ok := vt.deriveKey(src.FieldByName(field.StructFieldName)); ok {
+			if derived == nil {
+				derived = map[string]string{}
+			}
+			derived[vt.PropertyName] = key
+		}
+	}
+	return derived
+}
+
 func (sm StructMap) marshalField(ctx Context, parent reflect.Value, field MappedField, srcField reflect.Value) ([]byte, error) {
 	var val interface{}
 	if field.Contains != nil {
@@ -254,11 +894,77 @@ func (sm StructMap) marshalField(ctx Context, parent reflect.Value, field Mapped
 		val = srcField.Interface()
 	}
 
+	// The output of another TypeMap only needs to be checked, rather than
+	// copied by json.Marshal()
+	if rm, ok := val.(RawMessage); ok && json.Valid(rm.Data) {
+		return rm.Data, nil
+	}
+
 	return json.Marshal(val)
 }
 
-func (sm StructMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
-	buf := bytes.Buffer{}
+// bufferPool holds the buffers used to assemble marshaled objects, which are
+// copied out once complete.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+// maxPooledBuffer bounds the size of buffers returned to bufferPool, so that
+// one very large response doesn't pin its buffer indefinitely.
+const maxPooledBuffer = 64 << 10
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// writeJSONKey writes s as a JSON string followed by a colon, avoiding
+// json.Marshal() for the common case of keys which need no escaping.
+func writeJSONKey(buf *bytes.Buffer, s string) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			data, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+			buf.WriteByte(':')
+			return nil
+		}
+	}
+
+	buf.WriteByte('"')
+	buf.WriteString(s)
+	buf.WriteString(`":`)
+	return nil
+}
+
+func (sm StructMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := sm.marshalTo(ctx, buf, src); err != nil {
+		return nil, err
+	}
+
+	// buf is reused once we return
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	return RawMessage{data}, nil
+}
+
+// marshalTo writes the JSON encoding of src to buf.
+func (sm StructMap) marshalTo(ctx Context, buf *bytes.Buffer, src reflect.Value) error {
 	isNil := false
 
 	// An Interface's Elem() returns a Ptr whose Elem() returns the actual value
@@ -277,78 +983,267 @@ func (sm StructMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Valu
 	} else {
 		expectedType := reflect.TypeOf(sm.UnderlyingType)
 		if src.Type() != expectedType {
-			panic("wrong type: " + src.Type().String() + ", expected: " + expectedType.String())
+			return newSchemaError("wrong type: %s, expected: %s", src.Type(), expectedType)
 		}
 
 		buf.WriteByte('{')
 
-		for i, field := range sm.Fields {
+		derived := sm.derivedTypeKeys(src)
+
+		first := true
+		for _, field := range sm.Fields {
 			var srcField reflect.Value
 
 			// TODO: Do validation ahead of time
 			if field.StructFieldName != "" {
 				srcField = src.FieldByName(field.StructFieldName)
 				if !srcField.IsValid() {
-					panic("no such underlying field: " + field.StructFieldName)
+					return newSchemaError("no such underlying field: %s", field.StructFieldName)
 				}
 			} else if field.StructGetterName != "" {
 				// TODO: I'm not 100% sure if this works with methods that don't take a pointer
 				srcGetter := src.Addr().MethodByName(field.StructGetterName)
 				if !srcGetter.IsValid() {
-					panic("no such underlying getter method: " + field.StructGetterName)
+					return newSchemaError("no such underlying getter method: %s", field.StructGetterName)
 				}
 				rets := srcGetter.Call([]reflect.Value{})
 				if len(rets) != 2 {
-					panic("invalid getter, should return (interface{}, error): " + field.StructGetterName)
+					return newSchemaError("invalid getter, should return (interface{}, error): %s", field.StructGetterName)
 				}
 				if !rets[1].IsNil() {
-					return nil, rets[1].Interface().(error)
+					return rets[1].Interface().(error)
 				}
 				srcField = rets[0]
 			} else {
-				panic("either StructFieldName or StructGetterName must be specified")
+				return newSchemaError("either StructFieldName or StructGetterName must be specified")
 			}
 
-			keybuf, err := json.Marshal(field.JSONFieldName)
-			if err != nil {
-				return nil, err
+			policy := nilPolicyFor(ctx, field, srcField.Type())
+			isNilField := policy != NilAsNull && isNilValue(srcField)
+			if isNilField && policy == NilOmitted {
+				continue
 			}
 
-			valbuf, err := sm.marshalField(ctx, src, field, srcField)
-			if err != nil {
-				return nil, err
+			var valbuf []byte
+			if isNilField && policy == NilAsEmpty {
+				valbuf = emptyJSONValue(srcField.Type())
+			} else if key, ok := derived[field.StructFieldName]; ok {
+				var err error
+				valbuf, err = json.Marshal(key)
+				if err != nil {
+					return err
+				}
+			} else {
+				var err error
+				valbuf, err = sm.marshalField(ctx, src, field, srcField)
+				if err != nil {
+					return err
+				}
 			}
 
-			buf.Write(keybuf)
-			buf.WriteByte(':')
-			buf.Write(valbuf)
-
-			if i != len(sm.Fields)-1 {
+			if !first {
 				buf.WriteByte(',')
 			}
+			first = false
+
+			if err := writeJSONKey(buf, field.JSONFieldName); err != nil {
+				return err
+			}
+			buf.Write(valbuf)
 		}
 
 		buf.WriteByte('}')
 	}
 
-	return RawMessage{buf.Bytes()}, nil
+	return nil
+}
+
+// A StructConstraint validates relationships between the fields of a JSON
+// object which can't be expressed by validating each field on its own.
+type StructConstraint interface {
+	Check(data map[string]interface{}) *ValidationError
+}
+
+// ConstrainedStructMap is a StructMap with additional object level
+// constraints. Create one with StructMap.With().
+type ConstrainedStructMap struct {
+	StructMap
+	Constraints []StructConstraint
+}
+
+func (sm ConstrainedStructMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	err := sm.StructMap.Unmarshal(ctx, parent, partial, dstValue)
+
+	data, ok := partial.(map[string]interface{})
+	if !ok {
+		return err
+	}
+
+	errs, ok := err.(*ValidationError)
+	if err != nil && !ok {
+		return err
+	}
+	if errs == nil {
+		errs = &ValidationError{}
+	}
+
+	for _, c := range sm.Constraints {
+		if failingFast(ctx, errs) {
+			break
+		}
+		ce := c.Check(data)
+		if ce == nil {
+			continue
+		}
+		if ce.Field == "" && ce.Message == "" {
+			// Constraints may report several fields at once
+			for _, nested := range ce.NestedErrors {
+				if failingFast(ctx, errs) {
+					break
+				}
+				nested.withGoField(sm.goFieldName(nested.Field))
+				collectError(ctx, errs, nested)
+			}
+		} else {
+			collectError(ctx, errs, ce)
+		}
+	}
+
+	if len(errs.NestedErrors) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (sm StructMap) goFieldName(jsonFieldName string) string {
+	for _, field := range sm.Fields {
+		if field.JSONFieldName == jsonFieldName {
+			return field.StructFieldName
+		}
+	}
+	return ""
+}
+
+// With returns a copy of the StructMap which additionally enforces the given
+// constraints.
+func (sm StructMap) With(constraints ...StructConstraint) ConstrainedStructMap {
+	return ConstrainedStructMap{
+		StructMap:   sm,
+		Constraints: constraints,
+	}
+}
+
+func isPresent(data map[string]interface{}, field string) bool {
+	val, ok := data[field]
+	return ok && val != nil
+}
+
+func quoteFields(fields []string) string {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = "'" + f + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+type mutuallyExclusive struct {
+	fields []string
+}
+
+func (c mutuallyExclusive) Check(data map[string]interface{}) *ValidationError {
+	present := []string{}
+	for _, f := range c.fields {
+		if isPresent(data, f) {
+			present = append(present, f)
+		}
+	}
+
+	if len(present) > 1 {
+		return NewValidationError("only one of %s may be present, got %s", quoteFields(c.fields), quoteFields(present)).WithCode(CodeMutuallyExclusive)
+	}
+
+	return nil
+}
+
+// MutuallyExclusive allows at most one of the given JSON fields to be present
+// (and non-null). Violations are reported on the enclosing object.
+func MutuallyExclusive(jsonFieldNames ...string) StructConstraint {
+	return mutuallyExclusive{jsonFieldNames}
+}
+
+type requiredTogether struct {
+	fields []string
+}
+
+func (c requiredTogether) Check(data map[string]interface{}) *ValidationError {
+	present := []string{}
+	missing := []string{}
+	for _, f := range c.fields {
+		if isPresent(data, f) {
+			present = append(present, f)
+		} else {
+			missing = append(missing, f)
+		}
+	}
+
+	if len(present) == 0 || len(missing) == 0 {
+		return nil
+	}
+
+	errs := &ValidationError{}
+	for _, f := range missing {
+		errs.AddError(NewValidationErrorWithField(f, "required when "+quoteFields(present)+" is present").WithCode(CodeRequiredTogether))
+	}
+	return errs
+}
+
+// RequiredTogether requires that if any of the given JSON fields is present
+// (and non-null), all of them are. An error is reported for each missing
+// field.
+func RequiredTogether(jsonFieldNames ...string) StructConstraint {
+	return requiredTogether{jsonFieldNames}
 }
 
 type SliceMap struct {
 	Contains TypeMap
 	MinLen   *int
 	MaxLen   *int
+
+	// If Unique is set, elements must be distinct. Elements are compared by
+	// the value returned by UniqueKey, or by their own value if it is nil.
+	Unique    bool
+	UniqueKey func(elem interface{}) interface{}
+
+	// If Dedupe is set, repeated elements (compared as for Unique) are
+	// silently dropped, keeping the first.
+	Dedupe bool
+
+	// If Sorted is set, elements are marshaled in ascending order, as given
+	// by Less or, if it is nil, by their natural order. Only strings and
+	// numbers have a natural order.
+	Sorted bool
+	Less   func(a, b interface{}) bool
 }
 
 func (sm SliceMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
 	data, ok := partial.([]interface{})
 	if !ok {
-		return NewValidationError("expected a list")
+		return NewValidationError("expected a list").WithCode(CodeNotAList)
 	}
 
-	err := sm.validateSliceWithinRange(data)
-	if err != nil {
-		return err
+	if dstValue.Kind() == reflect.Ptr {
+		dstValue.Set(reflect.New(dstValue.Type().Elem()))
+		dstValue = dstValue.Elem()
+	}
+
+	if dstValue.Kind() == reflect.Array {
+		return sm.unmarshalArray(ctx, data, dstValue)
+	}
+
+	rangeErr := sm.validateSliceWithinRange(data)
+	if rangeErr != nil && !applySeverity(ctx, rangeErr) {
+		return rangeErr
 	}
 
 	// Appending to a reflect.Value returns a new reflect.Value despite the
@@ -359,32 +1254,107 @@ func (sm SliceMap) Unmarshal(ctx Context, parent *reflect.Value, partial interfa
 	elementType := dstValue.Type().Elem()
 
 	errs := &ValidationError{}
+	if rangeErr != nil {
+		errs.AddError(rangeErr.(*ValidationError))
+	}
 
 	for i, val := range data {
+		if failingFast(ctx, errs) {
+			break
+		}
 		// Note: reflect.New() returns a pointer Value, so we have to take its
 		// Elem() before putting it to use
 		dstElem := reflect.New(elementType).Elem()
 
 		err := sm.Contains.Unmarshal(ctx, &dstValue, val, dstElem)
 
+		accepted, err := sm.collectElementError(ctx, i, val, err, errs)
 		if err != nil {
+			return err
+		}
+		if accepted {
+			result = reflect.Append(result, dstElem)
+		}
+	}
 
-			switch e := err.(type) {
-			case *ValidationError:
-				e.SetField(strconv.Itoa(i))
-				errs.AddError(e)
-			default:
-				// This should never happen but just to be safe
-				ve := NewValidationErrorWithField(strconv.Itoa(i), e.Error())
-				errs.AddError(ve)
-			}
-			continue
+	return sm.finish(ctx, dstValue, result, errs)
+}
+
+// unmarshalArray unmarshals data into a fixed size array, which it must match
+// in length. MinLen and MaxLen are ignored.
+func (sm SliceMap) unmarshalArray(ctx Context, data []interface{}, dstValue reflect.Value) error {
+	n := dstValue.Len()
+	if len(data) < n {
+		return NewValidationError("must have %d elements", n).WithCode(CodeTooFewElements).WithParam("min", n).WithParam("max", n)
+	} else if len(data) > n {
+		return NewValidationError("must have %d elements", n).WithCode(CodeTooManyElements).WithParam("min", n).WithParam("max", n)
+	}
+
+	// Elements are only stored in dstValue if all of them are valid
+	result := reflect.New(dstValue.Type()).Elem()
+
+	errs := &ValidationError{}
+
+	for i, val := range data {
+		if failingFast(ctx, errs) {
+			break
+		}
+
+		err := sm.Contains.Unmarshal(ctx, &dstValue, val, result.Index(i))
+
+		accepted, err := sm.collectElementError(ctx, i, val, err, errs)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			result.Index(i).Set(reflect.Zero(result.Type().Elem()))
 		}
+	}
+
+	return sm.finish(ctx, dstValue, result, errs)
+}
 
-		result = reflect.Append(result, dstElem)
+// collectElementError adds err, returned while unmarshaling the element val at
+// index i, to errs. It reports whether the element should be kept, or returns
+// a SchemaError.
+func (sm SliceMap) collectElementError(ctx Context, i int, val interface{}, err error, errs *ValidationError) (bool, error) {
+	if err == nil {
+		return true, nil
 	}
 
-	if len(errs.NestedErrors) != 0 {
+	switch e := err.(type) {
+	case *SchemaError:
+		return false, e
+	case *ValidationError:
+		describeValue(ctx, e, val)
+		e.SetField(strconv.Itoa(i))
+		e.withGoField(goIndex(i))
+		collectError(ctx, errs, e)
+	default:
+		// This should never happen but just to be safe
+		ve := WrapFieldError(strconv.Itoa(i), e).withGoField(goIndex(i))
+		collectError(ctx, errs, ve)
+	}
+	return isWarning(err), nil
+}
+
+// finish checks the unmarshaled elements for uniqueness and, if there were no
+// errors, stores them in dstValue.
+func (sm SliceMap) finish(ctx Context, dstValue, result reflect.Value, errs *ValidationError) error {
+	if !errs.hasErrors() && sm.Unique {
+		if err := sm.validateUnique(ctx, result, errs); err != nil {
+			return err
+		}
+	}
+
+	if !errs.hasErrors() && sm.Dedupe && result.Kind() == reflect.Slice {
+		var err error
+		if result, err = sm.dedupe(result); err != nil {
+			return err
+		}
+	}
+
+	if errs.hasErrors() {
 		return errs
 	}
 
@@ -393,22 +1363,40 @@ func (sm SliceMap) Unmarshal(ctx Context, parent *reflect.Value, partial interfa
 	// indirection.
 	dstValue.Set(result)
 
+	// Any remaining errors are warnings
+	if len(errs.NestedErrors) != 0 {
+		return errs
+	}
+
 	return nil
 }
 
 func (sm SliceMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
 	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return nullRawMessage, nil
+		}
 		src = src.Elem()
 	}
 
-	if src.IsNil() {
+	if src.Kind() != reflect.Array && src.IsNil() {
 		return nullRawMessage, nil
 	}
 
 	result := make([]interface{}, src.Len())
 
-	for i := 0; i < src.Len(); i++ {
-		data, err := sm.Contains.Marshal(ctx, &src, src.Index(i))
+	order := make([]int, src.Len())
+	for i := range order {
+		order[i] = i
+	}
+	if sm.Sorted {
+		if err := sm.sortOrder(src, order); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, j := range order {
+		data, err := sm.Contains.Marshal(ctx, &src, src.Index(j))
 		if err != nil {
 			return nil, err
 		}
@@ -430,6 +1418,45 @@ func SliceOf(elem TypeMap) TypeMap {
 	}
 }
 
+// SliceOfUnique rejects slices containing duplicate elements. An optional key
+// function maps each unmarshaled element to the (comparable) value used to
+// detect duplicates, e.g. an ID field of a struct.
+func SliceOfUnique(elem TypeMap, key ...func(elem interface{}) interface{}) TypeMap {
+	sm := SliceMap{
+		Contains: elem,
+		Unique:   true,
+	}
+	if len(key) > 0 {
+		sm.UniqueKey = key[0]
+	}
+	return sm
+}
+
+// SetOf is like SliceOf, but treats the slice as a set: duplicate elements are
+// dropped when unmarshaling, and elements are sorted when marshaling.
+func SetOf(elem TypeMap) SliceMap {
+	return SliceMap{
+		Contains: elem,
+		Dedupe:   true,
+		Sorted:   true,
+	}
+}
+
+// RejectDuplicates reports duplicate elements as errors instead of dropping
+// them.
+func (sm SliceMap) RejectDuplicates() SliceMap {
+	sm.Dedupe = false
+	sm.Unique = true
+	return sm
+}
+
+// SortedBy marshals elements in the order given by less.
+func (sm SliceMap) SortedBy(less func(a, b interface{}) bool) SliceMap {
+	sm.Sorted = true
+	sm.Less = less
+	return sm
+}
+
 func SliceOfMax(elem TypeMap, max int) TypeMap {
 	return SliceMap{
 		Contains: elem,
@@ -452,100 +1479,2157 @@ func SliceOfRange(elem TypeMap, min, max int) TypeMap {
 	}
 }
 
-func (sm *SliceMap) validateSliceWithinRange(data []interface{}) error {
-	if sm.MaxLen == nil && sm.MinLen == nil {
-		return nil
-	} else if sm.MaxLen == nil {
-		if len(data) < *sm.MinLen {
-			return NewValidationError("must have at least %d elements", *sm.MinLen)
-		}
-	} else if sm.MinLen == nil {
-		if len(data) > *sm.MaxLen {
-			return NewValidationError("must have at most %d elements", *sm.MaxLen)
-		}
-	} else if *sm.MaxLen == *sm.MinLen {
-		if len(data) != *sm.MaxLen {
-			return NewValidationError("must have %d elements", *sm.MaxLen)
-		}
-	} else if len(data) > *sm.MaxLen || len(data) < *sm.MinLen {
-		return NewValidationError("must have between %d and %d elements", *sm.MinLen, *sm.MaxLen)
-	}
-
-	return nil
-}
+// nilElementKey is the key of nil elements, which are all duplicates of each
+// other.
+type nilElementKey struct{}
 
-type MapMap struct {
-	Contains TypeMap
-}
+// jsonElementKey is the key of an element which can't be used as a map key,
+// such as a list held by an Interface() element, in its canonical JSON form.
+type jsonElementKey string
 
-func (mm MapMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
-	data, ok := partial.(map[string]interface{})
-	if !ok {
-		return NewValidationError("expected a map")
+// elementKey returns the value by which elem is compared to other elements
+// when checking for duplicates.
+func (sm SliceMap) elementKey(elem reflect.Value) (interface{}, error) {
+	if sm.UniqueKey != nil {
+		return hashableKey(reflect.ValueOf(sm.UniqueKey(elem.Interface())))
 	}
 
-	errs := &ValidationError{}
+	for elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return nilElementKey{}, nil
+		}
+		elem = elem.Elem()
+	}
+	if !elem.Type().Comparable() {
+		return nil, newSchemaError("cannot compare elements of type %s, a UniqueKey function is required", elem.Type())
+	}
+	return hashableKey(elem)
+}
 
-	// Maps default to nil, so we need to make() one
-	dstValue.Set(reflect.MakeMap(dstValue.Type()))
+// hashableKey returns v as a value which can be used as a map key. Interfaces
+// holding values which can't, such as slices, are replaced by their JSON.
+func hashableKey(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nilElementKey{}, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nilElementKey{}, nil
+	}
 
-	elementType := dstValue.Type().Elem()
+	if v.Type().Comparable() {
+		return v.Interface(), nil
+	}
 
-	for key, val := range data {
-		// Note: reflect.New() returns a pointer Value, so we have to take its
-		// Elem() before putting it to use
-		dstElem := reflect.New(elementType).Elem()
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, NewValidationError("cannot compare element: %s", err.Error())
+	}
+	return jsonElementKey(data), nil
+}
 
-		err := mm.Contains.Unmarshal(ctx, &dstValue, val, dstElem)
+// dedupe returns elems without any repeated elements.
+func (sm SliceMap) dedupe(elems reflect.Value) (reflect.Value, error) {
+	seen := make(map[interface{}]bool, elems.Len())
+	result := reflect.MakeSlice(elems.Type(), 0, elems.Len())
 
+	for i := 0; i < elems.Len(); i++ {
+		key, err := sm.elementKey(elems.Index(i))
 		if err != nil {
-			switch e := err.(type) {
-			case *ValidationError:
-				e.SetField(key)
-				errs.AddError(e)
-			default:
-				// This should never happen but just to be safe
-				ne := NewValidationErrorWithField(key, e.Error())
-				errs.AddError(ne)
-			}
+			return result, err
+		}
+		if seen[key] {
 			continue
 		}
-
-		dstValue.SetMapIndex(reflect.ValueOf(key), dstElem)
+		seen[key] = true
+		result = reflect.Append(result, elems.Index(i))
 	}
-	if len(errs.NestedErrors) != 0 {
-		return errs
+
+	return result, nil
+}
+
+// sortOrder sorts order, a list of indexes into src, by the elements they
+// refer to.
+func (sm SliceMap) sortOrder(src reflect.Value, order []int) error {
+	less := sm.Less
+	if less == nil {
+		elemType := src.Type().Elem()
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		switch elemType.Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+		default:
+			return newSchemaError("cannot sort elements of type %s, a Less function is required", elemType)
+		}
 	}
 
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := src.Index(order[i]), src.Index(order[j])
+		if less != nil {
+			return less(a.Interface(), b.Interface())
+		}
+		return naturalLess(reflect.Indirect(a), reflect.Indirect(b))
+	})
 	return nil
 }
 
-func (mm MapMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
-	if src.Kind() == reflect.Ptr {
-		src = src.Elem()
+// naturalLess compares two strings or numbers of the same type. Invalid
+// values, from nil pointers, sort first.
+func naturalLess(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
 	}
 
-	if src.IsNil() {
-		return nullRawMessage, nil
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	default:
+		return a.Float() < b.Float()
 	}
+}
 
-	result := make(map[string]interface{})
-	keys := src.MapKeys()
-
-	if src.Type().Key().Kind() != reflect.String {
-		panic("key must be a string")
-	}
+func (sm SliceMap) validateUnique(ctx Context, elems reflect.Value, errs *ValidationError) error {
+	seen := make(map[interface{}]int, elems.Len())
+
+	for i := 0; i < elems.Len(); i++ {
+		if failingFast(ctx, errs) {
+			break
+		}
+		key, err := sm.elementKey(elems.Index(i))
+		if err != nil {
+			return err
+		}
+
+		if first, ok := seen[key]; ok {
+			collectError(ctx, errs, NewValidationErrorWithField(strconv.Itoa(i), fmt.Sprintf("duplicate of element %d", first)).WithCode(CodeDuplicateElement).WithParam("index", first).withGoField(goIndex(i)))
+			continue
+		}
+		seen[key] = i
+	}
+
+	return nil
+}
+
+func goIndex(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+func goKey(key string) string {
+	return "[" + strconv.Quote(key) + "]"
+}
+
+func (sm *SliceMap) validateSliceWithinRange(data []interface{}) error {
+	code := CodeTooManyElements
+	if sm.MinLen != nil && len(data) < *sm.MinLen {
+		code = CodeTooFewElements
+	}
+
+	if sm.MaxLen == nil && sm.MinLen == nil {
+		return nil
+	} else if sm.MaxLen == nil {
+		if len(data) < *sm.MinLen {
+			return NewValidationError("must have at least %d elements", *sm.MinLen).WithCode(code).WithParam("min", *sm.MinLen)
+		}
+	} else if sm.MinLen == nil {
+		if len(data) > *sm.MaxLen {
+			return NewValidationError("must have at most %d elements", *sm.MaxLen).WithCode(code).WithParam("max", *sm.MaxLen)
+		}
+	} else if *sm.MaxLen == *sm.MinLen {
+		if len(data) != *sm.MaxLen {
+			return NewValidationError("must have %d elements", *sm.MaxLen).WithCode(code).WithParam("min", *sm.MinLen).WithParam("max", *sm.MaxLen)
+		}
+	} else if len(data) > *sm.MaxLen || len(data) < *sm.MinLen {
+		return NewValidationError("must have between %d and %d elements", *sm.MinLen, *sm.MaxLen).WithCode(code).WithParam("min", *sm.MinLen).WithParam("max", *sm.MaxLen)
+	}
+
+	return nil
+}
+
+// TupleMap maps a fixed length JSON array whose elements have different types,
+// such as [name, count], onto the fields of a struct in the order they're
+// declared.
+type TupleMap struct {
+	Elems []TypeMap
+}
+
+func (tm TupleMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	data, ok := partial.([]interface{})
+	if !ok {
+		return NewValidationError("expected a list").WithCode(CodeNotAList)
+	}
+
+	if dstValue.Kind() == reflect.Ptr {
+		dstValue.Set(reflect.New(dstValue.Type().Elem()))
+		dstValue = dstValue.Elem()
+	}
+
+	if dstValue.Kind() != reflect.Struct || dstValue.NumField() < len(tm.Elems) {
+		return newSchemaError("Tuple() of %d elements requires a struct with at least %d fields", len(tm.Elems), len(tm.Elems))
+	}
+
+	n := len(tm.Elems)
+	if len(data) < n {
+		return NewValidationError("must have %d elements", n).WithCode(CodeTooFewElements).WithParam("min", n).WithParam("max", n)
+	} else if len(data) > n {
+		return NewValidationError("must have %d elements", n).WithCode(CodeTooManyElements).WithParam("min", n).WithParam("max", n)
+	}
+
+	errs := &ValidationError{}
+
+	for i, val := range data {
+		if failingFast(ctx, errs) {
+			break
+		}
+
+		dstField := dstValue.Field(i)
+		goField := dstValue.Type().Field(i).Name
+		if !dstField.CanSet() {
+			return newSchemaError("cannot set unexported field: %s", goField)
+		}
+
+		err := tm.Elems[i].Unmarshal(ctx, &dstValue, val, dstField)
+		if err != nil {
+			switch e := err.(type) {
+			case *SchemaError:
+				return e
+			case *ValidationError:
+				describeValue(ctx, e, val)
+				e.SetField(strconv.Itoa(i))
+				e.withGoField(goField)
+				collectError(ctx, errs, e)
+			default:
+				ve := WrapFieldError(strconv.Itoa(i), e).withGoField(goField)
+				collectError(ctx, errs, ve)
+			}
+		}
+	}
+
+	if len(errs.NestedErrors) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (tm TupleMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return nullRawMessage, nil
+		}
+		src = src.Elem()
+	}
+
+	if src.Kind() != reflect.Struct || src.NumField() < len(tm.Elems) {
+		return nil, newSchemaError("Tuple() of %d elements requires a struct with at least %d fields", len(tm.Elems), len(tm.Elems))
+	}
+
+	result := make([]interface{}, len(tm.Elems))
+
+	for i, elem := range tm.Elems {
+		data, err := elem.Marshal(ctx, &src, src.Field(i))
+		if err != nil {
+			return nil, err
+		}
+
+		result[i] = data
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+// Tuple maps a JSON array of exactly len(elems) elements onto a struct, whose
+// first field receives the first element, and so on. Each element is mapped
+// by the corresponding TypeMap, e.g. NewPrimitiveMap(Longitude()).
+func Tuple(elems ...TypeMap) TypeMap {
+	return TupleMap{
+		Elems: elems,
+	}
+}
+
+type MapMap struct {
+	Contains     TypeMap
+	KeyValidator Validator
+	// Less, if set, determines the order of keys when marshaling. By default
+	// keys are sorted alphabetically.
+	Less func(a, b string) bool
+}
+
+func (mm MapMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	data, ok := partial.(map[string]interface{})
+	if !ok {
+		return NewValidationError("expected a map").WithCode(CodeNotAMap)
+	}
+
+	if dstValue.Kind() == reflect.Ptr {
+		dstValue.Set(reflect.New(dstValue.Type().Elem()))
+		dstValue = dstValue.Elem()
+	}
+
+	errs := &ValidationError{}
+
+	// Maps default to nil, so we need to make() one
+	dstValue.Set(reflect.MakeMap(dstValue.Type()))
+
+	keyType := dstValue.Type().Key()
+	elementType := dstValue.Type().Elem()
+
+	// Visit keys in sorted order so that errors are reported deterministically
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
 	for _, key := range keys {
+		val := data[key]
+		if failingFast(ctx, errs) {
+			break
+		}
+		jsonKey := key
+		if mm.KeyValidator != nil {
+			validKey, err := mm.KeyValidator.Validate(key)
+			if err != nil {
+				collectKeyError(ctx, errs, jsonKey, err)
+				continue
+			}
+			if s, ok := validKey.(string); ok {
+				key = s
+			}
+		}
+
+		dstKey, err := keyFromString(keyType, key)
+		if err != nil {
+			if se, ok := err.(*SchemaError); ok {
+				return se
+			}
+			collectKeyError(ctx, errs, jsonKey, err)
+			continue
+		}
+
+		// Note: reflect.New() returns a pointer Value, so we have to take its
+		// Elem() before putting it to use
+		dstElem := reflect.New(elementType).Elem()
+
+		err = mm.Contains.Unmarshal(ctx, &dstValue, val, dstElem)
+
+		if err != nil {
+			switch e := err.(type) {
+			case *SchemaError:
+				return e
+			case *ValidationError:
+				describeValue(ctx, e, val)
+				e.SetField(key)
+				e.withGoField(goKey(key))
+				collectError(ctx, errs, e)
+			default:
+				// This should never happen but just to be safe
+				ne := WrapFieldError(key, e).withGoField(goKey(key))
+				collectError(ctx, errs, ne)
+			}
+			if !isWarning(err) {
+				continue
+			}
+		}
+
+		dstValue.SetMapIndex(dstKey, dstElem)
+	}
+	if len(errs.NestedErrors) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (mm MapMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return nullRawMessage, nil
+		}
+		src = src.Elem()
+	}
+
+	if src.IsNil() {
+		return nullRawMessage, nil
+	}
+
+	result := make(map[string]interface{})
+	keys := src.MapKeys()
+
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		name, err := keyToString(key)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = name
+	}
+
+	if mm.Less != nil {
+		return mm.marshalOrdered(ctx, src, keys, names)
+	}
+
+	for i, key := range keys {
 		data, err := mm.Contains.Marshal(ctx, &src, src.MapIndex(key))
 		if err != nil {
 			return nil, err
 		}
 
-		result[key.String()] = data
+		result[names[i]] = data
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+// marshalOrdered writes the members of src in the order given by mm.Less,
+// since json.Marshal() always sorts the keys of a map.
+func (mm MapMap) marshalOrdered(ctx Context, src reflect.Value, keys []reflect.Value, names []string) (json.Marshaler, error) {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return mm.Less(names[order[i]], names[order[j]])
+	})
+
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range order {
+		data, err := mm.Contains.Marshal(ctx, &src, src.MapIndex(keys[k]))
+		if err != nil {
+			return nil, err
+		}
+
+		encodedKey, err := json.Marshal(names[k])
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := data.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+
+	return RawMessage{buf.Bytes()}, nil
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// keyFromString converts a JSON object key to a map key of type t. As with
+// encoding/json, an encoding.TextUnmarshaler is preferred over a string.
+func keyFromString(t reflect.Type, s string) (reflect.Value, error) {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		key := reflect.New(t)
+		if err := key.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			if _, ok := err.(*ValidationError); ok {
+				return reflect.Value{}, err
+			}
+			return reflect.Value{}, NewValidationError("%s", err.Error()).WithCode(CodeInvalidFormat)
+		}
+		return key.Elem(), nil
+	}
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(s).Convert(t), nil
+	}
+	return reflect.Value{}, newSchemaError("key must be a string or implement encoding.TextUnmarshaler")
+}
+
+// keyToString converts a map key to a JSON object key. As with encoding/json,
+// a string is preferred over an encoding.TextMarshaler.
+func keyToString(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if tm, ok := key.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(text), nil
+	}
+	return "", newSchemaError("key must be a string or implement encoding.TextMarshaler")
+}
+
+// collectKeyError reports that key, a key of a JSON object, is invalid.
+func collectKeyError(ctx Context, errs *ValidationError, key string, err error) {
+	e, ok := err.(*ValidationError)
+	if !ok {
+		e = NewValidationError("%s", err.Error())
+	}
+	e.Message = "invalid key: " + e.Message
+	e.SetField(key)
+	e.withGoField(goKey(key))
+	collectError(ctx, errs, e)
+}
+
+func MapOf(elem TypeMap) TypeMap {
+	return &MapMap{
+		Contains: elem,
+	}
+}
+
+// MapOfWithKeys is like MapOf, but additionally validates each key with
+// keyValidator. Keys which fail validation are reported at the key's path.
+func MapOfWithKeys(keyValidator Validator, elem TypeMap) TypeMap {
+	return &MapMap{
+		Contains:     elem,
+		KeyValidator: keyValidator,
+	}
+}
+
+// MapOfOrdered is like MapOf, but marshals keys in the order given by less
+// rather than alphabetically.
+func MapOfOrdered(elem TypeMap, less func(a, b string) bool) TypeMap {
+	return &MapMap{
+		Contains: elem,
+		Less:     less,
+	}
+}
+
+// KeyOrder returns an ordering for MapOfOrdered() which places the given keys
+// first, in the order listed, followed by any others in alphabetical order.
+func KeyOrder(keys ...string) func(a, b string) bool {
+	rank := make(map[string]int, len(keys))
+	for i, key := range keys {
+		rank[key] = i
+	}
+
+	return func(a, b string) bool {
+		rankA, okA := rank[a]
+		rankB, okB := rank[b]
+		switch {
+		case okA && okB:
+			return rankA < rankB
+		case okA || okB:
+			return okA
+		default:
+			return a < b
+		}
+	}
+}
+
+type toStringable interface {
+	ToString() string
+}
+
+// The discrimator is used to handle cases in which a JSON property may be more than one type
+// (e.g. Human.Pet may be type Dog or Cat). PropertyName is the name of said property and
+// Mapping is a map between the possible types (as strings) and the appropriate TypeMap
+// corresponding to the given type.
+// See https://swagger.io/specification/#discriminatorObject for more information.
+type Discriminator struct {
+	PropertyName string
+	Mapping      map[string]TypeMap
+	// Default, if set, is used when the value of PropertyName doesn't match
+	// any Mapping, e.g. to capture unknown event types rather than reject
+	// them.
+	Default TypeMap
+	// SelectType, if set, is used instead of PropertyName to choose the
+	// type, based on the Context passed to Marshal or Unmarshal.
+	SelectType func(ctx Context) string
+	// InlineProperty, if set, is used instead of PropertyName, and names a
+	// member of the variant object itself which holds the type. It is
+	// written back when marshaling, so each Mapping must be a
+	// RegisterableTypeMap. Within a SliceOf() a Discriminator is always
+	// inline, with PropertyName naming the member of each element.
+	InlineProperty string
+	// Aliases maps additional type identifiers to keys of Mapping. The key
+	// of Mapping is written when marshaling inline.
+	Aliases map[string]string
+}
+
+// Alias accepts each of aliases as well as key, an existing key of Mapping.
+func (vt *Discriminator) Alias(key string, aliases ...string) *Discriminator {
+	if vt.Aliases == nil {
+		vt.Aliases = map[string]string{}
+	}
+	for _, alias := range aliases {
+		vt.Aliases[alias] = key
+	}
+	return vt
+}
+
+// resolve returns the TypeMap for keyString, which may be an alias.
+func (vt *Discriminator) resolve(keyString string) (TypeMap, bool) {
+	if key, ok := vt.Aliases[keyString]; ok {
+		keyString = key
+	}
+	tm, ok := vt.Mapping[keyString]
+	return tm, ok
+}
+
+// identifiers returns the TypeMaps for all of the accepted type identifiers,
+// including aliases.
+func (vt *Discriminator) identifiers() map[string]TypeMap {
+	if len(vt.Aliases) == 0 {
+		return vt.Mapping
+	}
+	types := make(map[string]TypeMap, len(vt.Mapping)+len(vt.Aliases))
+	for k, tm := range vt.Mapping {
+		types[k] = tm
+	}
+	for alias, key := range vt.Aliases {
+		types[alias] = vt.Mapping[key]
+	}
+	return types
+}
+
+// inlineProperty returns the member of the value itself which identifies its
+// type, if any.
+func (vt *Discriminator) inlineProperty(parent *reflect.Value) string {
+	if vt.InlineProperty != "" || vt.SelectType != nil || parent == nil {
+		return vt.InlineProperty
+	}
+	if parent.Kind() == reflect.Slice || parent.Kind() == reflect.Array {
+		return vt.PropertyName
+	}
+	return ""
+}
+
+// RegisterVariant adds tm to the types selected between, identified by key,
+// so that other packages can add their own variants from init(). It panics if
+// key is already registered, and must not be called once the Discriminator is
+// in use.
+func (vt *Discriminator) RegisterVariant(key string, tm TypeMap) {
+	if vt.Mapping == nil {
+		vt.Mapping = map[string]TypeMap{}
+	}
+	if _, ok := vt.resolve(key); ok {
+		panic("variant already registered: " + key)
+	}
+	vt.Mapping[key] = tm
+}
+
+// pick chooses the TypeMap to use for a value within parent, which may be nil
+// if SelectType is set, and returns it with the type identifier used.
+func (vt *Discriminator) pick(ctx Context, parent *reflect.Value) (TypeMap, string, error) {
+	if vt.SelectType != nil {
+		keyString := vt.SelectType(UnwrapContext(ctx))
+		tm, err := vt.lookup(parent, keyString)
+		return tm, keyString, err
+	}
+	return vt.pickTypeMap(parent)
+}
+
+func (vt *Discriminator) pickTypeMap(parent *reflect.Value) (TypeMap, string, error) {
+	typeKeyField := parent.FieldByName(vt.PropertyName)
+	if !typeKeyField.IsValid() {
+		return nil, "", newSchemaError("no such underlying field: %s", vt.PropertyName)
+	}
+
+	keyString := ""
+
+	typeKey := typeKeyField.Interface()
+	switch keyVal := typeKey.(type) {
+	case string:
+		keyString = keyVal
+	case toStringable:
+		keyString = keyVal.ToString()
+	default:
+		return nil, "", newSchemaError("cannot convert underlying field to string: %s", typeKeyField)
+	}
+
+	tm, err := vt.lookup(parent, keyString)
+	return tm, keyString, err
+}
+
+// pickTypeMapFromSiblings is like pickTypeMap, but reads the switch value from
+// siblings, the members of the JSON object being unmarshaled into parent by
+// sm, so that it doesn't matter whether the switch field has been unmarshaled
+// yet.
+func (vt *Discriminator) pickTypeMapFromSiblings(parent *reflect.Value, sm StructMap, siblings map[string]interface{}) (TypeMap, string, error) {
+	var typeField *MappedField
+	for i := range sm.Fields {
+		if sm.Fields[i].StructFieldName == vt.PropertyName {
+			typeField = &sm.Fields[i]
+			break
+		}
+	}
+	if typeField == nil {
+		// The switch field isn't set from the input, so has to be read
+		// from the struct
+		return vt.pickTypeMap(parent)
+	}
+
+	raw, present := siblings[typeField.JSONFieldName]
+	if (!present || raw == nil) && vt.Default == nil {
+		return nil, "", NewValidationError("cannot validate, missing '%s'", typeField.JSONFieldName).WithCode(CodeInvalidTypeIdentifier)
+	}
+
+	typeKey := raw
+	if typeField.Validator != nil {
+		validated, err := typeField.Validator.Validate(raw)
+		if err != nil && !isWarning(err) {
+			// The switch field reports its own error
+			tm, err := vt.lookup(parent, "")
+			return tm, "", err
+		}
+		typeKey = validated
+	}
+
+	keyString := ""
+	switch keyVal := typeKey.(type) {
+	case string:
+		keyString = keyVal
+	case toStringable:
+		keyString = keyVal.ToString()
+	}
+
+	tm, err := vt.lookup(parent, keyString)
+	return tm, keyString, err
+}
+
+// lookup returns the TypeMap for keyString, the value of the switch field.
+func (vt *Discriminator) lookup(parent *reflect.Value, keyString string) (TypeMap, error) {
+	typeMap, ok := vt.resolve(keyString)
+
+	if !ok && vt.Default != nil {
+		return vt.Default, nil
+	}
+
+	if !ok {
+		// NOTE: This error message isn't great because we don't have a way to know
+		// the JSON field name uponw which we're switching.
+		//TODO: include JSON field name uponw which we're switching to other error messages
+
+		if keyString != "" {
+			return nil, invalidTypeIdentifier(keyString, vt.identifiers())
+		}
+
+		if parent == nil {
+			return nil, NewValidationError("invalid type identifier").WithCode(CodeInvalidTypeIdentifier)
+		}
+
+		if f, found := parent.Type().FieldByName(vt.PropertyName); found {
+			jsonField := parseJsonTag(f)
+			if jsonField != "" {
+				return nil, NewValidationError("cannot validate, invalid input for '%s'", jsonField).WithCode(CodeInvalidTypeIdentifier)
+			}
+		}
+
+		return nil, NewValidationError("invalid type identifier").WithCode(CodeInvalidTypeIdentifier)
+	}
+
+	return typeMap, nil
+}
+
+func (vt *Discriminator) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if property := vt.inlineProperty(parent); property != "" {
+		return vt.unmarshalInline(ctx, parent, property, partial, dstValue)
+	}
+
+	tm, keyString, err := vt.pick(ctx, parent)
+	if err != nil {
+		return err
+	}
+
+	return decided(keyString, tm.Unmarshal(ctx, parent, partial, dstValue))
+}
+
+// unmarshalWithSiblings is used in place of Unmarshal() by a StructMap, which
+// can provide the raw members of the object being unmarshaled.
+func (vt *Discriminator) unmarshalWithSiblings(ctx Context, parent *reflect.Value, sm StructMap, siblings map[string]interface{}, partial interface{}, dstValue reflect.Value) error {
+	if vt.SelectType != nil || vt.InlineProperty != "" {
+		return vt.Unmarshal(ctx, parent, partial, dstValue)
+	}
+
+	tm, keyString, err := vt.pickTypeMapFromSiblings(parent, sm, siblings)
+	if err != nil {
+		return err
+	}
+
+	// A nested Discriminator may switch on another sibling
+	if inner, ok := tm.(*Discriminator); ok {
+		return decided(keyString, inner.unmarshalWithSiblings(ctx, parent, sm, siblings, partial, dstValue))
+	}
+
+	return decided(keyString, tm.Unmarshal(ctx, parent, partial, dstValue))
+}
+
+// invalidTypeIdentifier reports that keyString isn't one of the keys of types,
+// listing those which are allowed.
+func invalidTypeIdentifier(keyString string, types map[string]TypeMap) *ValidationError {
+	allowed := KeyFromVariableTypeMap(types).(*EnumeratedValuesValidator).AllowedSlice
+	return NewValidationError("invalid type identifier: '%s', must be one of: %s", keyString, strings.Join(allowed, ", ")).WithCode(CodeInvalidTypeIdentifier).WithParam("allowed", allowed)
+}
+
+// decided adds keyString, the type identifier which selected a nested
+// Discriminator, to the path reported by an invalid type identifier error
+// from it, e.g. "'animal' > 'dog': invalid type identifier: 'poodle'".
+func decided(keyString string, err error) error {
+	e, ok := err.(*ValidationError)
+	if !ok || e.Code != CodeInvalidTypeIdentifier || e.Field != "" || len(e.NestedErrors) != 0 {
+		return err
+	}
+
+	path, _ := e.Params["path"].([]string)
+	if len(path) == 0 {
+		e.Message = fmt.Sprintf("'%s': %s", keyString, e.Message)
+	} else {
+		e.Message = fmt.Sprintf("'%s' > %s", keyString, e.Message)
+	}
+	return e.WithParam("path", append([]string{keyString}, path...))
+}
+
+func (vt *Discriminator) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.IsZero() {
+		return nullRawMessage, nil
+	}
+
+	if property := vt.inlineProperty(parent); property != "" {
+		return vt.marshalInline(ctx, parent, property, src)
+	}
+
+	tm, keyString, err := vt.pick(ctx, parent)
+	if _, ok := err.(*SchemaError); ok {
+		return nil, err
+	}
+	if keyString == "" && vt.SelectType == nil {
+		if key, ok := vt.deriveKey(src); ok {
+			tm, err = vt.Mapping[key], nil
+		}
+	}
+	if err != nil {
+		return nil, errors.New("variable type serialization error: " + err.Error())
+	}
+
+	return tm.Marshal(ctx, parent, src)
+}
+
+// deriveKey returns the type identifier for src, if the TypeMap for its type
+// appears in Mapping exactly once.
+func (vt *Discriminator) deriveKey(src reflect.Value) (string, bool) {
+	if src.Kind() == reflect.Interface {
+		if src.IsNil() {
+			return "", false
+		}
+		src = src.Elem()
+	}
+	t := src.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	key := ""
+	found := 0
+	for k, tm := range vt.Mapping {
+		if rtm, ok := tm.(RegisterableTypeMap); ok && rtm.GetUnderlyingType() == t {
+			key = k
+			found++
+		}
+	}
+	return key, found == 1
+}
+
+func (vt *Discriminator) unmarshalInline(ctx Context, parent *reflect.Value, property string, partial interface{}, dstValue reflect.Value) error {
+	data, ok := partial.(map[string]interface{})
+	if !ok {
+		return NewValidationError("expected an object").WithCode(CodeNotAnObject)
+	}
+
+	tag, _ := data[property].(string)
+	tm, ok := vt.resolve(tag)
+	if !ok && vt.Default != nil {
+		tm, ok = vt.Default, true
+	}
+	if !ok {
+		e := NewValidationError("invalid type identifier").WithCode(CodeInvalidTypeIdentifier)
+		if tag != "" {
+			e = invalidTypeIdentifier(tag, vt.identifiers())
+		}
+		e.SetField(property)
+		errs := &ValidationError{}
+		errs.AddError(e)
+		return errs
+	}
+
+	return tm.Unmarshal(ctx, parent, partial, dstValue)
+}
+
+func (vt *Discriminator) marshalInline(ctx Context, parent *reflect.Value, property string, src reflect.Value) (json.Marshaler, error) {
+	if src.Kind() == reflect.Interface {
+		src = src.Elem()
+	}
+	t := src.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, tag := range sortedKeys(vt.Mapping) {
+		tm := vt.Mapping[tag]
+		rtm, ok := tm.(RegisterableTypeMap)
+		if !ok || rtm.GetUnderlyingType() != t {
+			continue
+		}
+
+		data, err := tm.Marshal(ctx, parent, src)
+		if err != nil {
+			return nil, err
+		}
+
+		// A variant may map the property itself
+		if sm, ok := tm.(StructMap); ok {
+			for _, field := range sm.Fields {
+				if field.JSONFieldName == property {
+					return data, nil
+				}
+			}
+		}
+
+		return prependMember(data, property, tag, t)
+	}
+
+	if vt.Default != nil {
+		return vt.Default.Marshal(ctx, parent, src)
+	}
+
+	return nil, newSchemaError("no type identifier for type: %s", t)
+}
+
+func VariableType(switchOnFieldName string, types map[string]TypeMap) TypeMap {
+	return &Discriminator{
+		PropertyName: switchOnFieldName,
+		Mapping:      types,
+	}
+}
+
+// VariableTypeWithDefault is like VariableType, but falls back to def when the
+// value of the switch field doesn't match any of types.
+func VariableTypeWithDefault(switchOnFieldName string, types map[string]TypeMap, def TypeMap) TypeMap {
+	return &Discriminator{
+		PropertyName: switchOnFieldName,
+		Mapping:      types,
+		Default:      def,
+	}
+}
+
+// ContextType is like VariableType, but the type is chosen by selectType from
+// the Context, e.g. based on the API version of the request, rather than by a
+// sibling field.
+func ContextType(selectType func(ctx Context) string, types map[string]TypeMap) TypeMap {
+	return &Discriminator{
+		Mapping:    types,
+		SelectType: selectType,
+	}
+}
+
+// InlineType is like VariableType, but the type is identified by property, a
+// member of the value's own object, e.g. {"type":"dog","barks":true}, rather
+// than by a sibling field.
+func InlineType(property string, types map[string]TypeMap) TypeMap {
+	return &Discriminator{
+		Mapping:        types,
+		InlineProperty: property,
+	}
+}
+
+// An Envelope holds a value whose type is identified by a sibling member of
+// the same object, e.g. {"type":"created","payload":{...}}.
+type Envelope struct {
+	Type    string
+	Payload interface{}
+}
+
+// EnvelopeOf returns a StructMap for an Envelope, with the type identifier in
+// typeField and the value in payloadField, mapped by the entry of types for
+// the type identifier. As the StructMap is registered for the Envelope type,
+// a TypeMapper can only hold one.
+func EnvelopeOf(typeField, payloadField string, types map[string]TypeMap) StructMap {
+	return StructMap{
+		Envelope{},
+		[]MappedField{
+			{
+				StructFieldName: "Type",
+				JSONFieldName:   typeField,
+				Validator:       String(1, 255),
+			},
+			{
+				StructFieldName: "Payload",
+				JSONFieldName:   payloadField,
+				Contains:        VariableType("Type", types),
+			},
+		},
+	}
+}
+
+// DynamicMap maps an interface field holding any type registered with the
+// TypeMapper in use, looking up the TypeMap for the value's concrete type
+// when it is marshaled. Unlike a Discriminator, no sibling field or mapping
+// is needed unless the field is also unmarshaled.
+type DynamicMap struct {
+	// TypeField, if set, names a member added to the marshaled object which
+	// identifies its type, and which is used to pick the type to unmarshal.
+	TypeField string
+	// Types maps the values of TypeField to registered types, given as zero
+	// values, e.g. "inner": InnerThing{}.
+	Types map[string]interface{}
+}
+
+func (m *DynamicMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if m.TypeField == "" {
+		return newSchemaError("jsonmap.Dynamic() requires a type field to unmarshal")
+	}
+
+	data, ok := partial.(map[string]interface{})
+	if !ok {
+		return NewValidationError("expected an object").WithCode(CodeNotAnObject)
+	}
+
+	tag, _ := data[m.TypeField].(string)
+	proto, ok := m.Types[tag]
+	if !ok {
+		msg := "invalid type identifier"
+		if tag != "" {
+			msg = fmt.Sprintf("invalid type identifier: '%s'", tag)
+		}
+		errs := &ValidationError{}
+		errs.AddError(NewValidationErrorWithField(m.TypeField, msg).WithCode(CodeInvalidTypeIdentifier))
+		return errs
+	}
+
+	tm, err := m.lookup(ctx, reflect.TypeOf(proto))
+	if err != nil {
+		return err
+	}
+
+	return tm.Unmarshal(ctx, parent, partial, dstValue)
+}
+
+func (m *DynamicMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Kind() == reflect.Interface {
+		if src.IsNil() {
+			return nullRawMessage, nil
+		}
+		src = src.Elem()
+	}
+
+	t := src.Type()
+	if t.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return nullRawMessage, nil
+		}
+		t = t.Elem()
+	}
+
+	tm, err := m.lookup(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := tm.Marshal(ctx, parent, src)
+	if err != nil || m.TypeField == "" {
+		return data, err
+	}
+
+	return m.addTag(data, t)
+}
+
+// lookup returns the TypeMap registered for t with the TypeMapper in use.
+func (m *DynamicMap) lookup(ctx Context, t reflect.Type) (TypeMap, error) {
+	mapper := mapperFromContext(ctx)
+	if mapper == nil {
+		return nil, newSchemaError("jsonmap.Dynamic() may only be used through a TypeMapper")
+	}
+
+	tm, ok := mapper.typeMaps[t]
+	if !ok {
+		return nil, newSchemaError("no TypeMap registered for type: %s", t)
+	}
+	return tm, nil
+}
+
+// addTag inserts TypeField into data, the marshaled object of type t.
+func (m *DynamicMap) addTag(data json.Marshaler, t reflect.Type) (json.Marshaler, error) {
+	tag := ""
+	found := false
+	for name, proto := range m.Types {
+		if reflect.TypeOf(proto) == t {
+			tag = name
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, newSchemaError("no type identifier for type: %s", t)
+	}
+
+	return prependMember(data, m.TypeField, tag, t)
+}
+
+// prependMember inserts a member with the given name and value at the start of
+// data, the marshaled object of type t.
+func prependMember(data json.Marshaler, name, value string, t reflect.Type) (json.Marshaler, error) {
+	obj, err := data.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if len(obj) < 2 || obj[0] != '{' {
+		return nil, newSchemaError("type identifiers can only be added to objects, not %s", t)
+	}
+
+	buf := bytes.Buffer{}
+	if err := writeJSONKey(&buf, name); err != nil {
+		return nil, err
+	}
+	encodedTag, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []byte{'{'}
+	result = append(result, buf.Bytes()...)
+	result = append(result, encodedTag...)
+	if len(obj) > 2 {
+		result = append(result, ',')
+	}
+	result = append(result, obj[1:]...)
+
+	return RawMessage{result}, nil
+}
+
+// containsDynamic reports whether tm is, or contains, a DynamicMap, which
+// needs the TypeMapper in use to be passed through the Context.
+func containsDynamic(tm TypeMap, seen map[TypeMap]bool) bool {
+	if reflect.ValueOf(tm).Kind() == reflect.Ptr {
+		if seen[tm] {
+			return false
+		}
+		seen[tm] = true
+	}
+
+	switch m := tm.(type) {
+	case *DynamicMap:
+		return true
+	case StructMap:
+		for _, field := range m.Fields {
+			if field.Contains != nil && containsDynamic(field.Contains, seen) {
+				return true
+			}
+		}
+	case ConstrainedStructMap:
+		return containsDynamic(m.StructMap, seen)
+	case SliceMap:
+		return containsDynamic(m.Contains, seen)
+	case TupleMap:
+		for _, elem := range m.Elems {
+			if containsDynamic(elem, seen) {
+				return true
+			}
+		}
+	case MapMap:
+		return containsDynamic(m.Contains, seen)
+	case *Discriminator:
+		for _, variant := range m.Mapping {
+			if containsDynamic(variant, seen) {
+				return true
+			}
+		}
+		if m.Default != nil {
+			return containsDynamic(m.Default, seen)
+		}
+	case *UnionMap:
+		for _, variant := range m.Variants {
+			if containsDynamic(variant, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Dynamic maps an interface field holding any registered type.
+func Dynamic() *DynamicMap {
+	return &DynamicMap{}
+}
+
+// Tagged identifies the type of the value with field when marshaling, using
+// the names given by types, so that the value can be unmarshaled too.
+func (m *DynamicMap) Tagged(field string, types map[string]interface{}) *DynamicMap {
+	m.TypeField = field
+	m.Types = types
+	return m
+}
+
+// UnionMap maps a value which may match any one of several TypeMaps, where
+// there is nothing in the input to say which. Each is tried in turn, and
+// exactly one must succeed.
+type UnionMap struct {
+	Variants []TypeMap
+}
+
+func (m *UnionMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if partial == nil && (dstValue.Kind() == reflect.Interface || dstValue.Kind() == reflect.Ptr) {
+		return nil
+	}
+
+	var match reflect.Value
+	var matchErr error
+	matches := 0
+	mismatches := []*ValidationError{}
+
+	// Errors from the variants which are rejected mustn't count towards
+	// MaxErrors(), so each one is tried separately. If none match, their
+	// errors are reported together as a single error.
+	for _, variant := range m.Variants {
+		candidate := reflect.New(dstValue.Type()).Elem()
+		err := variant.Unmarshal(isolateErrors(ctx), parent, partial, candidate)
+		if err == nil || isWarning(err) {
+			matches++
+			match, matchErr = candidate, err
+			continue
+		}
+
+		e, ok := err.(*ValidationError)
+		if !ok {
+			return err
+		}
+		mismatches = append(mismatches, e)
+	}
+
+	switch matches {
+	case 0:
+		errs := NewValidationError("did not match any variant").WithCode(CodeNoMatchingVariant)
+		for _, e := range mismatches {
+			errs.AddError(e)
+		}
+		return errs
+	case 1:
+		dstValue.Set(match)
+		return matchErr
+	default:
+		return NewValidationError("ambiguous, matched %d variants", matches).WithCode(CodeAmbiguousVariant).WithParam("matches", matches)
+	}
+}
+
+func (m *UnionMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	concrete := src
+	if concrete.Kind() == reflect.Interface {
+		if concrete.IsNil() {
+			return nullRawMessage, nil
+		}
+		concrete = concrete.Elem()
+	}
+	t := concrete.Type()
+	if t.Kind() == reflect.Ptr {
+		if concrete.IsNil() {
+			return nullRawMessage, nil
+		}
+		t = t.Elem()
+	}
+
+	// Prefer the variant for the value's type, otherwise use the first which
+	// accepts it
+	for _, variant := range m.Variants {
+		if rtm, ok := variant.(RegisterableTypeMap); ok && rtm.GetUnderlyingType() == t {
+			return variant.Marshal(ctx, parent, src)
+		}
+	}
+
+	var err error
+	for _, variant := range m.Variants {
+		var data json.Marshaler
+		if data, err = variant.Marshal(ctx, parent, src); err == nil {
+			return data, nil
+		}
+	}
+	if err == nil {
+		err = newSchemaError("jsonmap.OneOfTypes() requires at least one variant")
+	}
+	return nil, err
+}
+
+// OneOfTypes maps a value which must match exactly one of maps, for input
+// which carries no type identifier.
+func OneOfTypes(maps ...TypeMap) TypeMap {
+	return &UnionMap{
+		Variants: maps,
+	}
+}
+
+type RenderInfo struct {
+	Context Context
+	Parent  interface{}
+	Value   interface{}
+}
+
+type stringRenderer struct {
+	template *template.Template
+}
+
+func (sr *stringRenderer) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	return nil
+}
+
+func (sr *stringRenderer) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	buf := bytes.Buffer{}
+	err := sr.template.Execute(&buf, RenderInfo{
+		Context: UnwrapContext(ctx),
+		Parent:  parent.Interface(),
+		Value:   src.Interface(),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	marshalled, err := json.Marshal(buf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{marshalled}, nil
+}
+
+func StringRenderer(text string) *stringRenderer {
+	return &stringRenderer{
+		template: template.Must(template.New("").Parse(text)),
+	}
+}
+
+type passthroughMarshaler struct{}
+
+func (m *passthroughMarshaler) Marshal(ctx Context, parent *reflect.Value, field reflect.Value) (json.Marshaler, error) {
+	data, err := json.Marshal(field.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+type PrimitiveMap struct {
+	passthroughMarshaler
+	V Validator
+}
+
+func (m *PrimitiveMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	val, err := m.V.Validate(partial)
+	if applySeverity(ctx, err) {
+		setDowngraded(dstValue, partial)
+		return err
+	}
+	if err != nil && !isWarning(err) {
+		return err
+	}
+
+	if val != nil {
+		converted, convErr := convertPrimitive(val, dstValue.Type())
+		if convErr != nil {
+			return convErr
+		}
+		dstValue.Set(converted)
+	}
+	return err
+}
+
+// convertPrimitive converts val, as returned by a Validator, to type t, so
+// that e.g. the int64 returned by Integer() can be stored in an int32 field.
+// Numbers which don't fit in t are rejected.
+func convertPrimitive(val interface{}, t reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(val)
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+
+	outOfRange := NewValidationError("out of range").WithCode(CodeOutOfRange)
+	zero := reflect.Zero(t)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if zero.OverflowInt(i) {
+				return reflect.Value{}, outOfRange
+			}
+			return v.Convert(t), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if i < 0 || zero.OverflowUint(uint64(i)) {
+				return reflect.Value{}, outOfRange
+			}
+			return v.Convert(t), nil
+		case reflect.Float32, reflect.Float64:
+			return v.Convert(t), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if u > math.MaxInt64 || zero.OverflowInt(int64(u)) {
+				return reflect.Value{}, outOfRange
+			}
+			return v.Convert(t), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if zero.OverflowUint(u) {
+				return reflect.Value{}, outOfRange
+			}
+			return v.Convert(t), nil
+		case reflect.Float32, reflect.Float64:
+			return v.Convert(t), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if f != math.Trunc(f) {
+				return reflect.Value{}, NewValidationError("not an integer").WithCode(CodeNotAnInteger)
+			}
+			if f < math.MinInt64 || f >= math.MaxInt64 || zero.OverflowInt(int64(f)) {
+				return reflect.Value{}, outOfRange
+			}
+			return v.Convert(t), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if f != math.Trunc(f) {
+				return reflect.Value{}, NewValidationError("not an integer").WithCode(CodeNotAnInteger)
+			}
+			if f < 0 || f >= math.MaxUint64 || zero.OverflowUint(uint64(f)) {
+				return reflect.Value{}, outOfRange
+			}
+			return v.Convert(t), nil
+		case reflect.Float32, reflect.Float64:
+			if zero.OverflowFloat(f) {
+				return reflect.Value{}, outOfRange
+			}
+			return v.Convert(t), nil
+		}
+	default:
+		// e.g. a string into a named string type, but not a []interface{}
+		// into a []string
+		if v.Kind() == t.Kind() && v.Type().ConvertibleTo(t) {
+			return v.Convert(t), nil
+		}
+	}
+
+	return reflect.Value{}, newSchemaError("cannot store %s in a field of type %s", v.Type(), t)
+}
+
+func NewPrimitiveMap(v Validator) TypeMap {
+	return &PrimitiveMap{
+		V: v,
+	}
+}
+
+// StringEncodedMap is the equivalent of encoding/json's ",string" option: the
+// value is marshaled as a JSON string containing its JSON encoding, so that
+// e.g. int64 IDs survive a round trip through JavaScript. On input both the
+// string and the plain encoding are accepted, and V is applied either way.
+type StringEncodedMap struct {
+	V Validator
+}
+
+func (m *StringEncodedMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if s, ok := partial.(string); ok {
+		// Strings which don't contain valid JSON are left for V to reject.
+		// Numbers are decoded as json.Number to avoid losing precision.
+		var decoded interface{}
+		if err := decodeJSON([]byte(s), &decoded, true); err == nil {
+			partial = decoded
+		}
+	}
+
+	pm := PrimitiveMap{V: m.V}
+	return pm.Unmarshal(ctx, parent, partial, dstValue)
+}
+
+func (m *StringEncodedMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	encoded, err := json.Marshal(src.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(string(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+// StringEncoded maps a primitive value validated by v to a JSON string, like
+// encoding/json's ",string" option.
+func StringEncoded(v Validator) TypeMap {
+	return &StringEncodedMap{
+		V: v,
+	}
+}
+
+type TimeMap struct {
+	passthroughMarshaler
+
+	// Layouts are the accepted input layouts, tried in order. The first one
+	// is also used when marshaling. If empty, RFC 3339 is used.
+	Layouts []string
+
+	// Epoch, if set, maps times to integers counting units of Epoch since the
+	// Unix epoch instead of strings, and Layouts is ignored.
+	Epoch time.Duration
+
+	// NotBeforeOffset and NotAfterOffset, if set, bound the accepted values
+	// relative to the current time as returned by Now (time.Now by default)
+	// at the time of unmarshaling.
+	NotBeforeOffset *time.Duration
+	NotAfterOffset  *time.Duration
+	Now             func() time.Time
+
+	invalidMsg string
+}
+
+func (m *TimeMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	underlying := dstValue.Interface()
+	if _, ok := underlying.(time.Time); !ok {
+		return newSchemaError("target field for jsonmap.Time() is not a time.Time")
+	}
+
+	var t time.Time
+	var err error
+
+	if m.Epoch != 0 {
+		t, err = m.parseEpoch(partial)
+	} else {
+		tstring, ok := partial.(string)
+
+		if !ok {
+			return NewValidationError("not a string").WithCode(CodeNotAString)
+		}
+
+		t, err = m.parse(tstring)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.validateWindow(t); err != nil {
+		return err
+	}
+
+	dstValue.Set(reflect.ValueOf(t))
+
+	return nil
+}
+
+func (m *TimeMap) validateWindow(t time.Time) error {
+	if m.NotBeforeOffset == nil && m.NotAfterOffset == nil {
+		return nil
+	}
+
+	now := time.Now
+	if m.Now != nil {
+		now = m.Now
+	}
+	current := now()
+
+	if d := m.NotBeforeOffset; d != nil && t.Before(current.Add(*d)) {
+		switch {
+		case *d < 0:
+			return NewValidationError("must not be more than %s in the past", -*d).WithCode(CodeOutOfRange)
+		case *d > 0:
+			return NewValidationError("must be at least %s in the future", *d).WithCode(CodeOutOfRange)
+		default:
+			return NewValidationError("must be in the future").WithCode(CodeOutOfRange)
+		}
+	}
+
+	if d := m.NotAfterOffset; d != nil && t.After(current.Add(*d)) {
+		switch {
+		case *d > 0:
+			return NewValidationError("must not be more than %s in the future", *d).WithCode(CodeOutOfRange)
+		case *d < 0:
+			return NewValidationError("must be at least %s in the past", -*d).WithCode(CodeOutOfRange)
+		default:
+			return NewValidationError("must be in the past").WithCode(CodeOutOfRange)
+		}
+	}
+
+	return nil
+}
+
+// NotBefore rejects times earlier than now plus offset, evaluated when the
+// value is unmarshaled. Use a negative offset to allow times in the recent
+// past, e.g. NotBefore(-24 * time.Hour).
+func (m *TimeMap) NotBefore(offset time.Duration) *TimeMap {
+	m.NotBeforeOffset = &offset
+	return m
+}
+
+// NotAfter rejects times later than now plus offset, evaluated when the value
+// is unmarshaled.
+func (m *TimeMap) NotAfter(offset time.Duration) *TimeMap {
+	m.NotAfterOffset = &offset
+	return m
+}
+
+// MustBeFuture rejects times that are not in the future.
+func (m *TimeMap) MustBeFuture() *TimeMap {
+	return m.NotBefore(0)
+}
+
+// MustBePast rejects times that are in the future.
+func (m *TimeMap) MustBePast() *TimeMap {
+	return m.NotAfter(0)
+}
+
+func (m *TimeMap) parse(s string) (time.Time, error) {
+	if len(m.Layouts) == 0 {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return time.Time{}, NewValidationError("not a valid RFC 3339 time value").WithCode(CodeInvalidFormat)
+		}
+		return t, nil
+	}
+
+	for _, layout := range m.Layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, NewValidationError("%s", m.invalidMsg).WithCode(CodeInvalidFormat)
+}
+
+func (m *TimeMap) parseEpoch(partial interface{}) (time.Time, error) {
+	n, ok := toInt64(partial)
+	if !ok {
+		return time.Time{}, NewValidationError("not a valid Unix timestamp, expected an integer").WithCode(CodeNotAnInteger)
+	}
+
+	// n units may not fit in an int64 of nanoseconds, so split it into
+	// seconds and nanoseconds
+	sec, nsec := new(big.Int), new(big.Int)
+	total := new(big.Int).Mul(big.NewInt(n), big.NewInt(int64(m.Epoch)))
+	sec.DivMod(total, big.NewInt(int64(time.Second)), nsec)
+	if !sec.IsInt64() || sec.Int64() > maxUnixSeconds || sec.Int64() < -maxUnixSeconds {
+		return time.Time{}, NewValidationError("timestamp out of range").WithCode(CodeOutOfRange)
+	}
+
+	return time.Unix(sec.Int64(), nsec.Int64()).UTC(), nil
+}
+
+// maxUnixSeconds bounds the times accepted by parseEpoch to those which
+// time.Time can represent, which count seconds from the year 1.
+const maxUnixSeconds = math.MaxInt64 - 62135596800
+
+// epochValue returns the number of units of m.Epoch from the Unix epoch to t,
+// rounded down.
+func (m *TimeMap) epochValue(t time.Time) (int64, error) {
+	total := new(big.Int).Mul(big.NewInt(t.Unix()), big.NewInt(int64(time.Second)))
+	total.Add(total, big.NewInt(int64(t.Nanosecond())))
+	// Div rounds towards negative infinity for a positive divisor
+	total.Div(total, big.NewInt(int64(m.Epoch)))
+	if !total.IsInt64() {
+		return 0, fmt.Errorf("time %s cannot be represented in units of %s", t, m.Epoch)
+	}
+	return total.Int64(), nil
+}
+
+func (m *TimeMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if len(m.Layouts) == 0 && m.Epoch == 0 {
+		return m.passthroughMarshaler.Marshal(ctx, parent, src)
+	}
+
+	t, ok := src.Interface().(time.Time)
+	if !ok {
+		return nil, newSchemaError("source field for jsonmap.Time() is not a time.Time")
+	}
+
+	var val interface{}
+	if m.Epoch != 0 {
+		var err error
+		if val, err = m.epochValue(t); err != nil {
+			return nil, err
+		}
+	} else {
+		val = t.Format(m.Layouts[0])
+	}
+
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+func Time() *TimeMap {
+	return &TimeMap{}
+}
+
+// TimeWithLayout maps a time.Time to a string in the given layout, as used by
+// time.Format(). Values in any of the accepted layouts are also accepted as
+// input, for clients which send times in more than one format. Times without
+// a zone are interpreted as UTC.
+func TimeWithLayout(layout string, accepted ...string) *TimeMap {
+	return &TimeMap{
+		Layouts:    append([]string{layout}, accepted...),
+		invalidMsg: fmt.Sprintf("not a valid time, expected a value like %q", layout),
+	}
+}
+
+// UnixTime maps a time.Time to an integer number of seconds since the Unix
+// epoch. Times are unmarshaled in UTC.
+func UnixTime() *TimeMap {
+	return &TimeMap{
+		Epoch: time.Second,
+	}
+}
+
+// UnixMilliTime maps a time.Time to an integer number of milliseconds since
+// the Unix epoch. Times are unmarshaled in UTC.
+func UnixMilliTime() *TimeMap {
+	return &TimeMap{
+		Epoch: time.Millisecond,
+	}
+}
+
+// Date maps a calendar date in the form YYYY-MM-DD to a time.Time at midnight
+// UTC.
+func Date() *TimeMap {
+	return &TimeMap{
+		Layouts:    []string{"2006-01-02"},
+		invalidMsg: "not a valid date, expected YYYY-MM-DD",
+	}
+}
+
+// TimeOfDay maps a wall clock time in the form HH:MM:SS (or HH:MM) to a
+// time.Time on January 1 of year 0. It is marshaled as HH:MM:SS.
+func TimeOfDay() *TimeMap {
+	return &TimeMap{
+		Layouts:    []string{"15:04:05", "15:04"},
+		invalidMsg: "not a valid time of day, expected HH:MM:SS",
+	}
+}
+
+// BytesMap maps []byte fields to base64 strings.
+type BytesMap struct {
+	V *Base64Validator
+}
+
+func (m *BytesMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if dstValue.Type() != reflect.TypeOf([]byte(nil)) {
+		return newSchemaError("target field for jsonmap.Bytes() is not a []byte")
+	}
+
+	// As with encoding/json, null is unmarshaled as a nil slice
+	if partial == nil {
+		dstValue.SetBytes(nil)
+		return nil
+	}
+
+	b, err := m.V.Validate(partial)
+	if err != nil {
+		return err
+	}
+
+	dstValue.SetBytes(b.([]byte))
+	return nil
+}
+
+func (m *BytesMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Type() != reflect.TypeOf([]byte(nil)) {
+		return nil, newSchemaError("source field for jsonmap.Bytes() is not a []byte")
+	}
+
+	if src.IsNil() {
+		return nullRawMessage, nil
+	}
+
+	data, err := json.Marshal(m.V.Encoding.EncodeToString(src.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+// URLEncoding switches to the URL-safe base64 alphabet.
+func (m *BytesMap) URLEncoding() *BytesMap {
+	m.V.URLEncoding()
+	return m
+}
+
+// Bytes maps a []byte field to a standard, padded base64 string, like
+// encoding/json does, but rejects input which decodes to more than maxLen
+// bytes.
+func Bytes(maxLen int) *BytesMap {
+	return &BytesMap{
+		V: Base64(maxLen).Decoded(),
+	}
+}
+
+var bigIntType = reflect.TypeOf(big.Int{})
+var bigFloatType = reflect.TypeOf(big.Float{})
+
+// setBig stores v, a *big.Int or *big.Float, in dstValue, which may be either
+// a pointer or a value.
+func setBig(dstValue reflect.Value, v interface{}) {
+	if dstValue.Kind() == reflect.Ptr {
+		dstValue.Set(reflect.ValueOf(v))
+	} else {
+		dstValue.Set(reflect.ValueOf(v).Elem())
+	}
+}
+
+// marshalBig encodes s, the text of a big number, as a string or a number.
+func marshalBig(s string, asNumber bool) (json.Marshaler, error) {
+	if asNumber {
+		return RawMessage{[]byte(s)}, nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+// BigIntMap maps big.Int or *big.Int fields to integers of any size. Values
+// are marshaled as strings unless EncodeNumber is set, since most JSON
+// parsers can't represent large numbers exactly.
+type BigIntMap struct {
+	MinVal       *big.Int
+	MaxVal       *big.Int
+	EncodeNumber bool
+}
+
+func (m *BigIntMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if t := dstValue.Type(); t != bigIntType && t != reflect.PtrTo(bigIntType) {
+		return newSchemaError("target field for jsonmap.BigInt() is not a big.Int")
+	}
+
+	var n *big.Int
+	switch v := partial.(type) {
+	case string:
+		n, _ = new(big.Int).SetString(v, 10)
+	case json.Number:
+		n, _ = new(big.Int).SetString(string(v), 10)
+	case float64:
+		// Larger float64 values may already have lost precision
+		if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+			n = big.NewInt(int64(v))
+		}
+	}
+	if n == nil {
+		return NewValidationError("not an integer").WithCode(CodeNotAnInteger)
+	}
+
+	if m.MinVal != nil && n.Cmp(m.MinVal) < 0 {
+		return NewValidationError("too small, must be at least %s", m.MinVal).WithCode(CodeOutOfRange).WithParam("min", m.MinVal.String())
+	}
+
+	if m.MaxVal != nil && n.Cmp(m.MaxVal) > 0 {
+		return NewValidationError("too large, may not be larger than %s", m.MaxVal).WithCode(CodeOutOfRange).WithParam("max", m.MaxVal.String())
+	}
+
+	setBig(dstValue, n)
+	return nil
+}
+
+func (m *BigIntMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return nullRawMessage, nil
+		}
+		src = src.Elem()
+	}
+
+	if src.Type() != bigIntType {
+		return nil, newSchemaError("source field for jsonmap.BigInt() is not a big.Int")
+	}
+
+	// src may not be addressable, so use a (shallow) copy
+	n := new(big.Int)
+	reflect.ValueOf(n).Elem().Set(src)
+	return marshalBig(n.String(), m.EncodeNumber)
+}
+
+// Min sets the smallest accepted value.
+func (m *BigIntMap) Min(min *big.Int) *BigIntMap {
+	m.MinVal = min
+	return m
+}
+
+// Max sets the largest accepted value.
+func (m *BigIntMap) Max(max *big.Int) *BigIntMap {
+	m.MaxVal = max
+	return m
+}
+
+// AsNumber marshals values as JSON numbers instead of strings.
+func (m *BigIntMap) AsNumber() *BigIntMap {
+	m.EncodeNumber = true
+	return m
+}
+
+// BigInt maps integers of any size, sent either as strings such as
+// "123456789012345678901234567890" or as numbers, to big.Int fields. Numbers
+// larger than 2^53 are only accepted when the UseNumber() option is used.
+func BigInt() *BigIntMap {
+	return &BigIntMap{}
+}
+
+// BigFloatMap maps big.Float or *big.Float fields to numbers of arbitrary
+// precision. Values are marshaled as strings unless EncodeNumber is set.
+type BigFloatMap struct {
+	Prec         uint
+	EncodeNumber bool
+}
+
+func (m *BigFloatMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if t := dstValue.Type(); t != bigFloatType && t != reflect.PtrTo(bigFloatType) {
+		return newSchemaError("target field for jsonmap.BigFloat() is not a big.Float")
+	}
+
+	f := new(big.Float).SetPrec(m.Prec)
+	ok := false
+	switch v := partial.(type) {
+	case string:
+		_, ok = f.SetString(v)
+		// big.Float accepts "Inf", which can't be represented in JSON
+		ok = ok && !f.IsInf()
+	case json.Number:
+		_, ok = f.SetString(string(v))
+	case float64:
+		f.SetFloat64(v)
+		ok = true
+	}
+	if !ok {
+		return NewValidationError("not a valid number").WithCode(CodeInvalidFormat)
+	}
+
+	setBig(dstValue, f)
+	return nil
+}
+
+func (m *BigFloatMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return nullRawMessage, nil
+		}
+		src = src.Elem()
+	}
+
+	if src.Type() != bigFloatType {
+		return nil, newSchemaError("source field for jsonmap.BigFloat() is not a big.Float")
+	}
+
+	f := new(big.Float)
+	reflect.ValueOf(f).Elem().Set(src)
+	if f.IsInf() {
+		return nil, newSchemaError("cannot marshal an infinite big.Float")
+	}
+	return marshalBig(f.Text('g', -1), m.EncodeNumber)
+}
+
+// AsNumber marshals values as JSON numbers instead of strings.
+func (m *BigFloatMap) AsNumber() *BigFloatMap {
+	m.EncodeNumber = true
+	return m
+}
+
+// BigFloat maps numbers of arbitrary precision, sent either as strings or as
+// numbers, to big.Float fields with the given precision in bits. If prec is
+// 0, the precision is taken from the input: 64 bits for strings, and 53 bits
+// for numbers unless the UseNumber() option is used.
+func BigFloat(prec uint) *BigFloatMap {
+	return &BigFloatMap{
+		Prec: prec,
+	}
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// CustomMap defers to a type's own MarshalJSON() and UnmarshalJSON() methods,
+// so that existing types can be mapped without a TypeMap of their own. V, if
+// set, validates the decoded JSON value before it is passed to
+// UnmarshalJSON(). Errors returned by UnmarshalJSON() which aren't
+// ValidationErrors are reported with CodeInvalidFormat.
+type CustomMap struct {
+	V Validator
+}
+
+func (m *CustomMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	var warning error
+	if m.V != nil {
+		_, err := m.V.Validate(partial)
+		if applySeverity(ctx, err) {
+			return err
+		}
+		if err != nil && !isWarning(err) {
+			return err
+		}
+		warning = err
+	}
+
+	target := dstValue
+	if dstValue.Kind() == reflect.Ptr {
+		// As with encoding/json, null is unmarshaled as a nil pointer
+		if partial == nil {
+			dstValue.Set(reflect.Zero(dstValue.Type()))
+			return warning
+		}
+		target = reflect.New(dstValue.Type().Elem())
+	} else {
+		target = dstValue.Addr()
+	}
+
+	u, ok := target.Interface().(json.Unmarshaler)
+	if !ok {
+		return newSchemaError("target field for jsonmap.Custom() does not implement json.Unmarshaler")
+	}
+
+	data, err := json.Marshal(partial)
+	if err != nil {
+		return err
+	}
+
+	if err := u.UnmarshalJSON(data); err != nil {
+		if ve, ok := err.(*ValidationError); ok {
+			return ve
+		}
+		return NewValidationError("%s", err.Error()).WithCode(CodeInvalidFormat)
+	}
+
+	if dstValue.Kind() == reflect.Ptr {
+		dstValue.Set(target)
+	}
+	return warning
+}
+
+func (m *CustomMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Kind() == reflect.Ptr && src.IsNil() {
+		return nullRawMessage, nil
+	}
+
+	// Use the pointer when possible, in case MarshalJSON() has a pointer
+	// receiver
+	if src.Kind() != reflect.Ptr && src.CanAddr() {
+		src = src.Addr()
+	}
+
+	data, err := json.Marshal(src.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	return RawMessage{data}, nil
+}
+
+// Custom maps a field whose type implements json.Marshaler and
+// json.Unmarshaler, optionally validating its JSON representation with v.
+func Custom(v Validator) *CustomMap {
+	return &CustomMap{
+		V: v,
+	}
+}
+
+var iso8601DurationRegex = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+type DurationMap struct {
+	MinVal       time.Duration
+	MaxVal       time.Duration
+	AllowISO8601 bool
+	// Unit, if set, maps durations to integers counting units of Unit, such
+	// as nanoseconds, instead of duration strings.
+	Unit time.Duration
+}
+
+func (m *DurationMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	if dstValue.Type() != reflect.TypeOf(time.Duration(0)) {
+		return newSchemaError("target field for jsonmap.Duration() is not a time.Duration")
+	}
+
+	d, err := m.parse(partial)
+	if err != nil {
+		return err
+	}
+
+	if d < m.MinVal {
+		return NewValidationError("too short, must be at least %s", m.MinVal).WithCode(CodeOutOfRange).WithParam("min", m.MinVal.String())
+	}
+
+	if d > m.MaxVal {
+		return NewValidationError("too long, may not be longer than %s", m.MaxVal).WithCode(CodeOutOfRange).WithParam("max", m.MaxVal.String())
+	}
+
+	dstValue.SetInt(int64(d))
+
+	return nil
+}
+
+func (m *DurationMap) parse(partial interface{}) (time.Duration, error) {
+	if m.Unit != 0 {
+		n, ok := toInt64(partial)
+		if !ok {
+			return 0, NewValidationError("not an integer").WithCode(CodeNotAnInteger)
+		}
+		unit := int64(m.Unit)
+		if n > math.MaxInt64/unit || n < math.MinInt64/unit {
+			return 0, NewValidationError("duration out of range").WithCode(CodeOutOfRange)
+		}
+		return time.Duration(n * unit), nil
+	}
+
+	s, ok := partial.(string)
+	if !ok {
+		return 0, NewValidationError("not a string").WithCode(CodeNotAString)
 	}
 
-	data, err := json.Marshal(result)
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		var isoOK bool
+		if m.AllowISO8601 {
+			d, isoOK = parseISO8601Duration(s)
+		}
+		if !isoOK {
+			return 0, NewValidationError("not a valid duration").WithCode(CodeInvalidFormat)
+		}
+	}
+
+	return d, nil
+}
+
+func (m *DurationMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	if src.Type() != reflect.TypeOf(time.Duration(0)) {
+		return nil, newSchemaError("source field for jsonmap.Duration() is not a time.Duration")
+	}
+
+	var val interface{}
+	if m.Unit != 0 {
+		val = src.Int() / int64(m.Unit)
+	} else {
+		val = time.Duration(src.Int()).String()
+	}
+
+	data, err := json.Marshal(val)
 	if err != nil {
 		return nil, err
 	}
@@ -553,212 +3637,451 @@ func (mm MapMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value)
 	return RawMessage{data}, nil
 }
 
-func MapOf(elem TypeMap) TypeMap {
-	return &MapMap{
-		Contains: elem,
-	}
+// ISO8601 additionally accepts ISO 8601 durations such as "PT1H30M". Only the
+// week, day, hour, minute and second components are supported, since years
+// and months don't have a fixed length.
+func (m *DurationMap) ISO8601() *DurationMap {
+	m.AllowISO8601 = true
+	return m
 }
 
-type toStringable interface {
-	ToString() string
+// InUnits maps durations to integers counting units of unit, e.g.
+// time.Millisecond, instead of duration strings.
+func (m *DurationMap) InUnits(unit time.Duration) *DurationMap {
+	m.Unit = unit
+	return m
 }
 
-// The discrimator is used to handle cases in which a JSON property may be more than one type
-// (e.g. Human.Pet may be type Dog or Cat). PropertyName is the name of said property and
-// Mapping is a map between the possible types (as strings) and the appropriate TypeMap
-// corresponding to the given type.
-// See https://swagger.io/specification/#discriminatorObject for more information.
-type Discriminator struct {
-	PropertyName string
-	Mapping      map[string]TypeMap
+// DurationNanoseconds maps integer nanoseconds, as used by encoding/json for
+// time.Duration, to time.Duration fields.
+func DurationNanoseconds(minVal, maxVal time.Duration) *DurationMap {
+	return Duration(minVal, maxVal).InUnits(time.Nanosecond)
 }
 
-func (vt *Discriminator) pickTypeMap(parent *reflect.Value) (TypeMap, error) {
-	typeKeyField := parent.FieldByName(vt.PropertyName)
-	if !typeKeyField.IsValid() {
-		panic("no such underlying field: " + vt.PropertyName)
+// Duration maps Go duration strings such as "30s" or "1h30m" to
+// time.Duration fields. Values are marshaled using time.Duration.String().
+func Duration(minVal, maxVal time.Duration) *DurationMap {
+	return &DurationMap{
+		MinVal: minVal,
+		MaxVal: maxVal,
 	}
+}
 
-	keyString := ""
-
-	typeKey := typeKeyField.Interface()
-	switch keyVal := typeKey.(type) {
-	case string:
-		keyString = keyVal
-	case toStringable:
-		keyString = keyVal.ToString()
-	default:
-		panic("cannot convert underlying field to string: " + typeKeyField.String())
+func parseISO8601Duration(s string) (time.Duration, bool) {
+	m := iso8601DurationRegex.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, false
 	}
 
-	typeMap, ok := vt.Mapping[keyString]
-
-	if !ok {
-		// NOTE: This error message isn't great because we don't have a way to know
-		// the JSON field name uponw which we're switching.
-		//TODO: include JSON field name uponw which we're switching to other error messages
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
 
-		if keyString != "" {
-			return nil, NewValidationError("invalid type identifier: '%s'", keyString)
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
 		}
-
-		if f, found := parent.Type().FieldByName(vt.PropertyName); found {
-			jsonField := parseJsonTag(f)
-			if jsonField != "" {
-				return nil, NewValidationError("cannot validate, invalid input for '%s'", jsonField)
-			}
+		n, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil {
+			return 0, false
 		}
+		d += time.Duration(n) * unit
+	}
 
-		return nil, NewValidationError("invalid type identifier")
+	if m[5] != "" {
+		secs, err := strconv.ParseFloat(m[5], 64)
+		if err != nil {
+			return 0, false
+		}
+		d += time.Duration(secs * float64(time.Second))
 	}
 
-	return typeMap, nil
+	return d, true
 }
 
-func (vt *Discriminator) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
-	tm, err := vt.pickTypeMap(parent)
-	if err != nil {
-		return err
+// An UnmarshalOption configures a single call to TypeMapper.Unmarshal().
+//
+// When options are given, or a registered TypeMap uses Dynamic(), TypeMaps
+// are passed a Context which wraps the one supplied by the caller. The same
+// applies to Marshal() when the TypeMapper has a NilPolicy. Custom TypeMaps
+// which inspect the Context should call UnwrapContext() to retrieve the
+// original.
+type UnmarshalOption func(*unmarshalState)
+
+// MaxErrors caps the number of validation errors collected during a single
+// Unmarshal() call. Errors beyond the limit are counted but discarded, and
+// summarized by a final "and N more errors" entry.
+func MaxErrors(n int) UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.maxErrors = n
 	}
+}
 
-	return tm.Unmarshal(ctx, parent, partial, dstValue)
+// MaxBytes rejects input larger than n bytes before decoding it. With a
+// Decoder, the limit applies to the stream as a whole.
+func MaxBytes(n int64) UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.maxBytes = n
+	}
 }
 
-func (vt *Discriminator) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
-	if src.IsZero() {
-		return nullRawMessage, nil
+// MaxKeys rejects input containing an object with more than n keys, before
+// decoding it.
+func MaxKeys(n int) UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.maxKeys = n
 	}
+}
 
-	tm, err := vt.pickTypeMap(parent)
-	if err != nil {
-		panic("variable type serialization error: " + err.Error())
+// MaxArrayLen rejects input containing an array with more than n elements,
+// before decoding it. Unlike the MaxLen of a SliceMap, this applies to every
+// array, including those which are later ignored.
+func MaxArrayLen(n int) UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.maxArrayLen = n
 	}
+}
 
-	return tm.Marshal(ctx, parent, src)
+// FailFast stops validation at the first error rather than collecting all of
+// them.
+func FailFast() UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.failFast = true
+	}
 }
 
-func VariableType(switchOnFieldName string, types map[string]TypeMap) TypeMap {
-	return &Discriminator{
-		PropertyName: switchOnFieldName,
-		Mapping:      types,
+// IncludeValues records the offending JSON value in the "value" parameter of
+// each validation error, and rewrites type mismatch messages to describe what
+// was received, e.g. "got number 12, expected string". It is opt-in because
+// the values may be sensitive.
+func IncludeValues() UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.includeValues = true
 	}
 }
 
-type RenderInfo struct {
-	Context Context
-	Parent  interface{}
-	Value   interface{}
+// UseNumber decodes JSON numbers as json.Number rather than float64, so that
+// integers beyond 2^53 reach validators intact. The built-in numeric
+// validators accept either representation, but Interface() will produce
+// json.Number values.
+func UseNumber() UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.useNumber = true
+	}
 }
 
-type stringRenderer struct {
-	template *template.Template
+// Lenient accepts hand-edited input containing // and /* */ comments and
+// trailing commas in objects and arrays, e.g. for uploaded configuration
+// files. Positions in SyntaxErrors still refer to the original input.
+func Lenient() UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.lenient = true
+	}
 }
 
-func (sr *stringRenderer) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
-	return nil
+// DisallowTrailingData makes Decode() reject anything but whitespace following
+// the value, rather than leaving it unread, which means reading r to the end.
+// Unmarshal() always rejects trailing data.
+func DisallowTrailingData() UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.disallowTrailingData = true
+	}
 }
 
-func (sr *stringRenderer) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
-	buf := bytes.Buffer{}
-	err := sr.template.Execute(&buf, RenderInfo{
-		Context: ctx,
-		Parent:  parent.Interface(),
-		Value:   src.Interface(),
-	})
+func newTrailingDataError() *ValidationError {
+	return NewValidationError("unexpected data after the end of the JSON value").WithCode(CodeTrailingData)
+}
 
-	if err != nil {
-		return nil, err
+// decodeJSON is equivalent to json.Unmarshal(), optionally decoding numbers as
+// json.Number.
+func decodeJSON(data []byte, v interface{}, useNumber bool) error {
+	// A json.Decoder stops at the end of the first value and reports errors
+	// differently, so invalid input is left to json.Unmarshal()
+	if !useNumber || !json.Valid(data) {
+		return json.Unmarshal(data, v)
 	}
 
-	marshalled, err := json.Marshal(buf.String())
-	if err != nil {
-		return nil, err
-	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
 
-	return RawMessage{marshalled}, nil
+// Warnings collects any warnings emitted while unmarshaling into dst. Warnings
+// don't cause Unmarshal() to fail.
+func Warnings(dst *[]*FlattenedPathError) UnmarshalOption {
+	return func(s *unmarshalState) {
+		s.warnings = dst
+	}
 }
 
-func StringRenderer(text string) *stringRenderer {
-	return &stringRenderer{
-		template: template.Must(template.New("").Parse(text)),
+// Downgrade reports errors with any of the given codes as warnings, so that a
+// new rule can be rolled out without rejecting input which it would have
+// accepted before. Where possible the value which failed validation is still
+// unmarshaled.
+func Downgrade(codes ...string) UnmarshalOption {
+	return func(s *unmarshalState) {
+		if s.downgraded == nil {
+			s.downgraded = map[string]bool{}
+		}
+		for _, code := range codes {
+			s.downgraded[code] = true
+		}
 	}
 }
 
-type passthroughMarshaler struct{}
+type unmarshalState struct {
+	Context
 
-func (m *passthroughMarshaler) Marshal(ctx Context, parent *reflect.Value, field reflect.Value) (json.Marshaler, error) {
-	data, err := json.Marshal(field.Interface())
-	if err != nil {
-		return nil, err
+	mapper *TypeMapper
+
+	warnings   *[]*FlattenedPathError
+	downgraded map[string]bool
+
+	failFast      bool
+	includeValues bool
+	useNumber     bool
+	lenient       bool
+	maxBytes      int64
+	maxKeys       int
+	maxArrayLen   int
+	maxErrors     int
+	collected     int
+	dropped       int
+
+	// disallowTrailingData is only consulted by Decode(), as Unmarshal()
+	// always rejects trailing data
+	disallowTrailingData bool
+}
+
+// UnwrapContext returns the Context originally passed to Unmarshal() or
+// Marshal(), even if it has been wrapped to carry options.
+func UnwrapContext(ctx Context) Context {
+	if s, ok := ctx.(*unmarshalState); ok {
+		ctx = s.Context
+	}
+	if s, ok := ctx.(*marshalState); ok {
+		ctx = s.Context
+	}
+	if lc, ok := ctx.(*localeContext); ok {
+		ctx = lc.Context
 	}
+	return ctx
+}
 
-	return RawMessage{data}, nil
+// applySeverity downgrades err, and anything nested within it, to a warning if
+// its code was passed to Downgrade(). It reports whether err was downgraded
+// from an error to a warning.
+func applySeverity(ctx Context, err error) bool {
+	s, ok := ctx.(*unmarshalState)
+	e, isValidationError := err.(*ValidationError)
+	if !ok || !isValidationError || len(s.downgraded) == 0 || !e.hasErrors() {
+		return false
+	}
+	s.downgrade(e)
+	return e.IsWarning()
 }
 
-type PrimitiveMap struct {
-	passthroughMarshaler
-	V Validator
+func (s *unmarshalState) downgrade(e *ValidationError) {
+	if s.downgraded[e.Code] {
+		e.Severity = SeverityWarning
+		return
+	}
+	for _, nested := range e.NestedErrors {
+		s.downgrade(nested)
+	}
 }
 
-func (m *PrimitiveMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
-	val, err := m.V.Validate(partial)
-	if err != nil {
-		return err
+// setDowngraded stores val, which failed a check that has been downgraded to a
+// warning, in dst if it can be converted to the appropriate type.
+func setDowngraded(dst reflect.Value, val interface{}) {
+	v := reflect.ValueOf(val)
+	if v.IsValid() && v.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(v.Convert(dst.Type()))
 	}
+}
 
-	if val != nil {
-		dstValue.Set(reflect.ValueOf(val))
+// collectError adds err to errs, subject to any limits configured with
+// UnmarshalOptions. Errors without a Message of their own are aggregates
+// whose nested errors have already been collected.
+func collectError(ctx Context, errs, err *ValidationError) {
+	applySeverity(ctx, err)
+	s, ok := ctx.(*unmarshalState)
+	if !ok || err.Message == "" || err.Severity == SeverityWarning {
+		errs.AddError(err)
+		return
 	}
-	return nil
+
+	s.collected++
+	if s.maxErrors > 0 && s.collected > s.maxErrors {
+		s.dropped++
+		if len(err.NestedErrors) == 0 {
+			return
+		}
+		err.Message = ""
+	}
+	errs.AddError(err)
 }
 
-func NewPrimitiveMap(v Validator) TypeMap {
-	return &PrimitiveMap{
-		V: v,
+// isolateErrors returns a Context in which errors are collected without
+// counting towards the MaxErrors() limit of ctx, for trying alternatives whose
+// errors may be discarded.
+func isolateErrors(ctx Context) Context {
+	s, ok := ctx.(*unmarshalState)
+	if !ok {
+		return ctx
 	}
+	trial := *s
+	trial.maxErrors, trial.collected, trial.dropped = 0, 0, 0
+	return &trial
 }
 
-type TimeMap struct {
-	passthroughMarshaler
+// expectedTypes maps the codes of type mismatch errors to the JSON type which
+// was expected.
+var expectedTypes = map[string]string{
+	CodeNotAString:   "string",
+	CodeNotABoolean:  "boolean",
+	CodeNotAnInteger: "integer",
+	CodeNotAnObject:  "object",
+	CodeNotAList:     "array",
+	CodeNotAMap:      "object",
 }
 
-func (m *TimeMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
-	underlying := dstValue.Interface()
-	if _, ok := underlying.(time.Time); !ok {
-		panic("target field for jsonmap.Time() is not a time.Time")
+const maxDescribedValueLen = 64
+
+func jsonTypeName(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return reflect.TypeOf(val).String()
+	}
+}
+
+// describeValue annotates err with the value which failed validation, if
+// IncludeValues() was requested. Errors which already describe a value, or
+// which aggregate other errors, are left alone.
+func describeValue(ctx Context, err *ValidationError, val interface{}) {
+	s, ok := ctx.(*unmarshalState)
+	if !ok || !s.includeValues || err.Message == "" || len(err.NestedErrors) != 0 {
+		return
+	}
+	if _, ok := err.Params["value"]; ok {
+		return
+	}
+
+	if err.redacted {
+		return
 	}
 
-	tstring, ok := partial.(string)
+	value, summary := summarizeValue(val)
+	err.WithParam("value", value)
 
+	expected, ok := expectedTypes[err.Code]
 	if !ok {
-		return NewValidationError("not a string")
+		return
 	}
+	err.WithParam("got", jsonTypeName(val))
+	err.WithParam("expected", expected)
 
-	t, err := time.Parse(time.RFC3339, tstring)
+	got := jsonTypeName(val)
+	if val != nil {
+		got += " " + summary
+	}
+	err.Message = fmt.Sprintf("got %s, expected %s", got, expected)
+}
 
-	if err != nil {
-		return NewValidationError("not a valid RFC 3339 time value")
+// summarizeValue truncates long strings, and replaces arrays and objects with
+// their (truncated) JSON encoding, so that error messages can't echo back
+// arbitrarily large input. It returns the value to record and a description
+// for use in messages.
+func summarizeValue(val interface{}) (interface{}, string) {
+	switch v := val.(type) {
+	case string:
+		truncated := truncateString(v, maxDescribedValueLen)
+		encoded, _ := json.Marshal(truncated)
+		return truncated, string(encoded)
+	case []interface{}, map[string]interface{}:
+		encoded, _ := json.Marshal(v)
+		truncated := truncateString(string(encoded), maxDescribedValueLen)
+		return truncated, truncated
+	default:
+		encoded, _ := json.Marshal(v)
+		return v, string(encoded)
 	}
+}
 
-	dstValue.Set(reflect.ValueOf(t))
+func truncateString(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
 
-	return nil
+// redactValues removes any values recorded by describeValue() from e and the
+// errors nested within it. It is used for fields marked Sensitive.
+func redactValues(e *ValidationError) {
+	e.redacted = true
+	if _, ok := e.Params["value"]; ok {
+		delete(e.Params, "value")
+		if expected, ok := e.Params["expected"]; ok {
+			e.Message = fmt.Sprintf("got %s, expected %s", e.Params["got"], expected)
+		}
+	}
+	for _, nested := range e.NestedErrors {
+		redactValues(nested)
+	}
 }
 
-func Time() TypeMap {
-	return &TimeMap{}
+// failingFast reports whether a TypeMap should stop processing because errs
+// already holds an error and FailFast() was requested.
+func failingFast(ctx Context, errs *ValidationError) bool {
+	s, ok := ctx.(*unmarshalState)
+	return ok && s.failFast && errs.hasErrors()
 }
 
+// An ErrorFormatter produces the message for a validation error from its code
+// and parameters. Returning an empty string keeps the built-in message.
+type ErrorFormatter func(code string, params map[string]interface{}) string
+
 type TypeMapper struct {
 	typeMaps map[reflect.Type]TypeMap
+
+	// ErrorFormatter, if set, is used to reword the messages of all coded
+	// validation errors returned by Unmarshal().
+	ErrorFormatter ErrorFormatter
+
+	// Catalog, if set, provides translated messages when Unmarshal() is
+	// called with a Context created by WithLocale(). It takes precedence over
+	// ErrorFormatter.
+	Catalog Catalog
+
+	// NilPolicy applies to every MappedField which doesn't set its own.
+	NilPolicy NilPolicy
+
+	// dynamic is set if a registered TypeMap uses Dynamic(), which requires
+	// the Context to be wrapped to carry the TypeMapper.
+	dynamic bool
 }
 
 func NewTypeMapper(maps ...RegisterableTypeMap) *TypeMapper {
 	t := &TypeMapper{
 		typeMaps: make(map[reflect.Type]TypeMap),
 	}
+	seen := map[TypeMap]bool{}
 	for _, m := range maps {
 		t.typeMaps[m.GetUnderlyingType()] = m
+		if containsDynamic(m, seen) {
+			t.dynamic = true
+		}
 	}
 	return t
 }
@@ -767,6 +4090,10 @@ func (tm *TypeMapper) getTypeMap(obj interface{}) TypeMap {
 	t := reflect.TypeOf(obj)
 	isSlice := false
 
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
 	if t.Kind() == reflect.Slice {
 		isSlice = true
 		t = t.Elem()
@@ -789,14 +4116,99 @@ func (tm *TypeMapper) getTypeMap(obj interface{}) TypeMap {
 	return m
 }
 
-func (tm *TypeMapper) Unmarshal(ctx Context, data []byte, dest interface{}) error {
+// Unmarshal validates data and stores the result in dest, which must be a
+// pointer to a registered type or to a slice of one. A slice is unmarshaled
+// from a JSON array, with errors reported by index, e.g. "/0/foo".
+func (tm *TypeMapper) Unmarshal(ctx Context, data []byte, dest interface{}, opts ...UnmarshalOption) error {
+	locale := LocaleFromContext(ctx)
+	if locale != "" {
+		ctx = ctx.(*localeContext).Context
+	}
+
+	err := tm.unmarshal(ctx, data, dest, opts)
+	if err != nil && (tm.ErrorFormatter != nil || (tm.Catalog != nil && locale != "")) {
+		tm.formatError(err, locale)
+	}
+	return err
+}
+
+// withOptions wraps ctx to carry opts, and the TypeMapper being used if it
+// needs to be passed to a DynamicMap. ctx is returned unchanged if neither is
+// needed.
+func withOptions(ctx Context, mapper *TypeMapper, opts []UnmarshalOption) (Context, *unmarshalState) {
+	if len(opts) == 0 && (mapper == nil || !mapper.dynamic) {
+		return ctx, nil
+	}
+
+	state := &unmarshalState{Context: ctx, mapper: mapper}
+	for _, opt := range opts {
+		opt(state)
+	}
+	return state, state
+}
+
+func (tm *TypeMapper) formatMessage(code string, params map[string]interface{}, message, locale string) string {
+	if code == "" {
+		return message
+	}
+	if tm.Catalog != nil && locale != "" {
+		if formatted, ok := tm.Catalog.Format(locale, code, params); ok {
+			return formatted
+		}
+	}
+	if tm.ErrorFormatter != nil {
+		if formatted := tm.ErrorFormatter(code, params); formatted != "" {
+			return formatted
+		}
+	}
+	return message
+}
+
+func (tm *TypeMapper) formatError(err error, locale string) {
+	switch e := err.(type) {
+	case *MultiValidationError:
+		for _, fe := range e.NestedErrors {
+			fe.Message = tm.formatMessage(fe.Code, fe.Params, fe.Message, locale)
+		}
+	case *ValidationError:
+		e.Message = tm.formatMessage(e.Code, e.Params, e.Message, locale)
+	case *SyntaxError:
+		params := map[string]interface{}{"line": e.Line, "column": e.Column}
+		e.Message = tm.formatMessage(e.Code, params, e.Message, locale)
+	}
+}
+
+func (tm *TypeMapper) unmarshal(ctx Context, data []byte, dest interface{}, opts []UnmarshalOption) error {
 	if reflect.TypeOf(dest).Kind() != reflect.Ptr || dest == nil {
 		panic("cannot unmarshal to non-pointer")
 	}
 	m := tm.getTypeMap(dest)
-	partial := map[string]interface{}{}
+	dstValue := reflect.ValueOf(dest).Elem()
+
+	// Slices of registered types are unmarshaled from a top-level array,
+	// anything else from an object
+	isList := dstValue.Kind() == reflect.Slice
+	obj := map[string]interface{}{}
+	var list []interface{}
+	var target interface{} = &obj
+	if isList {
+		target = &list
+	}
+
+	ctx, state := withOptions(ctx, tm, opts)
+
+	input := data
+	if state != nil && state.lenient {
+		input = stripLenient(data)
+	}
+
+	if ls := newLimitScanner(state); ls != nil {
+		if err := ls.feed(input); err != nil {
+			return err
+		}
+	}
 
-	err := json.Unmarshal(data, &partial)
+	err := decodeJSON(input, target, state != nil && state.useNumber)
 	if err != nil {
 		// We attempt to wrap json parse/unmarshal errors that can be caused by invalid input by
 		// a validation error here. This is somewhat fragile and dependent on go's json impl.
@@ -804,9 +4216,17 @@ func (tm *TypeMapper) Unmarshal(ctx Context, data []byte, dest interface{}) erro
 		case *json.InvalidUnmarshalError:
 			panic(e)
 		case *json.SyntaxError:
-			return NewValidationError(e.Error())
+			// If everything before the offending character is a complete
+			// value, the input continues after the end of it
+			if e.Offset > 0 && json.Valid(input[:e.Offset-1]) {
+				return newTrailingDataError()
+			}
+			return newSyntaxError(data, e)
 		case *json.UnmarshalTypeError:
-			return NewValidationError("json: cannot unmarshal, not an object")
+			if isList {
+				return NewValidationError("json: cannot unmarshal, not a list").WithCode(CodeNotAList)
+			}
+			return NewValidationError("json: cannot unmarshal, not an object").WithCode(CodeNotAnObject)
 		default:
 			// These are exported errors, but deprecated according to documentation.
 			//case *json.InvalidUTF8Error:
@@ -818,25 +4238,107 @@ func (tm *TypeMapper) Unmarshal(ctx Context, data []byte, dest interface{}) erro
 			return e
 		}
 	}
-	err = m.Unmarshal(ctx, nil, partial, reflect.ValueOf(dest).Elem())
-	if err != nil {
-		if e, ok := err.(*ValidationError); ok {
-			return e.Flatten()
+
+	var partial interface{} = obj
+	if isList {
+		if list == nil {
+			// Like json.Unmarshal(), null sets the slice to nil
+			dstValue.Set(reflect.Zero(dstValue.Type()))
+			return finishUnmarshal(state, dest, nil)
 		}
+		partial = list
+	}
+
+	err = m.Unmarshal(ctx, nil, partial, dstValue)
+	return finishUnmarshal(state, dest, err)
+}
+
+// finishUnmarshal converts the error returned by the root TypeMap into the
+// MultiValidationError returned to callers, and reports any warnings.
+func finishUnmarshal(state *unmarshalState, dest interface{}, err error) error {
+	rootType := reflect.TypeOf(dest).Elem()
+	root := rootType.Name()
+	if root == "" {
+		root = rootType.String()
+	}
+
+	var me *MultiValidationError
+	if e, ok := err.(*ValidationError); ok {
+		if state != nil && state.warnings != nil {
+			warnings := &MultiValidationError{}
+			warnings.addWarnings(e)
+			warnings.setRootGoPath(root)
+			*state.warnings = append(*state.warnings, warnings.NestedErrors...)
+		}
+		if !e.IsWarning() {
+			me = e.Flatten()
+		}
+	} else if err != nil {
 		return err
 	}
-	return nil
+
+	if state != nil && state.dropped != 0 {
+		if me == nil {
+			me = &MultiValidationError{}
+		}
+		fe := NewFlattenedPathError("", fmt.Sprintf("and %d more errors", state.dropped))
+		fe.Code = CodeTooManyErrors
+		fe.Params = map[string]interface{}{"count": state.dropped}
+		me.NestedErrors = append(me.NestedErrors, fe)
+	}
+
+	if me == nil {
+		return nil
+	}
+	me.setRootGoPath(root)
+	return me
 }
 
 func (tm *TypeMapper) Marshal(ctx Context, src interface{}) ([]byte, error) {
 	m := tm.getTypeMap(src)
-	data, err := m.Marshal(ctx, nil, reflect.ValueOf(src))
+	data, err := m.Marshal(tm.marshalContext(ctx), nil, reflect.ValueOf(src))
 	if err != nil {
 		return nil, err
 	}
 	return data.MarshalJSON()
 }
 
+// MarshalAppend is like Marshal(), but appends the JSON encoding of src to dst
+// and returns the extended buffer, so that callers can reuse buffers across
+// calls. On error dst is returned unchanged.
+func (tm *TypeMapper) MarshalAppend(dst []byte, ctx Context, src interface{}) ([]byte, error) {
+	m := tm.getTypeMap(src)
+	ctx = tm.marshalContext(ctx)
+
+	// A StructMap can write directly into dst
+	if sm, ok := m.(StructMap); ok {
+		buf := bytes.NewBuffer(dst)
+		if err := sm.marshalTo(ctx, buf, reflect.ValueOf(src)); err != nil {
+			return dst, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	data, err := m.Marshal(ctx, nil, reflect.ValueOf(src))
+	if err != nil {
+		return dst, err
+	}
+	b, err := data.MarshalJSON()
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+// marshalContext wraps ctx to carry the TypeMapper's marshaling settings, if
+// there are any which TypeMaps need.
+func (tm *TypeMapper) marshalContext(ctx Context) Context {
+	if tm.NilPolicy == NilDefault && !tm.dynamic {
+		return ctx
+	}
+	return &marshalState{Context: ctx, mapper: tm, nilPolicy: tm.NilPolicy}
+}
+
 func (tm *TypeMapper) MarshalIndent(ctx Context, src interface{}, prefix, indent string) ([]byte, error) {
 	// This is nuts, but equivalent to how json.MarshalIndent() works
 	data, err := tm.Marshal(ctx, src)
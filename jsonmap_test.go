@@ -1,13 +1,23 @@
 package jsonmap
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/textproto"
 	"net/url"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 	"unicode/utf8"
 
@@ -20,6 +30,19 @@ func (v brokenValidator) Validate(interface{}) (interface{}, error) {
 	return nil, errors.New("this should be a ValidationError")
 }
 
+type nonEmptyListValidator struct{}
+
+func (v nonEmptyListValidator) Validate(value interface{}) (interface{}, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, NewValidationError("expected a list").WithCode(CodeNotAList)
+	}
+	if len(list) == 0 {
+		return nil, NewValidationError("must not be empty").WithCode(CodeTooFewElements)
+	}
+	return nil, nil
+}
+
 type InnerThing struct {
 	Foo   string
 	AnInt int64
@@ -108,6 +131,8 @@ type OuterVariableThingInnerTypeIgnoredJsonTag struct {
 
 type OtherOuterVariableThing OuterVariableThing
 
+type ReorderedVariableThing OuterVariableThing
+
 type ReadOnlyThing struct {
 	PrimaryKey string
 }
@@ -161,6 +186,286 @@ type ThingWithTime struct {
 	HappenedAt time.Time
 }
 
+type ThingWithSchedule struct {
+	Day    time.Time
+	Starts time.Time
+}
+
+type ThingWithTimeout struct {
+	Timeout time.Duration
+}
+
+type ThingWithAttachment struct {
+	Name    string
+	Content []byte
+}
+
+type ThingWithEmbeddedJSON struct {
+	Raw    string
+	Config string
+}
+
+type ThingWithLocale struct {
+	Country  string
+	Currency string
+	Language string
+}
+
+type ThingWithPhone struct {
+	Phone string
+}
+
+type ThingWithCard struct {
+	Number string
+}
+
+type ThingWithPassword struct {
+	Password string
+}
+
+type ThingWithPrice struct {
+	Amount   string
+	Discount *big.Rat
+}
+
+type ThingWithUniqueSlices struct {
+	Tags   []string
+	Things []*InnerThing
+}
+
+type ThingWithKeyedMap struct {
+	ByID map[string]InnerThing
+}
+
+type ThingFromSloppyClient struct {
+	Count   int64
+	Enabled bool
+}
+
+type ThingWithNullable struct {
+	Nickname string
+}
+
+type ThingWithDefault struct {
+	Color string
+}
+
+type ThingWithQuota struct {
+	Limit int64
+}
+
+type ThingWithLocation struct {
+	Where GeoPoint
+	Lat   float64
+}
+
+type ThingWithSizedInts struct {
+	I   int
+	I8  int8
+	I16 int16
+	I32 int32
+	U   uint
+	U8  uint8
+	U16 uint16
+	U32 uint32
+}
+
+type UserLookup struct {
+	UserID string
+	Email  string
+	Phone  string
+}
+
+type OuterUserLookup struct {
+	Lookup UserLookup
+}
+
+type PaymentDetails struct {
+	CardNumber string
+	Expiry     string
+	CVC        string
+}
+
+type ThingWithDeprecatedColors struct {
+	Color  string
+	Others []string
+}
+
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type ThingWithCounters struct {
+	ID    int64
+	Count uint64
+	Extra map[string]interface{}
+}
+
+type ThingWithOrderedMap struct {
+	Attributes map[string]string
+}
+
+type ThingWithLegacyTime struct {
+	CreatedAt time.Time
+}
+
+type ThingWithTimestamps struct {
+	Created time.Time
+	Updated time.Time
+}
+
+type ThingWithIntervals struct {
+	Interval time.Duration
+	Delay    time.Duration
+}
+
+type ThingWithBlob struct {
+	Blob  []byte
+	Token []byte
+}
+
+type ThingWithBigNumbers struct {
+	Balance *big.Int
+	Supply  big.Int
+	Ratio   *big.Float
+}
+
+type ThingWithBoundingBox struct {
+	Box [4]float64
+}
+
+type LabelCount struct {
+	Label string
+	Count int64
+}
+
+type ThingWithTuples struct {
+	Location GeoPoint
+	Top      []LabelCount
+}
+
+type ThingWithTags struct {
+	Tags    []string
+	Ratings []int64
+	Users   []InnerThing
+}
+
+type ThingWithNestedContainers struct {
+	Groups   map[string][]InnerThing
+	Labels   []map[string]string
+	Pointers *[]InnerThing
+	Counts   *map[string]map[string]int64
+}
+
+type ThingWithNilPolicies struct {
+	Tags  []string
+	Meta  map[string]string
+	Inner *InnerThing
+}
+
+type Color struct {
+	R, G, B uint8
+}
+
+func (c Color) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B))
+}
+
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return fmt.Errorf("not a valid color: %s", s)
+	}
+	return nil
+}
+
+type ThingWithColors struct {
+	Color  Color
+	Accent *Color
+}
+
+type ThingWithStringIDs struct {
+	ID      int64
+	Enabled bool
+}
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", p.X, p.Y)), nil
+}
+
+func (p *Point) UnmarshalText(text []byte) error {
+	if _, err := fmt.Sscanf(string(text), "%d,%d", &p.X, &p.Y); err != nil {
+		return errors.New("not a valid point")
+	}
+	return nil
+}
+
+type Region string
+
+type ThingWithIntKeys struct {
+	Counts map[int]int64
+}
+
+type ThingWithKeyedMaps struct {
+	Heights map[Point]int64
+	Names   map[Region]string
+}
+
+type ThingWithDynamicPayload struct {
+	Payload interface{}
+	Tagged  interface{}
+}
+
+type ThingWithCheckedItems struct {
+	Items []InnerThing
+}
+
+type ThingWithNarrowNumbers struct {
+	Counts    []int
+	Levels    map[string]int8
+	Latitudes []float32
+	Regions   []Region
+}
+
+type VersionedThing struct {
+	Body interface{}
+}
+
+type Dog struct {
+	Barks bool
+}
+
+type Cat struct {
+	Kind  string
+	Lives int64
+}
+
+type ThingWithPet struct {
+	Pet interface{}
+}
+
+type ThingWithUntaggedPet struct {
+	Pet interface{}
+}
+
+type ClassifiedThing struct {
+	Value       interface{}
+	Category    string
+	Subcategory string
+}
+
+type ThingWithPets struct {
+	Pets []interface{}
+}
+
 type ThingWithEnumerableInterface struct {
 	ThanksGo interface{}
 }
@@ -388,6 +693,24 @@ var OuterVariableThingTypeMap = StructMap{
 	},
 }
 
+var OuterVariableThingWithDefaultTypeMap = StructMap{
+	OtherOuterVariableThing{},
+	[]MappedField{
+		{
+			StructFieldName: "InnerType",
+			JSONFieldName:   "inner_type",
+			Validator:       String(1, 255),
+		},
+		{
+			StructFieldName: "InnerValue",
+			JSONFieldName:   "inner_thing",
+			Contains: VariableTypeWithDefault("InnerType", map[string]TypeMap{
+				"foo": InnerThingTypeMap,
+			}, NewPrimitiveMap(Interface())),
+		},
+	},
+}
+
 var OuterVariableThingWithOneOfInnerTypeMap = StructMap{
 	OuterVariableThingInnerTypeOneOf{},
 	[]MappedField{
@@ -467,6 +790,25 @@ var BrokenOuterVariableThingTypeMap = StructMap{
 	},
 }
 
+var ReorderedVariableThingTypeMap = StructMap{
+	ReorderedVariableThing{},
+	[]MappedField{
+		{
+			StructFieldName: "InnerValue",
+			JSONFieldName:   "inner_thing",
+			Contains: VariableType("InnerType", map[string]TypeMap{
+				"foo": InnerThingTypeMap,
+				"bar": OtherInnerThingTypeMap,
+			}),
+		},
+		{
+			StructFieldName: "InnerType",
+			JSONFieldName:   "inner_type",
+			Validator:       String(1, 255),
+		},
+	},
+}
+
 var ReadOnlyThingTypeMap = StructMap{
 	ReadOnlyThing{},
 	[]MappedField{
@@ -586,1071 +928,4414 @@ var ThingWithTimeSchema = StructMap{
 	},
 }
 
-var ThingWithEnumerableInterfaceSchema = StructMap{
-	ThingWithEnumerableInterface{},
+var ThingWithScheduleSchema = StructMap{
+	ThingWithSchedule{},
 	[]MappedField{
 		{
-			StructFieldName: "ThanksGo",
-			JSONFieldName:   "thanks",
-			Validator:       OneOf("foo", "bar"),
+			StructFieldName: "Day",
+			JSONFieldName:   "day",
+			Contains:        Date(),
+		},
+		{
+			StructFieldName: "Starts",
+			JSONFieldName:   "starts",
+			Contains:        TimeOfDay(),
 		},
 	},
 }
 
-var TestTypeMapper = NewTypeMapper(
-	InnerThingTypeMap,
-	AnotherInnerThingTypeMap,
-	OuterThingTypeMap,
-	AnotherOuterThingTypeMap,
-	OuterPointerThingTypeMap,
-	OuterInterfaceThingTypeMap,
-	OuterSliceThingTypeMap,
-	ContainsMaxSliceSizeTypeMap,
-	ContainsMinSliceSizeTypeMap,
-	ContainsRangeSliceSizeTypeMap,
-	OuterPointerSliceThingTypeMap,
-	OuterPointerToSliceThingTypeMap,
-	OuterVariableThingTypeMap,
-	OuterVariableThingWithOneOfInnerTypeMap,
-	OuterVariableThingWithInnerTypeNoJsonTagTypeMap,
-	OuterVariableThingWithInnerTypeIgnoredJsonTagTypeMap,
-	BrokenOuterVariableThingTypeMap,
-	ReadOnlyThingTypeMap,
-	TypoedThingTypeMap,
-	BrokenThingTypeMap,
-	TemplatableThingTypeMap,
-	InnerNonMarshalableThingTypeMap,
-	OuterNonMarshalableThingTypeMap,
-	ThingWithSliceOfPrimitivesTypeMap,
-	ThingWithInnerMapTypeMap,
-	ThingWithMapOfInterfacesTypeMap,
-	ThingWithMapOfStringsTypeMap,
-	ThingWithTimeSchema,
-	ThingWithEnumerableInterfaceSchema,
-	MapOfInnerThingTypeMap,
-	Outer2DSliceThingTypeMap,
-)
+var ThingWithTimeoutSchema = StructMap{
+	ThingWithTimeout{},
+	[]MappedField{
+		{
+			StructFieldName: "Timeout",
+			JSONFieldName:   "timeout",
+			Contains:        Duration(time.Second, 2*time.Hour).ISO8601(),
+		},
+	},
+}
 
-func TestValidateInnerThing(t *testing.T) {
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": "fooz", "an_int": 10, "a_bool": true}`), v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if v.Foo != "fooz" {
-		t.Fatal("Field Foo does not have expected value 'fooz':", v.Foo)
-	}
+var ThingWithAttachmentSchema = StructMap{
+	ThingWithAttachment{},
+	[]MappedField{
+		{
+			StructFieldName: "Name",
+			JSONFieldName:   "name",
+			Validator:       Base64(8).URLEncoding(),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Content",
+			JSONFieldName:   "content",
+			Validator:       Base64(8).Decoded(),
+		},
+	},
 }
 
-func TestValidateAnotherInnerThing(t *testing.T) {
-	expected := `Validation Errors: 
-/foo: too long, may not be more than 5 characters
-/an~0int: too large, may not be larger than 10
-/happened_at: not a valid RFC 3339 time value
-/thanks: Value must be one of: ["foo","bar"]
-`
-	v := &AnotherInnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": "foozzzy", "an~int": 11, "happened_at": "hi", "thanks": "baz"}`), v)
-	require.EqualError(t, err, expected)
+var ThingWithEmbeddedJSONSchema = StructMap{
+	ThingWithEmbeddedJSON{},
+	[]MappedField{
+		{
+			StructFieldName: "Raw",
+			JSONFieldName:   "raw",
+			Validator:       EmbeddedJSON(),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Config",
+			JSONFieldName:   "config",
+			Validator:       EmbeddedJSON().Of(InnerThingTypeMap),
+			Optional:        true,
+		},
+	},
 }
 
-func TestValidateOuterThing(t *testing.T) {
-	v := &OuterThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": {"foo": "fooz"}}`), v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if v.InnerThing.Foo != "fooz" {
-		t.Fatal("Inner field Foo does not have expected value 'fooz':", v.InnerThing.Foo)
-	}
+var ThingWithLocaleSchema = StructMap{
+	ThingWithLocale{},
+	[]MappedField{
+		{
+			StructFieldName: "Country",
+			JSONFieldName:   "country",
+			Validator:       CountryCode(),
+		},
+		{
+			StructFieldName: "Currency",
+			JSONFieldName:   "currency",
+			Validator:       CurrencyCode(),
+		},
+		{
+			StructFieldName: "Language",
+			JSONFieldName:   "language",
+			Validator:       LanguageTag(),
+		},
+	},
 }
 
-func TestValidateAnotherOuterThing(t *testing.T) {
-	expected := `Validation Errors: 
-/another~1inner~1thing/foo: too long, may not be more than 5 characters
-/another~1inner~1thing/an~0int: too large, may not be larger than 10
-/another~1inner~1thing/happened_at: not a valid RFC 3339 time value
-/another~1inner~1thing/thanks: Value must be one of: ["foo","bar"]
+var ThingWithPhoneSchema = StructMap{
+	ThingWithPhone{},
+	[]MappedField{
+		{
+			StructFieldName: "Phone",
+			JSONFieldName:   "phone",
+			Validator:       PhoneE164(),
+		},
+	},
+}
+
+var ThingWithCardSchema = StructMap{
+	ThingWithCard{},
+	[]MappedField{
+		{
+			StructFieldName: "Number",
+			JSONFieldName:   "number",
+			Validator:       CardNumber().Brands(CardBrandVisa, CardBrandMastercard),
+		},
+	},
+}
+
+var ThingWithPasswordSchema = StructMap{
+	ThingWithPassword{},
+	[]MappedField{
+		{
+			StructFieldName: "Password",
+			JSONFieldName:   "password",
+			Validator:       Password(8, 3).Deny("Acme2019!"),
+		},
+	},
+}
+
+var ThingWithPriceSchema = StructMap{
+	ThingWithPrice{},
+	[]MappedField{
+		{
+			StructFieldName: "Amount",
+			JSONFieldName:   "amount",
+			Validator:       DecimalString(6, 2),
+		},
+		{
+			StructFieldName: "Discount",
+			JSONFieldName:   "discount",
+			Validator:       DecimalString(4, 4).Rat(),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithUniqueSlicesSchema = StructMap{
+	ThingWithUniqueSlices{},
+	[]MappedField{
+		{
+			StructFieldName: "Tags",
+			JSONFieldName:   "tags",
+			Contains:        SliceOfUnique(NewPrimitiveMap(String(1, 16))),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Things",
+			JSONFieldName:   "things",
+			Contains: SliceOfUnique(InnerThingTypeMap, func(elem interface{}) interface{} {
+				return elem.(*InnerThing).Foo
+			}),
+			Optional: true,
+		},
+	},
+}
+
+var ThingWithKeyedMapSchema = StructMap{
+	ThingWithKeyedMap{},
+	[]MappedField{
+		{
+			StructFieldName: "ByID",
+			JSONFieldName:   "by_id",
+			Contains:        MapOfWithKeys(UUIDString(), InnerThingTypeMap),
+		},
+	},
+}
+
+var ThingFromSloppyClientSchema = StructMap{
+	ThingFromSloppyClient{},
+	[]MappedField{
+		{
+			StructFieldName: "Count",
+			JSONFieldName:   "count",
+			Validator:       IntegerFromString(0, 100),
+		},
+		{
+			StructFieldName: "Enabled",
+			JSONFieldName:   "enabled",
+			Validator:       BooleanFromString(),
+		},
+	},
+}
+
+var ThingWithNullableSchema = StructMap{
+	ThingWithNullable{},
+	[]MappedField{
+		{
+			StructFieldName: "Nickname",
+			JSONFieldName:   "nickname",
+			Validator:       Nullable(String(1, 5)),
+		},
+	},
+}
+
+var ThingWithDefaultSchema = StructMap{
+	ThingWithDefault{},
+	[]MappedField{
+		{
+			StructFieldName: "Color",
+			JSONFieldName:   "color",
+			Validator:       WithDefault(OneOf("red", "blue"), "red"),
+		},
+	},
+}
+
+var ThingWithQuotaSchema = StructMap{
+	ThingWithQuota{},
+	[]MappedField{
+		{
+			StructFieldName: "Limit",
+			JSONFieldName:   "limit",
+			Validator:       ByteSize(1024, 1<<30),
+		},
+	},
+}
+
+var ThingWithLocationSchema = StructMap{
+	ThingWithLocation{},
+	[]MappedField{
+		{
+			StructFieldName: "Where",
+			JSONFieldName:   "where",
+			Contains:        GeoPointTypeMap,
+		},
+		{
+			StructFieldName: "Lat",
+			JSONFieldName:   "lat",
+			Validator:       Latitude().Precision(2),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithSizedIntsSchema = StructMap{
+	ThingWithSizedInts{},
+	[]MappedField{
+		{StructFieldName: "I", JSONFieldName: "i", Validator: Int(-10, 10)},
+		{StructFieldName: "I8", JSONFieldName: "i8", Validator: Int8(math.MinInt8, math.MaxInt8)},
+		{StructFieldName: "I16", JSONFieldName: "i16", Validator: Int16(math.MinInt16, math.MaxInt16)},
+		{StructFieldName: "I32", JSONFieldName: "i32", Validator: Int32(math.MinInt32, math.MaxInt32)},
+		{StructFieldName: "U", JSONFieldName: "u", Validator: Uint(0, math.MaxUint32)},
+		{StructFieldName: "U8", JSONFieldName: "u8", Validator: Uint8(0, math.MaxUint8)},
+		{StructFieldName: "U16", JSONFieldName: "u16", Validator: Uint16(0, math.MaxUint16)},
+		{StructFieldName: "U32", JSONFieldName: "u32", Validator: Uint32(0, math.MaxUint32)},
+	},
+}
+
+var UserLookupSchema = StructMap{
+	UserLookup{},
+	[]MappedField{
+		{
+			StructFieldName: "UserID",
+			JSONFieldName:   "user_id",
+			Validator:       UUIDString(),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Email",
+			JSONFieldName:   "email",
+			Validator:       String(3, 255),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Phone",
+			JSONFieldName:   "phone",
+			Validator:       PhoneE164(),
+			Optional:        true,
+		},
+	},
+}.With(MutuallyExclusive("user_id", "email", "phone"))
+
+var OuterUserLookupSchema = StructMap{
+	OuterUserLookup{},
+	[]MappedField{
+		{
+			StructFieldName: "Lookup",
+			JSONFieldName:   "lookup",
+			Contains:        UserLookupSchema,
+		},
+	},
+}
+
+var PaymentDetailsSchema = StructMap{
+	PaymentDetails{},
+	[]MappedField{
+		{
+			StructFieldName: "CardNumber",
+			JSONFieldName:   "card_number",
+			Validator:       CardNumber(),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Expiry",
+			JSONFieldName:   "expiry",
+			Validator:       String(5, 5),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "CVC",
+			JSONFieldName:   "cvc",
+			Validator:       String(3, 4),
+			Optional:        true,
+		},
+	},
+}.With(RequiredTogether("card_number", "expiry", "cvc"))
+
+var ThingWithDeprecatedColorsSchema = StructMap{
+	ThingWithDeprecatedColors{},
+	[]MappedField{
+		{
+			StructFieldName: "Color",
+			JSONFieldName:   "color",
+			Validator:       OneOf("red", "green").Deprecate("blue"),
+		},
+		{
+			StructFieldName: "Others",
+			JSONFieldName:   "others",
+			Contains:        SliceOf(NewPrimitiveMap(OneOf("red", "green").Deprecate("blue"))),
+			Optional:        true,
+		},
+	},
+}
+
+var CredentialsSchema = StructMap{
+	Credentials{},
+	[]MappedField{
+		{
+			StructFieldName: "Username",
+			JSONFieldName:   "username",
+			Validator:       String(1, 8),
+		},
+		{
+			StructFieldName: "Password",
+			JSONFieldName:   "password",
+			Validator:       String(1, 8),
+			Sensitive:       true,
+		},
+	},
+}
+
+var ThingWithCountersSchema = StructMap{
+	ThingWithCounters{},
+	[]MappedField{
+		{
+			StructFieldName: "ID",
+			JSONFieldName:   "id",
+			Validator:       Integer(math.MinInt64, math.MaxInt64),
+		},
+		{
+			StructFieldName: "Count",
+			JSONFieldName:   "count",
+			Validator:       LossyUint64(),
+		},
+		{
+			StructFieldName: "Extra",
+			JSONFieldName:   "extra",
+			Contains:        MapOf(NewPrimitiveMap(Interface())),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithOrderedMapSchema = StructMap{
+	ThingWithOrderedMap{},
+	[]MappedField{
+		{
+			StructFieldName: "Attributes",
+			JSONFieldName:   "attributes",
+			Contains:        MapOfOrdered(NewPrimitiveMap(String(0, 16)), KeyOrder("id", "name")),
+		},
+	},
+}
+
+var ThingWithLegacyTimeSchema = StructMap{
+	ThingWithLegacyTime{},
+	[]MappedField{
+		{
+			StructFieldName: "CreatedAt",
+			JSONFieldName:   "created_at",
+			Contains:        TimeWithLayout("2006-01-02 15:04:05", time.RFC3339),
+		},
+	},
+}
+
+var ThingWithTimestampsSchema = StructMap{
+	ThingWithTimestamps{},
+	[]MappedField{
+		{
+			StructFieldName: "Created",
+			JSONFieldName:   "created",
+			Contains:        UnixTime(),
+		},
+		{
+			StructFieldName: "Updated",
+			JSONFieldName:   "updated",
+			Contains:        UnixMilliTime(),
+		},
+	},
+}
+
+var ThingWithIntervalsSchema = StructMap{
+	ThingWithIntervals{},
+	[]MappedField{
+		{
+			StructFieldName: "Interval",
+			JSONFieldName:   "interval",
+			Contains:        DurationNanoseconds(0, time.Minute),
+		},
+		{
+			StructFieldName: "Delay",
+			JSONFieldName:   "delay_ms",
+			Contains:        Duration(0, time.Hour).InUnits(time.Millisecond),
+		},
+	},
+}
+
+var ThingWithBlobSchema = StructMap{
+	ThingWithBlob{},
+	[]MappedField{
+		{
+			StructFieldName: "Blob",
+			JSONFieldName:   "blob",
+			Contains:        Bytes(4),
+		},
+		{
+			StructFieldName: "Token",
+			JSONFieldName:   "token",
+			Contains:        Bytes(16).URLEncoding(),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithBigNumbersSchema = StructMap{
+	ThingWithBigNumbers{},
+	[]MappedField{
+		{
+			StructFieldName: "Balance",
+			JSONFieldName:   "balance",
+			Contains:        BigInt().Min(big.NewInt(0)),
+		},
+		{
+			StructFieldName: "Supply",
+			JSONFieldName:   "supply",
+			Contains:        BigInt().AsNumber(),
+		},
+		{
+			StructFieldName: "Ratio",
+			JSONFieldName:   "ratio",
+			Contains:        BigFloat(128),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithBoundingBoxSchema = StructMap{
+	ThingWithBoundingBox{},
+	[]MappedField{
+		{
+			StructFieldName: "Box",
+			JSONFieldName:   "box",
+			Contains:        SliceOf(NewPrimitiveMap(Longitude())),
+		},
+	},
+}
+
+var ThingWithTuplesSchema = StructMap{
+	ThingWithTuples{},
+	[]MappedField{
+		{
+			StructFieldName: "Location",
+			JSONFieldName:   "location",
+			Contains:        Tuple(NewPrimitiveMap(Latitude()), NewPrimitiveMap(Longitude())),
+		},
+		{
+			StructFieldName: "Top",
+			JSONFieldName:   "top",
+			Contains:        SliceOf(Tuple(NewPrimitiveMap(String(1, 16)), NewPrimitiveMap(Integer(0, 100)))),
+		},
+	},
+}
+
+var ThingWithTagsSchema = StructMap{
+	ThingWithTags{},
+	[]MappedField{
+		{
+			StructFieldName: "Tags",
+			JSONFieldName:   "tags",
+			Contains:        SetOf(NewPrimitiveMap(String(1, 16))),
+		},
+		{
+			StructFieldName: "Ratings",
+			JSONFieldName:   "ratings",
+			Contains:        SetOf(NewPrimitiveMap(Integer(0, 5))).RejectDuplicates(),
+		},
+		{
+			StructFieldName: "Users",
+			JSONFieldName:   "users",
+			Contains: SetOf(InnerThingTypeMap).SortedBy(func(a, b interface{}) bool {
+				return a.(InnerThing).AnInt < b.(InnerThing).AnInt
+			}),
+			Optional: true,
+		},
+	},
+}
+
+var ThingWithNestedContainersSchema = StructMap{
+	ThingWithNestedContainers{},
+	[]MappedField{
+		{
+			StructFieldName: "Groups",
+			JSONFieldName:   "groups",
+			Contains:        MapOf(SliceOf(InnerThingTypeMap)),
+		},
+		{
+			StructFieldName: "Labels",
+			JSONFieldName:   "labels",
+			Contains:        SliceOf(MapOf(NewPrimitiveMap(String(1, 8)))),
+		},
+		{
+			StructFieldName: "Pointers",
+			JSONFieldName:   "pointers",
+			Contains:        SliceOf(InnerThingTypeMap),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Counts",
+			JSONFieldName:   "counts",
+			Contains:        MapOf(MapOf(NewPrimitiveMap(Integer(0, 5)))),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithNilPoliciesSchema = StructMap{
+	ThingWithNilPolicies{},
+	[]MappedField{
+		{
+			StructFieldName: "Tags",
+			JSONFieldName:   "tags",
+			Contains:        SliceOf(NewPrimitiveMap(String(1, 8))),
+			NilPolicy:       NilAsEmpty,
+		},
+		{
+			StructFieldName: "Meta",
+			JSONFieldName:   "meta",
+			Contains:        MapOf(NewPrimitiveMap(String(1, 8))),
+			NilPolicy:       NilOmitted,
+		},
+		{
+			StructFieldName: "Inner",
+			JSONFieldName:   "inner",
+			Contains:        InnerThingTypeMap,
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithColorsSchema = StructMap{
+	ThingWithColors{},
+	[]MappedField{
+		{
+			StructFieldName: "Color",
+			JSONFieldName:   "color",
+			Contains:        Custom(String(7, 7)),
+		},
+		{
+			StructFieldName: "Accent",
+			JSONFieldName:   "accent",
+			Contains:        Custom(nil),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithStringIDsSchema = StructMap{
+	ThingWithStringIDs{},
+	[]MappedField{
+		{
+			StructFieldName: "ID",
+			JSONFieldName:   "id",
+			Contains:        StringEncoded(Integer(1, math.MaxInt64)),
+		},
+		{
+			StructFieldName: "Enabled",
+			JSONFieldName:   "enabled",
+			Contains:        StringEncoded(Boolean()),
+		},
+	},
+}
+
+var ThingWithKeyedMapsSchema = StructMap{
+	ThingWithKeyedMaps{},
+	[]MappedField{
+		{
+			StructFieldName: "Heights",
+			JSONFieldName:   "heights",
+			Contains:        MapOf(NewPrimitiveMap(Integer(0, 100))),
+		},
+		{
+			StructFieldName: "Names",
+			JSONFieldName:   "names",
+			Contains:        MapOfOrdered(NewPrimitiveMap(String(1, 12)), KeyOrder("west", "east")),
+		},
+	},
+}
+
+var ThingWithDynamicPayloadSchema = StructMap{
+	ThingWithDynamicPayload{},
+	[]MappedField{
+		{
+			StructFieldName: "Payload",
+			JSONFieldName:   "payload",
+			Contains:        Dynamic(),
+			ReadOnly:        true,
+		},
+		{
+			StructFieldName: "Tagged",
+			JSONFieldName:   "tagged",
+			Contains: Dynamic().Tagged("type", map[string]interface{}{
+				"inner": InnerThing{},
+				"outer": OuterThing{},
+			}),
+			Optional: true,
+		},
+	},
+}
+
+var ThingWithCheckedItemsSchema = StructMap{
+	ThingWithCheckedItems{},
+	[]MappedField{
+		{
+			StructFieldName: "Items",
+			JSONFieldName:   "items",
+			Contains:        SliceOf(InnerThingTypeMap),
+			Validator:       nonEmptyListValidator{},
+		},
+	},
+}
+
+var ThingWithNarrowNumbersSchema = StructMap{
+	ThingWithNarrowNumbers{},
+	[]MappedField{
+		{
+			StructFieldName: "Counts",
+			JSONFieldName:   "counts",
+			Contains:        SliceOf(NewPrimitiveMap(Integer(0, math.MaxInt64))),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Levels",
+			JSONFieldName:   "levels",
+			Contains:        MapOf(NewPrimitiveMap(Integer(-1000, 1000))),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Latitudes",
+			JSONFieldName:   "latitudes",
+			Contains:        SliceOf(NewPrimitiveMap(Latitude())),
+			Optional:        true,
+		},
+		{
+			StructFieldName: "Regions",
+			JSONFieldName:   "regions",
+			Contains:        SliceOf(NewPrimitiveMap(String(1, 12))),
+			Optional:        true,
+		},
+	},
+}
+
+var VersionedThingSchema = StructMap{
+	VersionedThing{},
+	[]MappedField{
+		{
+			StructFieldName: "Body",
+			JSONFieldName:   "body",
+			Contains: ContextType(func(ctx Context) string {
+				version, _ := ctx.(string)
+				return version
+			}, map[string]TypeMap{
+				"v1": InnerThingTypeMap,
+				"v2": OtherInnerThingTypeMap,
+			}),
+		},
+	},
+}
+
+var DogSchema = StructMap{
+	Dog{},
+	[]MappedField{
+		{
+			StructFieldName: "Barks",
+			JSONFieldName:   "barks",
+			Validator:       Boolean(),
+		},
+	},
+}
+
+var CatSchema = StructMap{
+	Cat{},
+	[]MappedField{
+		{
+			StructFieldName: "Kind",
+			JSONFieldName:   "type",
+			Validator:       String(1, 20),
+		},
+		{
+			StructFieldName: "Lives",
+			JSONFieldName:   "lives",
+			Validator:       Integer(0, 9),
+		},
+	},
+}
+
+var ThingWithPetSchema = StructMap{
+	ThingWithPet{},
+	[]MappedField{
+		{
+			StructFieldName: "Pet",
+			JSONFieldName:   "pet",
+			Contains: InlineType("type", map[string]TypeMap{
+				"dog": DogSchema,
+				"cat": CatSchema,
+			}),
+		},
+	},
+}
+
+var ThingWithUntaggedPetSchema = StructMap{
+	ThingWithUntaggedPet{},
+	[]MappedField{
+		{
+			StructFieldName: "Pet",
+			JSONFieldName:   "pet",
+			Contains:        OneOfTypes(DogSchema, CatSchema),
+		},
+	},
+}
+
+var ClassifiedThingSchema = StructMap{
+	ClassifiedThing{},
+	[]MappedField{
+		{
+			StructFieldName: "Value",
+			JSONFieldName:   "value",
+			Contains: VariableType("Category", map[string]TypeMap{
+				"animal": VariableType("Subcategory", map[string]TypeMap{
+					"dog": DogSchema,
+					"cat": CatSchema,
+				}),
+				"other": InnerThingTypeMap,
+			}),
+		},
+		{
+			StructFieldName: "Category",
+			JSONFieldName:   "category",
+			Validator:       String(1, 20),
+		},
+		{
+			StructFieldName: "Subcategory",
+			JSONFieldName:   "subcategory",
+			Validator:       String(1, 20),
+			Optional:        true,
+		},
+	},
+}
+
+var ThingWithPetsSchema = StructMap{
+	ThingWithPets{},
+	[]MappedField{
+		{
+			StructFieldName: "Pets",
+			JSONFieldName:   "pets",
+			Contains: SliceOf(VariableType("type", map[string]TypeMap{
+				"dog": DogSchema,
+				"cat": CatSchema,
+			})),
+		},
+	},
+}
+
+var ThingWithEnumerableInterfaceSchema = StructMap{
+	ThingWithEnumerableInterface{},
+	[]MappedField{
+		{
+			StructFieldName: "ThanksGo",
+			JSONFieldName:   "thanks",
+			Validator:       OneOf("foo", "bar"),
+		},
+	},
+}
+
+var TestTypeMapper = NewTypeMapper(
+	InnerThingTypeMap,
+	AnotherInnerThingTypeMap,
+	OuterThingTypeMap,
+	AnotherOuterThingTypeMap,
+	OuterPointerThingTypeMap,
+	OuterInterfaceThingTypeMap,
+	OuterSliceThingTypeMap,
+	ContainsMaxSliceSizeTypeMap,
+	ContainsMinSliceSizeTypeMap,
+	ContainsRangeSliceSizeTypeMap,
+	OuterPointerSliceThingTypeMap,
+	OuterPointerToSliceThingTypeMap,
+	OuterVariableThingTypeMap,
+	OuterVariableThingWithOneOfInnerTypeMap,
+	OuterVariableThingWithInnerTypeNoJsonTagTypeMap,
+	OuterVariableThingWithInnerTypeIgnoredJsonTagTypeMap,
+	BrokenOuterVariableThingTypeMap,
+	ReadOnlyThingTypeMap,
+	TypoedThingTypeMap,
+	BrokenThingTypeMap,
+	TemplatableThingTypeMap,
+	InnerNonMarshalableThingTypeMap,
+	OuterNonMarshalableThingTypeMap,
+	ThingWithSliceOfPrimitivesTypeMap,
+	ThingWithInnerMapTypeMap,
+	ThingWithMapOfInterfacesTypeMap,
+	ThingWithMapOfStringsTypeMap,
+	ThingWithTimeSchema,
+	ThingWithScheduleSchema,
+	ThingWithTimeoutSchema,
+	ThingWithAttachmentSchema,
+	ThingWithEmbeddedJSONSchema,
+	ThingWithLocaleSchema,
+	ThingWithPhoneSchema,
+	ThingWithCardSchema,
+	ThingWithPasswordSchema,
+	ThingWithPriceSchema,
+	ThingWithUniqueSlicesSchema,
+	ThingWithKeyedMapSchema,
+	ThingFromSloppyClientSchema,
+	ThingWithNullableSchema,
+	ThingWithDefaultSchema,
+	ThingWithQuotaSchema,
+	ThingWithLocationSchema,
+	ThingWithSizedIntsSchema,
+	UserLookupSchema,
+	OuterUserLookupSchema,
+	PaymentDetailsSchema,
+	ThingWithDeprecatedColorsSchema,
+	CredentialsSchema,
+	ThingWithCountersSchema,
+	ThingWithOrderedMapSchema,
+	ThingWithLegacyTimeSchema,
+	ThingWithTimestampsSchema,
+	ThingWithIntervalsSchema,
+	ThingWithBlobSchema,
+	ThingWithBigNumbersSchema,
+	ThingWithBoundingBoxSchema,
+	ThingWithTuplesSchema,
+	ThingWithTagsSchema,
+	ThingWithNestedContainersSchema,
+	ThingWithNilPoliciesSchema,
+	ThingWithColorsSchema,
+	ThingWithStringIDsSchema,
+	ThingWithKeyedMapsSchema,
+	ThingWithDynamicPayloadSchema,
+	ThingWithCheckedItemsSchema,
+	ThingWithNarrowNumbersSchema,
+	ThingWithEnumerableInterfaceSchema,
+	MapOfInnerThingTypeMap,
+	Outer2DSliceThingTypeMap,
+)
+
+func TestValidateInnerThing(t *testing.T) {
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": "fooz", "an_int": 10, "a_bool": true}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Foo != "fooz" {
+		t.Fatal("Field Foo does not have expected value 'fooz':", v.Foo)
+	}
+}
+
+func TestValidateAnotherInnerThing(t *testing.T) {
+	expected := `Validation Errors: 
+/an~0int: too large, may not be larger than 10
+/foo: too long, may not be more than 5 characters
+/happened_at: not a valid RFC 3339 time value
+/thanks: Value must be one of: ["foo","bar"]
+`
+	v := &AnotherInnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": "foozzzy", "an~int": 11, "happened_at": "hi", "thanks": "baz"}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterThing(t *testing.T) {
+	v := &OuterThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": {"foo": "fooz"}}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.InnerThing.Foo != "fooz" {
+		t.Fatal("Inner field Foo does not have expected value 'fooz':", v.InnerThing.Foo)
+	}
+}
+
+func TestValidateAnotherOuterThing(t *testing.T) {
+	expected := `Validation Errors: 
+/another~1inner~1thing/an~0int: too large, may not be larger than 10
+/another~1inner~1thing/foo: too long, may not be more than 5 characters
+/another~1inner~1thing/happened_at: not a valid RFC 3339 time value
+/another~1inner~1thing/thanks: Value must be one of: ["foo","bar"]
+`
+
+	v := &AnotherOuterThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"another/inner/thing": {"foo": "foozzzy", "an~int": 11, "happened_at": "hi", "thanks": "baz"}}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterSliceThing(t *testing.T) {
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}]}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.InnerThings) != 1 {
+		t.Fatal("InnerThings should contain 1 element, instead contains", len(v.InnerThings))
+	}
+	if v.InnerThings[0].Foo != "fooz" {
+		t.Fatal("InnerThing field Foo does not have expected value 'fooz':", v.InnerThings[0].Foo)
+	}
+}
+
+func TestValidateOuterSliceThingInvalidElement(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things/0/foo: too long, may not be more than 12 characters
+`
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooziswaytoolooong"}]}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterSliceThingMultipleInvalidElements(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things/0/foo: too long, may not be more than 12 characters
+/inner_things/1/foo: too long, may not be more than 12 characters
+`
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooziswaytoolooong"}, {"foo": "fooziswaytoolooong2"}]}`), v)
+	require.EqualError(t, err, expected)
+}
+func TestValidateOuter2DSliceThing(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things/0/1/foo: too long, may not be more than 12 characters
+/inner_things/1/0/foo: too long, may not be more than 12 characters
+/inner_things/1/1/foo: too long, may not be more than 12 characters
+`
+	v := &Outer2DSliceThing{}
+	original := `{"inner_things": [[{"foo": "fooz"}, {"foo": "fooziswaytoolooong2"}], [{"foo": "fooziswaytoolooong"},{"foo": "fooziswaytoolooongagain"}]]}`
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterSliceThingNotAList(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things: expected a list
+`
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": "foo"}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterSliceThingOverMax(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things: must have at most 2 elements
+`
+	v := &OuterMaxSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}, {"foo": "fooz3"}]}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterSliceThingUnderMax(t *testing.T) {
+	v := &OuterMaxSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}]}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateOuterSliceThingUnderMin(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things: must have at least 2 elements
+`
+	v := &OuterMinSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}]}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterSliceThingOverMin(t *testing.T) {
+	v := &OuterMinSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}]}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateOuterRangeSliceThingUnderMin(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things: must have between 1 and 2 elements
+`
+	v := &OuterRangeSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": []}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterRangeSliceThingOverMax(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_things: must have between 1 and 2 elements
+`
+	v := &OuterRangeSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}, {"foo": "fooz3"}]}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateOuterRangeSliceThingInRange(t *testing.T) {
+	v := &OuterRangeSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}]}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateReadOnlyThing(t *testing.T) {
+	v := &ReadOnlyThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"primary_key": "foo"}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.PrimaryKey != "" {
+		t.Fatal("ReadOnly field unexpectedly set")
+	}
+}
+
+func TestValidateReadOnlyThingValueNotProvided(t *testing.T) {
+	v := &ReadOnlyThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.PrimaryKey != "" {
+		t.Fatal("ReadOnly field unexpectedly set")
+	}
+}
+
+func TestValidateUnregisteredThing(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("No panic")
+		}
+	}()
+	v := &UnregisteredThing{}
+	TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
+	t.Fatal("Unexpected success")
+}
+
+func TestValidateStringTypeMismatch(t *testing.T) {
+	expected := `Validation Errors: 
+/foo: not a string
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": 12.0}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateStringTooShort(t *testing.T) {
+	expected := `Validation Errors: 
+/foo: too short, must be at least 1 characters
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": ""}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateStringTooLong(t *testing.T) {
+	expected := `Validation Errors: 
+/foo: too long, may not be more than 12 characters
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": "thisvalueistoolong"}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateBooleanTypeMismatch(t *testing.T) {
+	expected := `Validation Errors: 
+/a_bool: not a boolean
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"a_bool": 12.0}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateIntegerTypeMismatch(t *testing.T) {
+	expected := `Validation Errors: 
+/an_int: not an integer
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": false}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateIntegerNumericTypeMismatch(t *testing.T) {
+	expected := `Validation Errors: 
+/an_int: not an integer
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": 12.1}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateIntegerTooSmall(t *testing.T) {
+	expected := `Validation Errors: 
+/an_int: too small, must be at least 0
+`
+
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": -1}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateIntegerTooLarge(t *testing.T) {
+	expected := `Validation Errors: 
+/an_int: too large, may not be larger than 10
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": 2048}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateMultipleTypeMismatch(t *testing.T) {
+	expected := `Validation Errors: 
+/a_bool: not a boolean
+/an_int: too large, may not be larger than 10
+`
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": 2048, "a_bool": 12.0}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateMapOfInnerThing(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_thing_map/key1/a_bool: not a boolean
+/inner_thing_map/key1/an_int: too large, may not be larger than 10
+/inner_thing_map/key2/a_bool: not a boolean
+/inner_thing_map/key2/an_int: too large, may not be larger than 10
+`
+	// Map entries are reported in key order, regardless of their order in the
+	// input or Go's map iteration order
+	for i := 0; i < 10; i++ {
+		v := &OuterInnerThingMap{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing_map":{"key2":{"an_int": 2048, "a_bool": 12.0}, "key1":{"an_int": 2048, "a_bool": 12.0}}}`), v)
+		require.EqualError(t, err, expected)
+	}
+}
+
+func TestErrorsSortedByPath(t *testing.T) {
+	err := &ValidationError{}
+	err.AddError(AppendPath(NewValidationErrorWithField("foo", "third"), "10"))
+	err.AddError(AppendPath(NewValidationErrorWithField("foo", "second"), "2"))
+	err.AddError(NewValidationErrorWithField("a/b", "first"))
+	err.AddError(NewValidationError("whole object"))
+	err.AddError(AppendPath(NewValidationErrorWithField("foo", "also second"), "2"))
+	err.AddError(NewValidationErrorWithField("2", "before its fields"))
+
+	require.EqualError(t, err.Flatten(), `Validation Errors: 
+: whole object
+/2: before its fields
+/2/foo: second
+/2/foo: also second
+/10/foo: third
+/a~1b: first
+`)
+}
+
+func TestValidateMapOfInnerThingFirstEntryValid(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_thing_map/key2/a_bool: not a boolean
+/inner_thing_map/key2/an_int: too large, may not be larger than 10
+`
+	v := &OuterInnerThingMap{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing_map":{"key1":{"an_int": 5, "a_bool": true}, "key2":{"an_int": 2048, "a_bool": 12.0}}}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateWithUnexpectedError(t *testing.T) {
+	expected := `Validation Errors: 
+/invalid: this should be a ValidationError
+`
+	v := &BrokenThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"invalid": "definitely"}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateThingWithMapOfStrings(t *testing.T) {
+	expected := `Validation Errors: 
+/strings/key1: too long, may not be more than 5 characters
+`
+	original := `{"strings":{"key1":"tooooooolongomg"}}`
+	v := &ThingWithMapOfStrings{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestUnmarshalVariableTypeThing(t *testing.T) {
+	{
+		v := &OuterVariableThing{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"foo","inner_thing":{"foo":"bar"}}`), v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.InnerType != "foo" {
+			t.Fatal("Unexpected value of InnerType:", v.InnerType)
+		}
+		it, ok := v.InnerValue.(*InnerThing)
+		if !ok {
+			t.Fatal("InnerValue has the wrong type:", reflect.TypeOf(v.InnerValue).String())
+		}
+		if it.Foo != "bar" {
+			t.Fatal("Unexpected value of InnerThing.Foo:", it.Foo)
+		}
+	}
+	{
+		v := &OuterVariableThing{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"bar","inner_thing":{"bar":"foo"}}`), v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.InnerType != "bar" {
+			t.Fatal("Unexpected value of InnerType:", v.InnerType)
+		}
+		it, ok := v.InnerValue.(*OtherInnerThing)
+		if !ok {
+			t.Fatal("InnerValue has the wrong type:", reflect.TypeOf(v.InnerValue).String())
+		}
+		if it.Bar != "foo" {
+			t.Fatal("Unexpected value of InnerThing.Foo:", it.Bar)
+		}
+	}
+}
+
+func TestValidateVariableTypeThing(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_thing: invalid type identifier: 'unknown', must be one of: bar, foo
+`
+	v := &OuterVariableThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	require.EqualError(t, err, expected)
+	require.Equal(t, []string{"bar", "foo"}, err.(*MultiValidationError).Errors()[0].Params["allowed"])
+}
+
+func TestValidateVariableTypeWithSwitchFieldValidationError(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_thing: cannot validate, invalid input for 'inner_type'
+/inner_type: Value must be one of: ["these","are","allowed"]
+`
+	v := &OuterVariableThingInnerTypeOneOf{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateVariableTypeSwitchFieldNoJsonTag(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_thing: invalid type identifier
+/inner_type: Value must be one of: ["these","are","allowed"]
+`
+	v := &OuterVariableThingInnerTypeNoJsonTag{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateVariableTypeSwitchFieldIgnoredJsonTag(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_thing: invalid type identifier
+/inner_type: Value must be one of: ["these","are","allowed"]
+`
+	v := &OuterVariableThingInnerTypeIgnoredJsonTag{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestValidateNotAnObject(t *testing.T) {
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`[1, 2, 3]`), v)
+	require.EqualError(t, err, "json: cannot unmarshal, not an object")
+}
+
+func TestUnmarshalList(t *testing.T) {
+	v := &InnerThing{}
+	err := InnerThingTypeMap.Unmarshal(EmptyContext, nil, []interface{}{}, reflect.ValueOf(v))
+	if err == nil {
+		t.Fatal("Unexpected success")
+	}
+	if err.Error() != "expected an object" {
+		t.Fatal("Unexpected error message:", err.Error())
+	}
+}
+
+func TestUnmarshalMissingRequiredField(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_thing: missing required field
+`
+	v := &OuterThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestUnmarshalNonPointer(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("No panic")
+		}
+		if r != "cannot unmarshal to non-pointer" {
+			t.Fatal("Incorrect panic message", r)
+		}
+	}()
+	v := InnerThing{}
+	TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
+}
+
+func TestMarshalInnerThing(t *testing.T) {
+	v := &InnerThing{
+		Foo:   "bar",
+		AnInt: 7,
+		ABool: true,
+	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"foo":"bar","an_int":7,"a_bool":true}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestMarshalOuterThing(t *testing.T) {
+	v := &OuterThing{
+		InnerThing: InnerThing{
+			Foo:   "bar",
+			AnInt: 3,
+			ABool: false,
+		},
+	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_thing":{"foo":"bar","an_int":3,"a_bool":false}}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestMarshalOuterPointerThing(t *testing.T) {
+	v := &OuterPointerThing{
+		InnerThing: &InnerThing{
+			Foo:   "bar",
+			AnInt: 3,
+			ABool: false,
+		},
+	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_thing":{"foo":"bar","an_int":3,"a_bool":false}}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestUnmarshalOuterPointerThingWithNull(t *testing.T) {
+	v := &OuterPointerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": null}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.InnerThing != nil {
+		t.Fatal("Expected InnerThing to be nil")
+	}
+}
+
+func TestMarshalOuterInterfaceThing(t *testing.T) {
+	v := &OuterInterfaceThing{
+		InnerThing: &InnerThing{
+			Foo:   "bar",
+			AnInt: 3,
+			ABool: false,
+		},
+	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_thing":{"foo":"bar","an_int":3,"a_bool":false}}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestUnmarshalOuterInterfaceThing(t *testing.T) {
+	v := &OuterInterfaceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": {"foo":"bar","an_int":3,"a_bool":false}}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	innerThing, ok := v.InnerThing.(*InnerThing)
+	if !ok {
+		t.Fatal("InnerThing has an unexpected type")
+	}
+
+	if innerThing.Foo != "bar" {
+		t.Fatal("InnerThing.Bar has an unexpected value")
+	}
+
+	if innerThing.AnInt != 3 {
+		t.Fatal("InnerThing.AnInt has an unexpected value")
+	}
+
+	if innerThing.ABool != false {
+		t.Fatal("InnerThing.ABool has an unexpected value")
+	}
+}
+
+func TestUnmarshalOuterInterfaceThingWithNull(t *testing.T) {
+	v := &OuterInterfaceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": null}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.InnerThing != nil {
+		t.Fatal("Expected InnerThing to be nil")
+	}
+}
+
+func TestMarshalOuterSliceThing(t *testing.T) {
+	v := &OuterSliceThing{
+		InnerThings: []InnerThing{
+			{
+				Foo:   "bar",
+				AnInt: 3,
+				ABool: false,
+			},
+		},
+	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_things":[{"foo":"bar","an_int":3,"a_bool":false}]}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+
+}
+
+func TestMarshalOuterPointerSliceThing(t *testing.T) {
+	v := &OuterPointerSliceThing{
+		InnerThings: []*InnerThing{
+			{
+				Foo:   "bar",
+				AnInt: 3,
+				ABool: false,
+			},
+		},
+	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_things":[{"foo":"bar","an_int":3,"a_bool":false}]}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestMarshalOuterPointerToSliceThing(t *testing.T) {
+	v := &OuterPointerToSliceThing{
+		InnerThings: &[]InnerThing{
+			{
+				Foo:   "bar",
+				AnInt: 3,
+				ABool: false,
+			},
+		},
+	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_things":[{"foo":"bar","an_int":3,"a_bool":false}]}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestMarshalVariableTypeThing(t *testing.T) {
+	{
+		v := &OuterVariableThing{
+			InnerType: "foo",
+			InnerValue: &InnerThing{
+				Foo: "test",
+			},
+		}
+
+		data, err := TestTypeMapper.Marshal(EmptyContext, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"inner_type":"foo","inner_thing":{"foo":"test","an_int":0,"a_bool":false}}` {
+			t.Fatal("Unexpected Marshal output:", string(data))
+		}
+	}
+	{
+		v := &OuterVariableThing{
+			InnerType: "bar",
+			InnerValue: &OtherInnerThing{
+				Bar: "test",
+			},
+		}
+
+		data, err := TestTypeMapper.Marshal(EmptyContext, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"inner_type":"bar","inner_thing":{"bar":"test"}}` {
+			t.Fatal("Unexpected Marshal output:", string(data))
+		}
+	}
+}
+
+func TestMarshalVariableTypeThingIntegerInvalid(t *testing.T) {
+	v := &OuterVariableThingInnerTypeOneOf{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"these","inner_thing":15}`), v)
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_type":"these","inner_thing":null}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestMarshalVariableTypeThingIntegerValid(t *testing.T) {
+	v := &OuterVariableThingInnerTypeOneOf{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"these","inner_thing":5}`), v)
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_type":"these","inner_thing":5}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestMarshalVariableTypeThingIntegerValidZeroCase(t *testing.T) {
+	v := &OuterVariableThingInnerTypeOneOf{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"these","inner_thing":0}`), v)
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"inner_type":"these","inner_thing":0}` {
+		t.Fatal("Unexpected Marshal output:", string(data))
+	}
+}
+
+func TestMarshalBrokenVariableTypeThing(t *testing.T) {
+	v := &OtherOuterVariableThing{
+		InnerType: "foo",
+		InnerValue: &InnerThing{
+			Foo: "test",
+		},
+	}
+
+	_, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.EqualError(t, err, "no such underlying field: InnerTypeo")
+	require.IsType(t, &SchemaError{}, err)
+}
+
+func TestMarshalVariableTypeThingInvalidTypeIdentifier(t *testing.T) {
+	v := &OuterVariableThing{
+		InnerType: "wrong",
+		InnerValue: &InnerThing{
+			Foo: "test",
+		},
+	}
+
+	_, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.EqualError(t, err, "variable type serialization error: invalid type identifier: 'wrong', must be one of: bar, foo")
+
+	_, err = TestTypeMapper.Marshal(EmptyContext, &OuterVariableThing{InnerValue: &Dog{}})
+	require.EqualError(t, err, "variable type serialization error: invalid type identifier")
+}
+
+func TestMarshalNoSuchStructField(t *testing.T) {
+	v := &TypoedThing{
+		Correct: false,
+	}
+	_, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.EqualError(t, err, "no such underlying field: Incorrect")
+}
+
+func TestUnmarshalNoSuchStructField(t *testing.T) {
+	v := &TypoedThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"correct": false}`), v)
+	require.EqualError(t, err, "no such underlying field: Incorrect")
+	require.IsType(t, &SchemaError{}, err)
+}
+
+func TestCheckSchema(t *testing.T) {
+	require.Empty(t, OuterThingTypeMap.CheckSchema())
+	require.Empty(t, OuterVariableThingTypeMap.CheckSchema())
+	require.Empty(t, MapOfInnerThingTypeMap.CheckSchema())
+	require.Empty(t, UserLookupSchema.CheckSchema())
+
+	errs := TypoedThingTypeMap.CheckSchema()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "jsonmap.TypoedThing: no such underlying field: Incorrect")
+
+	errs = BrokenOuterVariableThingTypeMap.CheckSchema()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "jsonmap.OtherOuterVariableThing: no such underlying field: InnerTypeo")
+
+	broken := StructMap{
+		OuterThing{},
+		[]MappedField{
+			{
+				StructFieldName: "InnerThing",
+				JSONFieldName:   "inner_thing",
+			},
+		},
+	}
+	errs = broken.CheckSchema()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "jsonmap.OuterThing: Field must have Contains or Validator: inner_thing")
+
+	mismatched := StructMap{
+		OuterThing{},
+		[]MappedField{
+			{
+				StructFieldName: "InnerThing",
+				JSONFieldName:   "inner_thing",
+				Contains:        Time(),
+			},
+		},
+	}
+	errs = mismatched.CheckSchema()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "target field for jsonmap.Time() is not a time.Time")
+
+	errs = TestTypeMapper.CheckSchema()
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	require.Equal(t, []string{
+		"jsonmap.InnerNonMarshalableThing: Field must have Contains or Validator: oops",
+		"jsonmap.OtherOuterVariableThing: no such underlying field: InnerTypeo",
+		"jsonmap.TypoedThing: no such underlying field: Incorrect",
+	}, msgs)
+}
+
+func TestUnmarshalInvalidJSON(t *testing.T) {
+	v := &InnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"this is": "definitely invalid JSON]`), v)
+	if err == nil {
+		t.Fatal("Unexpected success")
+	}
+	if err.Error() != "unexpected end of JSON input (line 1, column 37)" {
+		t.Fatal("Unexpected error message:", err.Error())
+	}
+
+	se, ok := err.(*SyntaxError)
+	require.True(t, ok)
+	require.Equal(t, int64(37), se.Offset)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": tru}`), v)
+	require.IsType(t, &SyntaxError{}, err)
+	require.Equal(t, int64(12), err.(*SyntaxError).Offset)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte("{\n  \"foo\": \"bär\",\n  \"bar\": \"ö\" \"oops\"\n}"), v)
+	require.EqualError(t, err, "invalid character '\"' after object key:value pair (line 3, column 14)")
+	se = err.(*SyntaxError)
+	require.Equal(t, 3, se.Line)
+	require.Equal(t, 14, se.Column)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`[]`), v)
+	require.IsType(t, &ValidationError{}, err)
+}
+
+func TestMarshalNonMarshalableThing(t *testing.T) {
+	v := &OuterNonMarshalableThing{}
+	_, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err == nil {
+		t.Fatal("Unexpected success")
+	}
+	if err.Error() != "json: error calling MarshalJSON for type jsonmap.NonMarshalableType: oops" {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestMarshalSliceOfNonMarshalableThing(t *testing.T) {
+	v := []OuterNonMarshalableThing{
+		{},
+	}
+	_, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err == nil {
+		t.Fatal("Unexpected success")
+	}
+	if err.Error() != "json: error calling MarshalJSON for type jsonmap.NonMarshalableType: oops" {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestMarshalIndent(t *testing.T) {
+	v := &OuterThing{
+		InnerThing: InnerThing{
+			Foo:   "bar",
+			AnInt: 3,
+			ABool: false,
+		},
+	}
+	expected := "{\n" +
+		"    \"inner_thing\": {\n" +
+		"        \"foo\": \"bar\",\n" +
+		"        \"an_int\": 3,\n" +
+		"        \"a_bool\": false\n" +
+		"    }\n" +
+		"}"
+	data, err := TestTypeMapper.MarshalIndent(EmptyContext, v, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	}
+}
+
+func TestMarshalSlice(t *testing.T) {
+	v := []InnerThing{
+		{
+			Foo:   "bar",
+			AnInt: 3,
+			ABool: false,
+		},
+		{
+			Foo:   "bam",
+			AnInt: 4,
+			ABool: true,
+		},
+	}
+	expected := `[{"foo":"bar","an_int":3,"a_bool":false},{"foo":"bam","an_int":4,"a_bool":true}]`
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	}
+}
+
+func TestMarshalSliceOfPointers(t *testing.T) {
+	v := []*InnerThing{
+		&InnerThing{
+			Foo:   "bar",
+			AnInt: 3,
+			ABool: false,
+		},
+		&InnerThing{
+			Foo:   "bam",
+			AnInt: 4,
+			ABool: true,
+		},
+	}
+	expected := `[{"foo":"bar","an_int":3,"a_bool":false},{"foo":"bam","an_int":4,"a_bool":true}]`
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	}
+}
+
+func TestMarshalTemplatableThing(t *testing.T) {
+	ctx := struct {
+		Foo string
+	}{
+		Foo: "foo",
+	}
+
+	v := &TemplatableThing{
+		SomeField: "bar",
+	}
+
+	expected := `{"some_field":"foo:bar"}`
+	data, err := TestTypeMapper.Marshal(ctx, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != expected {
+		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	}
+}
+
+func TestMarshalThingWithSliceOfPrimitives(t *testing.T) {
+	v := ThingWithSliceOfPrimitives{
+		Strings: []string{"foo", "bar"},
+	}
+
+	expected := `{"strings":["foo","bar"]}`
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	}
+}
+
+func TestMarshalThingWithNilSliceOfPrimitives(t *testing.T) {
+	v := ThingWithSliceOfPrimitives{}
+
+	expected := `{"strings":null}`
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	}
+}
+
+func TestValidateThingWithSliceOfPrimitives(t *testing.T) {
+	original := `{"strings":["foo","bar"]}`
+	v := &ThingWithSliceOfPrimitives{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Fatal("Unoriginal Marshal output:", string(data), original)
+	}
+}
+
+func TestValidateOuterMapThingNotAMap(t *testing.T) {
+	expected := `Validation Errors: 
+/inner_map: expected a map
 `
 
-	v := &AnotherOuterThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"another/inner/thing": {"foo": "foozzzy", "an~int": 11, "happened_at": "hi", "thanks": "baz"}}`), v)
+	v := &OuterMapThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_map": 3}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestMarshalThingWithMapOfInterfaces(t *testing.T) {
+	interfaces := map[string]interface{}{
+		"foo": "bar",
+		"baz": 10,
+		"qux": []string{"dang"},
+	}
+
+	v := ThingWithMapOfInterfaces{
+		Interfaces: interfaces,
+	}
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := json.Marshal(map[string]interface{}{"interfaces": interfaces})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != string(expected) {
+		t.Fatal("unexpected Marshal output", string(data), string(expected))
+	}
+}
+
+func TestValidateThingWithMapOfInterfaces(t *testing.T) {
+	original := `{"interfaces":{"baz":10,"dux":null,"foo":"bar","qux":["dang"]}}`
+	v := &ThingWithMapOfInterfaces{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Fatal("Unoriginal Marshal output:", string(data), original)
+	}
+}
+
+func TestMarshalThingWithTime(t *testing.T) {
+	ts, err := time.Parse(time.RFC822, time.RFC822)
+	if err != nil {
+		panic(err)
+	}
+
+	v := ThingWithTime{
+		HappenedAt: ts,
+	}
+
+	expected := `{"happened_at":"2006-01-02T15:04:00Z"}`
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	}
+}
+
+func TestUnmarshalThingWithTime(t *testing.T) {
+	ts, err := time.Parse(time.RFC822, time.RFC822)
+	if err != nil {
+		panic(err)
+	}
+
+	v := &ThingWithTime{}
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"happened_at":"2006-01-02T15:04:00Z"}`), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ts.Equal(v.HappenedAt) {
+		t.Fatal("Timestamp mismatch:", v.HappenedAt, ts)
+	}
+}
+
+func TestUnmarshalThingWithSchedule(t *testing.T) {
+	v := &ThingWithSchedule{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"day":"2019-03-14","starts":"09:30"}`), v)
+	require.NoError(t, err)
+	require.True(t, v.Day.Equal(time.Date(2019, 3, 14, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, 9, v.Starts.Hour())
+	require.Equal(t, 30, v.Starts.Minute())
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"day":"2019-03-14","starts":"09:30:00"}`, string(data))
+}
+
+func TestValidateThingWithSchedule(t *testing.T) {
+	expected := `Validation Errors: 
+/day: not a valid date, expected YYYY-MM-DD
+/starts: not a valid time of day, expected HH:MM:SS
+`
+	v := &ThingWithSchedule{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"day":"2019-03-14T00:00:00Z","starts":"25:00"}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateOuterSliceThing(t *testing.T) {
-	v := &OuterSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}]}`), v)
-	if err != nil {
-		t.Fatal(err)
+func TestUnmarshalThingWithTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		`"30s"`:       30 * time.Second,
+		`"1h30m"`:     90 * time.Minute,
+		`"PT1H30M"`:   90 * time.Minute,
+		`"PT1.5S"`:    1500 * time.Millisecond,
+		`"PT2H"`:      2 * time.Hour,
+		`"PT0H1M30S"`: 90 * time.Second,
 	}
-	if len(v.InnerThings) != 1 {
-		t.Fatal("InnerThings should contain 1 element, instead contains", len(v.InnerThings))
+
+	for input, expected := range cases {
+		v := &ThingWithTimeout{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"timeout":`+input+`}`), v)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, v.Timeout, input)
 	}
-	if v.InnerThings[0].Foo != "fooz" {
-		t.Fatal("InnerThing field Foo does not have expected value 'fooz':", v.InnerThings[0].Foo)
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, &ThingWithTimeout{Timeout: 90 * time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, `{"timeout":"1h30m0s"}`, string(data))
+}
+
+func TestValidateThingWithTimeout(t *testing.T) {
+	cases := map[string]string{
+		`"500ms"`: "too short, must be at least 1s",
+		`"P1D"`:   "too long, may not be longer than 2h0m0s",
+		`"P1Y"`:   "not a valid duration",
+		`"PT"`:    "not a valid duration",
+		`30`:      "not a string",
+	}
+
+	for input, msg := range cases {
+		v := &ThingWithTimeout{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"timeout":`+input+`}`), v)
+		require.EqualError(t, err, "Validation Errors: \n/timeout: "+msg+"\n", input)
 	}
 }
 
-func TestValidateOuterSliceThingInvalidElement(t *testing.T) {
+func TestUnmarshalThingWithAttachment(t *testing.T) {
+	v := &ThingWithAttachment{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"name":"_-8=","content":"aGVsbG8="}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "_-8=", v.Name)
+	require.Equal(t, []byte("hello"), v.Content)
+}
+
+func TestValidateThingWithAttachment(t *testing.T) {
 	expected := `Validation Errors: 
-/inner_things/0/foo: too long, may not be more than 12 characters
+/content: too large, may not be more than 8 bytes
+/name: not valid base64
 `
-	v := &OuterSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooziswaytoolooong"}]}`), v)
+	v := &ThingWithAttachment{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"name":"+/8=","content":"aGVsbG8gd29ybGQ="}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateOuterSliceThingMultipleInvalidElements(t *testing.T) {
+func TestUnmarshalThingWithEmbeddedJSON(t *testing.T) {
+	v := &ThingWithEmbeddedJSON{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"raw":"[1, 2]","config":"{\"foo\":\"bar\"}"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "[1, 2]", v.Raw)
+	require.Equal(t, `{"foo":"bar"}`, v.Config)
+}
+
+func TestValidateThingWithEmbeddedJSON(t *testing.T) {
 	expected := `Validation Errors: 
-/inner_things/0/foo: too long, may not be more than 12 characters
-/inner_things/1/foo: too long, may not be more than 12 characters
+/config/an_int: too large, may not be larger than 10
+/raw: not valid JSON
 `
-	v := &OuterSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooziswaytoolooong"}, {"foo": "fooziswaytoolooong2"}]}`), v)
+	v := &ThingWithEmbeddedJSON{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"raw":"{nope","config":"{\"an_int\":11}"}`), v)
 	require.EqualError(t, err, expected)
 }
-func TestValidateOuter2DSliceThing(t *testing.T) {
+
+func TestUnmarshalThingWithLocale(t *testing.T) {
+	for _, lang := range []string{"en", "pt-BR", "zh-Hant-TW", "es-419", "de-CH-1996", "en-US-x-twain", "haw"} {
+		v := &ThingWithLocale{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"country":"NZ","currency":"EUR","language":"`+lang+`"}`), v)
+		require.NoError(t, err, lang)
+		require.Equal(t, lang, v.Language)
+	}
+}
+
+func TestValidateThingWithLocale(t *testing.T) {
 	expected := `Validation Errors: 
-/inner_things/0/1/foo: too long, may not be more than 12 characters
-/inner_things/1/0/foo: too long, may not be more than 12 characters
-/inner_things/1/1/foo: too long, may not be more than 12 characters
+/country: not a valid ISO 3166-1 alpha-2 country code
+/currency: not a valid ISO 4217 currency code
+/language: not a valid BCP 47 language tag
 `
-	v := &Outer2DSliceThing{}
-	original := `{"inner_things": [[{"foo": "fooz"}, {"foo": "fooziswaytoolooong2"}], [{"foo": "fooziswaytoolooong"},{"foo": "fooziswaytoolooongagain"}]]}`
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
-	require.EqualError(t, err, expected)
+	for _, lang := range []string{"e", "en_US", "qq", "en-ZZ", "en-"} {
+		v := &ThingWithLocale{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"country":"us","currency":"EURO","language":"`+lang+`"}`), v)
+		require.EqualError(t, err, expected, lang)
+	}
 }
 
-func TestValidateOuterSliceThingNotAList(t *testing.T) {
+func TestValidateThingWithPhone(t *testing.T) {
+	v := &ThingWithPhone{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"phone":"+14155552671"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "+14155552671", v.Phone)
+
+	cases := map[string]string{
+		"14155552671":       "not a valid E.164 phone number, must start with '+' and a country code",
+		"+1 415 555 2671":   "not a valid E.164 phone number, may only contain digits after '+'",
+		"+04155552671":      "not a valid E.164 phone number, country code may not start with 0",
+		"+1415":             "not a valid E.164 phone number, too short",
+		"+1415555267112345": "not a valid E.164 phone number, may not be more than 15 digits",
+	}
+
+	for input, msg := range cases {
+		v := &ThingWithPhone{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"phone":"`+input+`"}`), v)
+		require.EqualError(t, err, "Validation Errors: \n/phone: "+msg+"\n", input)
+	}
+}
+
+func TestCardBrand(t *testing.T) {
+	require.Equal(t, CardBrandVisa, CardBrand("4111111111111111"))
+	require.Equal(t, CardBrandMastercard, CardBrand("5555555555554444"))
+	require.Equal(t, CardBrandMastercard, CardBrand("2223003122003222"))
+	require.Equal(t, CardBrandAmex, CardBrand("378282246310005"))
+	require.Equal(t, CardBrandDiscover, CardBrand("6011111111111117"))
+	require.Equal(t, CardBrandDiners, CardBrand("30569309025904"))
+	require.Equal(t, CardBrandJCB, CardBrand("3530111333300000"))
+	require.Equal(t, CardBrandUnknown, CardBrand("9999999999999995"))
+}
+
+func TestValidateThingWithCard(t *testing.T) {
+	v := &ThingWithCard{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"number":"4111 1111-1111 1111"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "4111111111111111", v.Number)
+
+	cases := map[string]string{
+		"4111111111111112":    "not a valid card number",
+		"4111":                "not a valid card number, must be between 12 and 19 digits",
+		"4111x111111111111":   "not a valid card number, may only contain digits",
+		"378282246310005":     "card brand not accepted, must be one of: visa, mastercard",
+		"4111111111111111111": "not a valid card number",
+	}
+
+	for input, msg := range cases {
+		v := &ThingWithCard{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"number":"`+input+`"}`), v)
+		require.EqualError(t, err, "Validation Errors: \n/number: "+msg+"\n", input)
+	}
+}
+
+func TestValidateThingWithPassword(t *testing.T) {
+	v := &ThingWithPassword{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"password":"correct Horse"}`), v)
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"Sh0rt":        "must be at least 8 characters long",
+		"alllowercase": "must contain at least 3 of the following: lowercase letters, uppercase letters, numbers, symbols",
+		"Password123":  "is too common, please choose a different password",
+		"acme2019!":    "is too common, please choose a different password",
+	}
+
+	for input, msg := range cases {
+		v := &ThingWithPassword{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"password":"`+input+`"}`), v)
+		require.EqualError(t, err, "Validation Errors: \n/password: "+msg+"\n", input)
+	}
+}
+
+func TestUnmarshalThingWithPrice(t *testing.T) {
+	v := &ThingWithPrice{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"amount":"0019.99","discount":"0.125"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "0019.99", v.Amount)
+	require.Equal(t, "1/8", v.Discount.String())
+}
+
+func TestValidateThingWithPrice(t *testing.T) {
+	cases := map[string]string{
+		`19.99`:       "not a string, decimal values must be sent as strings",
+		`"1e3"`:       "not a valid decimal number",
+		`".5"`:        "not a valid decimal number",
+		`"1.999"`:     "may not have more than 2 digits after the decimal point",
+		`"100000.00"`: "may not have more than 6 digits in total",
+	}
+
+	for input, msg := range cases {
+		v := &ThingWithPrice{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"amount":`+input+`}`), v)
+		require.EqualError(t, err, "Validation Errors: \n/amount: "+msg+"\n", input)
+	}
+}
+
+func TestUnmarshalThingWithUniqueSlices(t *testing.T) {
+	v := &ThingWithUniqueSlices{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"tags":["a","b"],"things":[{"foo":"a"},{"foo":"b","an_int":1}]}`), v)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, v.Tags)
+	require.Len(t, v.Things, 2)
+}
+
+func TestValidateThingWithUniqueSlices(t *testing.T) {
 	expected := `Validation Errors: 
-/inner_things: expected a list
+/tags/2: duplicate of element 0
+/tags/3: duplicate of element 0
+/things/1: duplicate of element 0
 `
-	v := &OuterSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": "foo"}`), v)
+	v := &ThingWithUniqueSlices{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"tags":["a","b","a","a"],"things":[{"foo":"a"},{"foo":"a","an_int":1}]}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateOuterSliceThingOverMax(t *testing.T) {
+func TestUniqueSliceElementKeys(t *testing.T) {
+	things := []*InnerThing{}
+	partial := []interface{}{nil, map[string]interface{}{"foo": "a"}, nil}
+	err := SliceOfUnique(InnerThingTypeMap).Unmarshal(EmptyContext, nil, partial, reflect.ValueOf(&things).Elem())
+	require.EqualError(t, err, "/2: duplicate of element 0\n")
+
+	values := []interface{}{}
+	partial = []interface{}{
+		map[string]interface{}{"a": 1.0, "b": []interface{}{"x"}},
+		[]interface{}{1.0, "two"},
+		map[string]interface{}{"b": []interface{}{"x"}, "a": 1.0},
+		[]interface{}{"two", 1.0},
+		nil,
+	}
+	err = SliceOfUnique(NewPrimitiveMap(Interface())).Unmarshal(EmptyContext, nil, partial, reflect.ValueOf(&values).Elem())
+	require.EqualError(t, err, "/2: duplicate of element 0\n")
+
+	err = SliceOfUnique(NewPrimitiveMap(Interface()), func(elem interface{}) interface{} {
+		return elem
+	}).Unmarshal(EmptyContext, nil, partial[:2], reflect.ValueOf(&values).Elem())
+	require.NoError(t, err)
+	require.Equal(t, partial[:2], values)
+}
+
+func TestUnmarshalThingWithKeyedMap(t *testing.T) {
+	v := &ThingWithKeyedMap{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"by_id":{"00000000-0000-1000-9000-000000000000":{"foo":"a"}}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "a", v.ByID["00000000-0000-1000-9000-000000000000"].Foo)
+}
+
+func TestValidateThingWithKeyedMap(t *testing.T) {
 	expected := `Validation Errors: 
-/inner_things: must have at most 2 elements
+/by_id/not-a-uuid: invalid key: not a valid UUID
 `
-	v := &OuterMaxSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}, {"foo": "fooz3"}]}`), v)
+	v := &ThingWithKeyedMap{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"by_id":{"not-a-uuid":{"foo":"a"}}}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateOuterSliceThingUnderMax(t *testing.T) {
-	v := &OuterMaxSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}]}`), v)
-	if err != nil {
-		t.Fatal(err)
+func TestUnmarshalThingFromSloppyClient(t *testing.T) {
+	cases := map[string]ThingFromSloppyClient{
+		`{"count":"42","enabled":"TRUE"}`: {Count: 42, Enabled: true},
+		`{"count":42,"enabled":"0"}`:      {Count: 42, Enabled: false},
+		`{"count":"7","enabled":true}`:    {Count: 7, Enabled: true},
+	}
+
+	for input, expected := range cases {
+		v := &ThingFromSloppyClient{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(input), v)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, *v, input)
 	}
 }
 
-func TestValidateOuterSliceThingUnderMin(t *testing.T) {
+func TestValidateThingFromSloppyClient(t *testing.T) {
 	expected := `Validation Errors: 
-/inner_things: must have at least 2 elements
+/count: too large, may not be larger than 100
+/enabled: not a boolean
 `
-	v := &OuterMinSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}]}`), v)
+	v := &ThingFromSloppyClient{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"count":"101","enabled":"yes"}`), v)
+	require.EqualError(t, err, expected)
+
+	expected = `Validation Errors: 
+/count: not an integer
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"count":"4.2","enabled":"false"}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateOuterSliceThingOverMin(t *testing.T) {
-	v := &OuterMinSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}]}`), v)
-	if err != nil {
-		t.Fatal(err)
+func TestUnmarshalThingWithNullable(t *testing.T) {
+	v := &ThingWithNullable{Nickname: "old"}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"nickname":null}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "", v.Nickname)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"nickname":"spot"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "spot", v.Nickname)
+
+	expected := `Validation Errors: 
+/nickname: missing required field
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
+	require.EqualError(t, err, expected)
+
+	expected = `Validation Errors: 
+/nickname: too long, may not be more than 5 characters
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"nickname":"spotty"}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestUnmarshalThingWithDefault(t *testing.T) {
+	v := &ThingWithDefault{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":null}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "red", v.Color)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"blue"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "blue", v.Color)
+
+	expected := `Validation Errors: 
+/color: Value must be one of: ["red","blue"]
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"green"}`), v)
+	require.EqualError(t, err, expected)
+}
+
+func TestOneOfErrorFormatting(t *testing.T) {
+	_, err := OneOf("a", "b", "c", "d").Truncate(2).Validate("e")
+	require.EqualError(t, err, `Value must be one of: ["a","b"] and 2 more`)
+
+	_, err = OneOf("a", "b", "c").Truncate(1).Documentation("https://example.com/codes").Validate("e")
+	require.EqualError(t, err, `Value must be one of: ["a"] and 2 more, see https://example.com/codes`)
+
+	_, err = OneOf("a", "b").Truncate(5).Validate("e")
+	require.EqualError(t, err, `Value must be one of: ["a","b"]`)
+
+	_, err = OneOf("a", "b").WithMessage("not a supported region").Validate("e")
+	require.EqualError(t, err, "not a supported region")
+
+	_, err = OneOf("50%", "100%").Validate("e")
+	require.EqualError(t, err, `Value must be one of: ["50%","100%"]`)
+	_, err = OneOf("a").WithMessage("must be 100% valid").Validate("e")
+	require.EqualError(t, err, "must be 100% valid")
+}
+
+func TestValidationErrorCodes(t *testing.T) {
+	v := &AnotherInnerThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": "foozzzy", "an~int": 11, "a_bool": "no", "happened_at": "hi", "thanks": "baz"}`), v)
+	require.Error(t, err)
+
+	codes := []string{}
+	for _, e := range err.(*MultiValidationError).Errors() {
+		codes = append(codes, e.Code)
 	}
+	require.Equal(t, []string{CodeNotABoolean, CodeOutOfRange, CodeTooLong, CodeInvalidFormat, CodeNotOneOf}, codes)
+
+	o := &OuterMinSliceThing{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{}]}`), o)
+	require.Error(t, err)
+	require.Equal(t, CodeTooFewElements, err.(*MultiValidationError).Errors()[0].Code)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), &OuterThing{})
+	require.Error(t, err)
+	require.Equal(t, CodeMissingRequiredField, err.(*MultiValidationError).Errors()[0].Code)
 }
 
-func TestValidateOuterRangeSliceThingUnderMin(t *testing.T) {
+func TestUnmarshalThingWithQuota(t *testing.T) {
+	cases := map[string]int64{
+		"512KB":  512000,
+		"10MiB":  10 << 20,
+		"1.5 kb": 1500,
+		"2048":   2048,
+		"1GiB":   1 << 30,
+	}
+
+	for input, expected := range cases {
+		v := &ThingWithQuota{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"limit":"`+input+`"}`), v)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, v.Limit, input)
+	}
+}
+
+func TestValidateThingWithQuota(t *testing.T) {
+	cases := map[string]string{
+		"10 furlongs": "unknown size unit 'furlongs'",
+		"MiB":         "not a valid size, expected a number followed by a unit such as KB or MiB",
+		"1000":        "too small, must be at least 1024 bytes",
+		"2GB":         "too large, may not be larger than 1073741824 bytes",
+		"99999PiB":    "too large, may not be larger than 1073741824 bytes",
+		"8192PiB":     "too large, may not be larger than 1073741824 bytes",
+	}
+
+	for input, msg := range cases {
+		v := &ThingWithQuota{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"limit":"`+input+`"}`), v)
+		require.EqualError(t, err, "Validation Errors: \n/limit: "+msg+"\n", input)
+	}
+}
+
+func TestUnmarshalThingWithLocation(t *testing.T) {
+	v := &ThingWithLocation{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"where":{"latitude":-41.2865,"longitude":174.7762},"lat":12.5}`), v)
+	require.NoError(t, err)
+	require.Equal(t, GeoPoint{Latitude: -41.2865, Longitude: 174.7762}, v.Where)
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"where":{"latitude":-41.2865,"longitude":174.7762},"lat":12.5}`, string(data))
+}
+
+func TestValidateThingWithLocation(t *testing.T) {
 	expected := `Validation Errors: 
-/inner_things: must have between 1 and 2 elements
+/lat: may not have more than 2 decimal places
+/where/latitude: not a valid latitude, must be between -90 and 90
+/where/longitude: not a number
 `
-	v := &OuterRangeSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": []}`), v)
+	v := &ThingWithLocation{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"where":{"latitude":91,"longitude":"east"},"lat":1.234}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateOuterRangeSliceThingOverMax(t *testing.T) {
+func TestHexColorValidator(t *testing.T) {
+	for input, expected := range map[string]string{"#0AF": "#0af", "#00aaFF": "#00aaff", "#00AAFF80": "#00aaff80"} {
+		v, err := HexColor().Validate(input)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, v)
+	}
+
+	for _, input := range []string{"0af", "#0afa", "#00aaf", "#00aaff8", "#ggg"} {
+		_, err := HexColor().Validate(input)
+		require.EqualError(t, err, "not a valid hex color, expected #RGB, #RRGGBB or #RRGGBBAA", input)
+	}
+}
+
+func TestUnmarshalThingWithSizedInts(t *testing.T) {
+	v := &ThingWithSizedInts{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"i":-3,"i8":-128,"i16":32767,"i32":-5,"u":4294967295,"u8":255,"u16":7,"u32":4294967295}`), v)
+	require.NoError(t, err)
+	require.Equal(t, ThingWithSizedInts{I: -3, I8: -128, I16: 32767, I32: -5, U: 4294967295, U8: 255, U16: 7, U32: 4294967295}, *v)
+
 	expected := `Validation Errors: 
-/inner_things: must have between 1 and 2 elements
+/i8: too large, may not be larger than 127
+/u8: too small, must be at least 0
 `
-	v := &OuterRangeSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}, {"foo": "fooz3"}]}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"i":1,"i8":128,"i16":1,"i32":1,"u":1,"u8":-1,"u16":1,"u32":1}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateOuterRangeSliceThingInRange(t *testing.T) {
-	v := &OuterRangeSliceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things": [{"foo": "fooz"}, {"foo": "fooz2"}]}`), v)
-	if err != nil {
-		t.Fatal(err)
+func TestPathSafeValidator(t *testing.T) {
+	for _, input := range []string{"report.pdf", "..hidden", "a b", "ünïcode"} {
+		_, err := PathSafe(16).Validate(input)
+		require.NoError(t, err, input)
+	}
+
+	cases := map[string]string{
+		"":                       "may not be empty",
+		"..":                     "may not be '.' or '..'",
+		"../etc/passwd":          "may not contain slashes",
+		`..\windows`:             "may not contain slashes",
+		"bad\x00name":            "may not contain control characters",
+		"line\nbreak":            "may not contain control characters",
+		"\xff":                   "not valid UTF-8",
+		"waytoolongforthisfield": "too long, may not be more than 16 characters",
+	}
+
+	for input, msg := range cases {
+		_, err := PathSafe(16).Validate(input)
+		require.EqualError(t, err, msg, input)
 	}
 }
 
-func TestValidateReadOnlyThing(t *testing.T) {
-	v := &ReadOnlyThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"primary_key": "foo"}`), v)
-	if err != nil {
-		t.Fatal(err)
+func TestCronExprValidator(t *testing.T) {
+	for _, input := range []string{"* * * * *", "*/15 9-17 * * MON-FRI", "0 0 1,15 * ?", "30 4 1 jan,jul 0", "@daily"} {
+		_, err := CronExpr().Validate(input)
+		require.NoError(t, err, input)
 	}
-	if v.PrimaryKey != "" {
-		t.Fatal("ReadOnly field unexpectedly set")
+
+	_, err := CronExpr().Seconds().Validate("0 */5 * * * *")
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"* * * *":       "not a valid cron expression, expected 5 fields",
+		"60 * * * *":    "not a valid cron expression, field 1 (minute): value 60 out of range 0-59",
+		"* * 0 * *":     "not a valid cron expression, field 3 (day of month): value 0 out of range 1-31",
+		"* * * FOO *":   "not a valid cron expression, field 4 (month): invalid value 'FOO'",
+		"* */0 * * *":   "not a valid cron expression, field 2 (hour): invalid step '0'",
+		"* * * * 5-1":   "not a valid cron expression, field 5 (day of week): invalid range '5-1'",
+		"0 */5 * * * *": "not a valid cron expression, expected 5 fields",
+		"? * * * *":     "not a valid cron expression, field 1 (minute): invalid value '?'",
+	}
+
+	for input, msg := range cases {
+		_, err := CronExpr().Validate(input)
+		require.EqualError(t, err, msg, input)
 	}
 }
 
-func TestValidateReadOnlyThingValueNotProvided(t *testing.T) {
-	v := &ReadOnlyThing{}
+func TestJSONPointerValidator(t *testing.T) {
+	for _, input := range []string{"", "/", "/foo/0", "/a~1b/m~0n", "/ünï code"} {
+		_, err := JSONPointer().Validate(input)
+		require.NoError(t, err, input)
+	}
+
+	for _, input := range []string{"foo", "/a~2", "/a~", "$.foo"} {
+		_, err := JSONPointer().Validate(input)
+		require.EqualError(t, err, "not a valid JSON Pointer", input)
+	}
+
+	for _, input := range []string{"$", "$.store.book[0].title", "$..author", "$['a b'][*]", "/foo"} {
+		_, err := JSONPointer().OrJSONPath().Validate(input)
+		require.NoError(t, err, input)
+	}
+
+	for _, input := range []string{"$.", "$[", "store.book", "$.a[b]"} {
+		_, err := JSONPointer().OrJSONPath().Validate(input)
+		require.EqualError(t, err, "not a valid JSON Pointer or JSONPath expression", input)
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	now := time.Date(2019, 3, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	type window struct {
+		tm       *TimeMap
+		input    string
+		expected string
+	}
+
+	cases := []window{
+		{Time().MustBeFuture(), "2019-03-14T12:00:01Z", ""},
+		{Time().MustBeFuture(), "2019-03-14T11:59:59Z", "must be in the future"},
+		{Time().MustBePast(), "2019-03-14T12:00:01Z", "must be in the past"},
+		{Time().NotBefore(-24 * time.Hour), "2019-03-13T12:00:00Z", ""},
+		{Time().NotBefore(-24 * time.Hour), "2019-03-13T11:59:59Z", "must not be more than 24h0m0s in the past"},
+		{Time().NotBefore(time.Hour), "2019-03-14T12:30:00Z", "must be at least 1h0m0s in the future"},
+		{Time().NotAfter(time.Hour), "2019-03-14T13:30:00Z", "must not be more than 1h0m0s in the future"},
+		{Time().NotAfter(-time.Hour), "2019-03-14T11:30:00Z", "must be at least 1h0m0s in the past"},
+		{Time().MustBeFuture().NotAfter(time.Hour), "2019-03-14T12:30:00Z", ""},
+	}
+
+	for _, c := range cases {
+		c.tm.Now = clock
+		dst := reflect.New(reflect.TypeOf(time.Time{})).Elem()
+		err := c.tm.Unmarshal(EmptyContext, nil, c.input, dst)
+		if c.expected == "" {
+			require.NoError(t, err, c.input)
+		} else {
+			require.EqualError(t, err, c.expected, c.input)
+		}
+	}
+}
+
+func TestUnmarshalMutuallyExclusiveFields(t *testing.T) {
+	v := &UserLookup{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"email":"a@example.com","phone":null}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "a@example.com", v.Email)
+
+	expected := `Validation Errors: 
+: only one of 'user_id', 'email', 'phone' may be present, got 'email', 'phone'
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"email":"a@example.com","phone":"+14155552671"}`), v)
+	require.EqualError(t, err, expected)
+	require.Equal(t, CodeMutuallyExclusive, err.(*MultiValidationError).Errors()[0].Code)
+
+	expected = `Validation Errors: 
+/lookup: only one of 'user_id', 'email', 'phone' may be present, got 'user_id', 'email'
+/lookup/user_id: not a valid UUID
+`
+	o := &OuterUserLookup{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"lookup":{"user_id":"nope","email":"a@example.com"}}`), o)
+	require.EqualError(t, err, expected)
+}
+
+func TestUnmarshalRequiredTogetherFields(t *testing.T) {
+	v := &PaymentDetails{}
 	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
-	if err != nil {
-		t.Fatal(err)
+	require.NoError(t, err)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"card_number":"4111111111111111","expiry":"12/30","cvc":"123"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "123", v.CVC)
+
+	expected := `Validation Errors: 
+/cvc: required when 'card_number' is present
+/expiry: required when 'card_number' is present
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"card_number":"4111111111111111","expiry":null}`), &PaymentDetails{})
+	require.EqualError(t, err, expected)
+	errs := err.(*MultiValidationError).Errors()
+	require.Len(t, errs, 2)
+	require.Equal(t, CodeRequiredTogether, errs[0].Code)
+
+	expected = `Validation Errors: 
+/card_number: required when 'expiry', 'cvc' is present
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"expiry":"12/30","cvc":"123"}`), &PaymentDetails{})
+	require.EqualError(t, err, expected)
+}
+
+func TestValidationErrorsIsAndAs(t *testing.T) {
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), &OuterThing{})
+	require.True(t, errors.Is(err, ErrValidation))
+	require.True(t, errors.Is(err, ErrMissingRequiredField))
+
+	var fe *FlattenedPathError
+	require.True(t, errors.As(err, &fe))
+	require.Equal(t, "/inner_thing", fe.Path)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": {"foo": "toooooooolong"}}`), &OuterThing{})
+	require.True(t, errors.Is(err, ErrValidation))
+	require.False(t, errors.Is(err, ErrMissingRequiredField))
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"invalid": "definitely"}`), &BrokenThing{})
+	require.True(t, errors.As(err, &fe))
+	require.EqualError(t, fe.Unwrap(), "this should be a ValidationError")
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{`), &OuterThing{})
+	var se *json.SyntaxError
+	require.False(t, errors.Is(err, ErrValidation))
+	require.True(t, errors.As(err, &se))
+
+	require.False(t, errors.Is(errors.New("other"), ErrValidation))
+}
+
+func TestValidationErrorsIsAndAsMethods(t *testing.T) {
+	// Calls Is() and As() directly, which is what errors.Is() and errors.As()
+	// rely on to search nested errors
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), &OuterThing{})
+	me := err.(*MultiValidationError)
+	require.True(t, me.Is(ErrValidation))
+	require.True(t, me.Is(ErrMissingRequiredField))
+
+	var fe *FlattenedPathError
+	require.True(t, me.As(&fe))
+	require.Equal(t, "/inner_thing", fe.Path)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": {"foo": "toooooooolong"}}`), &OuterThing{})
+	require.False(t, err.(*MultiValidationError).Is(ErrMissingRequiredField))
+
+	cause := errors.New("boom")
+	ve := &ValidationError{}
+	ve.AddError(WrapFieldError("foo", cause))
+	ve.AddError(NewValidationErrorWithField("bar", "missing").WithCode(CodeMissingRequiredField))
+	require.True(t, ve.Is(cause))
+	require.True(t, ve.Is(ErrMissingRequiredField))
+	require.False(t, ve.Is(errors.New("other")))
+
+	var nested *ValidationError
+	require.True(t, ve.As(&nested))
+	require.Equal(t, "foo", nested.Field)
+}
+
+func TestValidationErrorsIsDeeplyNested(t *testing.T) {
+	err := NewValidationErrorWithField("leaf", "too long").WithCode(CodeTooLong)
+	for i := 0; i < 64; i++ {
+		parent := &ValidationError{}
+		parent.AddError(AppendPath(err, fmt.Sprint(i)))
+		err = parent
 	}
-	if v.PrimaryKey != "" {
-		t.Fatal("ReadOnly field unexpectedly set")
+
+	// Each error must be searched once, not once per level of nesting
+	done := make(chan bool)
+	go func() {
+		var fe *FlattenedPathError
+		done <- errors.Is(err, ErrMissingRequiredField) || errors.As(err, &fe) || errors.Is(err.Flatten(), ErrMissingRequiredField)
+	}()
+	select {
+	case found := <-done:
+		require.False(t, found)
+	case <-time.After(time.Second):
+		t.Fatal("searching nested errors took too long")
 	}
 }
 
-func TestValidateUnregisteredThing(t *testing.T) {
-	defer func() {
-		if r := recover(); r == nil {
-			t.Fatal("No panic")
-		}
-	}()
-	v := &UnregisteredThing{}
-	TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
-	t.Fatal("Unexpected success")
+func TestMarshalMultiValidationError(t *testing.T) {
+	v := &OuterThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing":{"foo":"toooooooolong"}}`), v)
+	require.Error(t, err)
+
+	data, jerr := json.Marshal(err)
+	require.NoError(t, jerr)
+	require.Equal(t, `{"errors":[{"path":"/inner_thing/foo","message":"too long, may not be more than 12 characters","code":"too_long","params":{"max":12}}]}`, string(data))
+
+	data, jerr = json.Marshal(&MultiValidationError{})
+	require.NoError(t, jerr)
+	require.Equal(t, `{"errors":[]}`, string(data))
+
+	data, jerr = json.Marshal(NewFlattenedPathError("/foo", "bad"))
+	require.NoError(t, jerr)
+	require.Equal(t, `{"path":"/foo","message":"bad"}`, string(data))
 }
 
-func TestValidateStringTypeMismatch(t *testing.T) {
-	expected := `Validation Errors: 
-/foo: not a string
-`
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": 12.0}`), v)
-	require.EqualError(t, err, expected)
+func TestProblemFromValidationError(t *testing.T) {
+	v := &OuterThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing":{"foo":"toooooooolong"}}`), v)
+	require.Error(t, err)
+
+	p := NewProblem(err.(*MultiValidationError))
+	p.Type = "https://example.com/probs/validation"
+	p.Instance = "/things/1"
+
+	w := httptest.NewRecorder()
+	require.NoError(t, p.WriteResponse(w))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	require.Equal(t, `{"type":"https://example.com/probs/validation","title":"Bad Request","status":400,"instance":"/things/1","invalid-params":[{"name":"/inner_thing/foo","reason":"too long, may not be more than 12 characters","code":"too_long"}]}`, w.Body.String())
 }
 
-func TestValidateStringTooShort(t *testing.T) {
-	expected := `Validation Errors: 
-/foo: too short, must be at least 1 characters
-`
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": ""}`), v)
-	require.EqualError(t, err, expected)
+func TestValidationErrorParams(t *testing.T) {
+	_, err := String(2, 4).Validate("a")
+	require.Equal(t, map[string]interface{}{"min": 2}, err.(*ValidationError).Params)
+
+	_, err = Integer(1, 10).Validate(float64(11))
+	require.Equal(t, map[string]interface{}{"max": int64(10)}, err.(*ValidationError).Params)
+
+	_, err = OneOf("red", "green").Validate("blue")
+	require.Equal(t, CodeNotOneOf, err.(*ValidationError).Code)
+	require.Equal(t, []string{"red", "green"}, err.(*ValidationError).Params["allowed"])
+
+	v := &OuterThing{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing":{"foo":"toooooooolong"}}`), v)
+	errs := err.(*MultiValidationError).Errors()
+	require.Len(t, errs, 1)
+	require.Equal(t, CodeTooLong, errs[0].Code)
+	require.Equal(t, map[string]interface{}{"max": 12}, errs[0].Params)
 }
 
-func TestValidateStringTooLong(t *testing.T) {
+func TestUnmarshalMaxErrors(t *testing.T) {
+	data := []byte(`{"inner_things":[{"foo":"toooooooolong"},{"foo":"toooooooolong"},{"foo":"toooooooolong"},{"foo":"toooooooolong"}]}`)
+
 	expected := `Validation Errors: 
-/foo: too long, may not be more than 12 characters
+/inner_things/0/foo: too long, may not be more than 12 characters
+/inner_things/1/foo: too long, may not be more than 12 characters
+: and 2 more errors
 `
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo": "thisvalueistoolong"}`), v)
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v, MaxErrors(2))
 	require.EqualError(t, err, expected)
+	errs := err.(*MultiValidationError).Errors()
+	require.Equal(t, CodeTooManyErrors, errs[2].Code)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, data, v, MaxErrors(4))
+	require.Len(t, err.(*MultiValidationError).Errors(), 4)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.Len(t, err.(*MultiValidationError).Errors(), 4)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things":[{"foo":"ok"}]}`), v, MaxErrors(1))
+	require.NoError(t, err)
 }
 
-func TestValidateBooleanTypeMismatch(t *testing.T) {
+func TestUnmarshalFailFast(t *testing.T) {
 	expected := `Validation Errors: 
-/a_bool: not a boolean
+/inner_things/1/foo: too long, may not be more than 12 characters
 `
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"a_bool": 12.0}`), v)
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things":[{"foo":"ok"},{"foo":"toooooooolong"},{"foo":"toooooooolong"}]}`), v, FailFast())
 	require.EqualError(t, err, expected)
-}
 
-func TestValidateIntegerTypeMismatch(t *testing.T) {
-	expected := `Validation Errors: 
-/an_int: not an integer
+	expected = `Validation Errors: 
+/lookup/user_id: not a valid UUID
 `
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": false}`), v)
+	o := &OuterUserLookup{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"lookup":{"user_id":"nope","email":"a@example.com"}}`), o, FailFast())
 	require.EqualError(t, err, expected)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things":[{"foo":"ok"}]}`), v, FailFast())
+	require.NoError(t, err)
 }
 
-func TestValidateIntegerNumericTypeMismatch(t *testing.T) {
+func TestUnmarshalIncludeValues(t *testing.T) {
+	data := []byte(`{"inner_things":[{"foo":12.0},{"foo":"toooooooolong"},"nope"]}`)
+
 	expected := `Validation Errors: 
-/an_int: not an integer
+/inner_things/0/foo: not a string
+/inner_things/1/foo: too long, may not be more than 12 characters
+/inner_things/2: expected an object
 `
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": 12.1}`), v)
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
 	require.EqualError(t, err, expected)
-}
+	require.Nil(t, err.(*MultiValidationError).Errors()[0].Params)
 
-func TestValidateIntegerTooSmall(t *testing.T) {
-	expected := `Validation Errors: 
-/an_int: too small, must be at least 0
+	expected = `Validation Errors: 
+/inner_things/0/foo: got number 12, expected string
+/inner_things/1/foo: too long, may not be more than 12 characters
+/inner_things/2: got string "nope", expected object
 `
-
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": -1}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, data, v, IncludeValues())
 	require.EqualError(t, err, expected)
+	errs := err.(*MultiValidationError).Errors()
+	require.Equal(t, map[string]interface{}{"value": 12.0, "got": "number", "expected": "string"}, errs[0].Params)
+	require.Equal(t, "toooooooolong", errs[1].Params["value"])
 }
 
-func TestValidateIntegerTooLarge(t *testing.T) {
+func TestUnmarshalWarnings(t *testing.T) {
+	data := []byte(`{"color":"blue","others":["red","blue"]}`)
+
+	v := &ThingWithDeprecatedColors{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.NoError(t, err)
+	require.Equal(t, "blue", v.Color)
+	require.Equal(t, []string{"red", "blue"}, v.Others)
+
+	warnings := []*FlattenedPathError{}
+	v = &ThingWithDeprecatedColors{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, data, v, Warnings(&warnings))
+	require.NoError(t, err)
+	require.Equal(t, "blue", v.Color)
+	require.Equal(t, []string{"red", "blue"}, v.Others)
+	require.Len(t, warnings, 2)
+	require.Equal(t, "/color: 'blue' is deprecated\n", warnings[0].String())
+	require.Equal(t, "/others/1: 'blue' is deprecated\n", warnings[1].String())
+	require.Equal(t, CodeDeprecatedValue, warnings[0].Code)
+
 	expected := `Validation Errors: 
-/an_int: too large, may not be larger than 10
+/others/0: Value must be one of: ["red","green"]
 `
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": 2048}`), v)
+	warnings = warnings[:0]
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"blue","others":["pink"]}`), v, Warnings(&warnings))
 	require.EqualError(t, err, expected)
-}
+	require.Len(t, warnings, 1)
+	require.Equal(t, "/color", warnings[0].Path)
 
-func TestValidateMultipleTypeMismatch(t *testing.T) {
-	expected := `Validation Errors: 
-/an_int: too large, may not be larger than 10
-/a_bool: not a boolean
-`
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"an_int": 2048, "a_bool": 12.0}`), v)
+	warnings = warnings[:0]
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"blue","others":["pink"]}`), v, Warnings(&warnings), FailFast())
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateMapOfInnerThing(t *testing.T) {
-	expected1 := `Validation Errors: 
-/inner_thing_map/key1/an_int: too large, may not be larger than 10
-/inner_thing_map/key1/a_bool: not a boolean
-/inner_thing_map/key2/an_int: too large, may not be larger than 10
-/inner_thing_map/key2/a_bool: not a boolean
-`
-	expected2 := `Validation Errors: 
-/inner_thing_map/key2/an_int: too large, may not be larger than 10
-/inner_thing_map/key2/a_bool: not a boolean
-/inner_thing_map/key1/an_int: too large, may not be larger than 10
-/inner_thing_map/key1/a_bool: not a boolean
-`
-	v := &OuterInnerThingMap{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing_map":{"key1":{"an_int": 2048, "a_bool": 12.0}, "key2":{"an_int": 2048, "a_bool": 12.0}}}`), v)
+func TestUnmarshalDowngrade(t *testing.T) {
+	data := []byte(`{"strings":["ok","this is much too long"]}`)
 
-	if err.Error() != expected1 && err.Error() != expected2 {
-		t.Fatal("Unexpected error message:", err.Error())
-	}
-}
+	v := &ThingWithSliceOfPrimitives{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.EqualError(t, err, "Validation Errors: \n/strings/1: too long, may not be more than 16 characters\n")
 
-func TestValidateMapOfInnerThingFirstEntryValid(t *testing.T) {
-	expected := `Validation Errors: 
-/inner_thing_map/key2/an_int: too large, may not be larger than 10
-/inner_thing_map/key2/a_bool: not a boolean
-`
-	v := &OuterInnerThingMap{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing_map":{"key1":{"an_int": 5, "a_bool": true}, "key2":{"an_int": 2048, "a_bool": 12.0}}}`), v)
-	require.EqualError(t, err, expected)
-}
+	warnings := []*FlattenedPathError{}
+	v = &ThingWithSliceOfPrimitives{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, data, v, Downgrade(CodeTooLong), Warnings(&warnings))
+	require.NoError(t, err)
+	require.Equal(t, []string{"ok", "this is much too long"}, v.Strings)
+	require.Len(t, warnings, 1)
+	require.Equal(t, "/strings/1", warnings[0].Path)
+	require.Equal(t, CodeTooLong, warnings[0].Code)
+	require.Equal(t, SeverityWarning, warnings[0].Severity)
+
+	// Other errors are unaffected
+	warnings = warnings[:0]
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"strings":["","this is much too long"]}`), v, Downgrade(CodeTooLong), Warnings(&warnings))
+	require.EqualError(t, err, "Validation Errors: \n/strings/0: too short, must be at least 1 characters\n")
+	require.Equal(t, SeverityError, err.(*MultiValidationError).NestedErrors[0].Severity)
+	require.Len(t, warnings, 1)
+}
+
+func TestWrapFieldError(t *testing.T) {
+	cause := errors.New("boom")
+	err := WrapFieldError("foo", cause)
+	require.Equal(t, "foo", err.Field)
+	require.Equal(t, "boom", err.Message)
+	require.True(t, errors.Is(err, cause))
+
+	inner := NewValidationError("too long").WithCode(CodeTooLong)
+	err = &ValidationError{}
+	err.AddError(AppendPath(WrapFieldError("bar", inner), "2"))
+	require.Equal(t, "Validation Errors: \n/2/bar: too long\n", err.Flatten().Error())
+	require.Equal(t, CodeTooLong, err.Flatten().NestedErrors[0].Code)
+}
+
+func TestUnmarshalUseNumber(t *testing.T) {
+	data := []byte(`{"id":9007199254740993,"count":18446744073709551615,"extra":{"n":1.5}}`)
+
+	v := &ThingWithCounters{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v, UseNumber())
+	require.NoError(t, err)
+	require.Equal(t, int64(9007199254740993), v.ID)
+	require.Equal(t, uint64(math.MaxUint64), v.Count)
+	require.Equal(t, json.Number("1.5"), v.Extra["n"])
+
+	v = &ThingWithCounters{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"id":1e3,"count":2.0}`), v, UseNumber())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), v.ID)
+	require.Equal(t, uint64(2), v.Count)
 
-func TestValidateWithUnexpectedError(t *testing.T) {
 	expected := `Validation Errors: 
-/invalid: this should be a ValidationError
+/count: not an integer
+/id: not an integer
 `
-	v := &BrokenThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"invalid": "definitely"}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"id":1.5,"count":-1}`), v, UseNumber())
 	require.EqualError(t, err, expected)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"id":1} x`), v, UseNumber())
+	require.EqualError(t, err, "unexpected data after the end of the JSON value")
 }
 
-func TestValidateThingWithMapOfStrings(t *testing.T) {
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		data string
+		new  func() interface{}
+	}{
+		{`{"inner_things":[{"foo":"a","an_int":2},{"a_bool":true}]}`, func() interface{} { return &OuterSliceThing{} }},
+		{`{"extra":{"x":[1,2]},"inner_things":[{"foo":"this is too long"},5,{"an_int":"1"}]}`, func() interface{} { return &OuterSliceThing{} }},
+		{`{"inner_things":[[{"foo":"a"}],[{"foo":""}]]}`, func() interface{} { return &Outer2DSliceThing{} }},
+		{`{"inner_thing":null}`, func() interface{} { return &OuterPointerThing{} }},
+		{`{"inner_thing":{"foo":"a"},"inner_thing":{"an_int":3}}`, func() interface{} { return &OuterPointerThing{} }},
+		{`{"inner_thing":{"foo":"a"},"inner_thing":null}`, func() interface{} { return &OuterPointerThing{} }},
+		{`{"inner_thing":{"foo":"bar"},"inner_type":"foo"}`, func() interface{} { return &OuterVariableThing{} }},
+		{`{"inner_thing":{"an_int":11},"inner_type":"foo"}`, func() interface{} { return &OuterVariableThing{} }},
+		{`{"strings":["ok","this is much too long"]}`, func() interface{} { return &ThingWithSliceOfPrimitives{} }},
+		{`null`, func() interface{} { return &OuterSliceThing{} }},
+		{`[]`, func() interface{} { return &OuterSliceThing{} }},
+	}
+
+	for _, test := range tests {
+		expected := test.new()
+		expectedErr := TestTypeMapper.Unmarshal(EmptyContext, []byte(test.data), expected)
+
+		v := test.new()
+		err := TestTypeMapper.Decode(EmptyContext, strings.NewReader(test.data), v)
+		require.Equal(t, expectedErr, err, test.data)
+		require.Equal(t, expected, v, test.data)
+	}
+
+	// Errors are sorted by path, regardless of the order in which the fields
+	// arrive or are declared
 	expected := `Validation Errors: 
-/strings/key1: too long, may not be more than 5 characters
+/inner_things/0/an_int: too large, may not be larger than 10
+/inner_things/0/foo: too long, may not be more than 12 characters
 `
-	original := `{"strings":{"key1":"tooooooolongomg"}}`
-	v := &ThingWithMapOfStrings{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Decode(EmptyContext, strings.NewReader(`{"inner_things":[{"foo":"this is too long","an_int":11}]}`), v)
 	require.EqualError(t, err, expected)
+
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader("{\n\"inner_things\": [}"), v)
+	require.EqualError(t, err, "invalid character '}' looking for beginning of value (line 2, column 18)")
+	require.IsType(t, &SyntaxError{}, err)
 }
 
-func TestUnmarshalVariableTypeThing(t *testing.T) {
-	{
-		v := &OuterVariableThing{}
-		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"foo","inner_thing":{"foo":"bar"}}`), v)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if v.InnerType != "foo" {
-			t.Fatal("Unexpected value of InnerType:", v.InnerType)
-		}
-		it, ok := v.InnerValue.(*InnerThing)
-		if !ok {
-			t.Fatal("InnerValue has the wrong type:", reflect.TypeOf(v.InnerValue).String())
-		}
-		if it.Foo != "bar" {
-			t.Fatal("Unexpected value of InnerThing.Foo:", it.Foo)
-		}
+func TestMarshalOrderedMap(t *testing.T) {
+	v := &ThingWithOrderedMap{
+		Attributes: map[string]string{
+			"zeta":  "z",
+			"name":  "n",
+			"alpha": "a",
+			"id":    "1",
+			"<b>":   "&",
+		},
 	}
-	{
-		v := &OuterVariableThing{}
-		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"bar","inner_thing":{"bar":"foo"}}`), v)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if v.InnerType != "bar" {
-			t.Fatal("Unexpected value of InnerType:", v.InnerType)
-		}
-		it, ok := v.InnerValue.(*OtherInnerThing)
-		if !ok {
-			t.Fatal("InnerValue has the wrong type:", reflect.TypeOf(v.InnerValue).String())
-		}
-		if it.Bar != "foo" {
-			t.Fatal("Unexpected value of InnerThing.Foo:", it.Bar)
-		}
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"attributes":{"id":"1","name":"n","\u003cb\u003e":"\u0026","alpha":"a","zeta":"z"}}`, string(data))
+
+	u := &ThingWithOrderedMap{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, data, u)
+	require.NoError(t, err)
+	require.Equal(t, v, u)
+}
+
+func TestTimeWithLayout(t *testing.T) {
+	expected := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	for _, input := range []string{"2019-03-04 05:06:07", "2019-03-04T05:06:07Z"} {
+		v := &ThingWithLegacyTime{}
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"created_at":"`+input+`"}`), v)
+		require.NoError(t, err)
+		require.True(t, expected.Equal(v.CreatedAt), input)
 	}
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, &ThingWithLegacyTime{CreatedAt: expected})
+	require.NoError(t, err)
+	require.Equal(t, `{"created_at":"2019-03-04 05:06:07"}`, string(data))
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"created_at":"03/04/2019"}`), &ThingWithLegacyTime{})
+	require.EqualError(t, err, "Validation Errors: \n/created_at: not a valid time, expected a value like \"2006-01-02 15:04:05\"\n")
+
+	var when time.Time
+	err = TimeWithLayout("100% 2006").Unmarshal(EmptyContext, nil, "2019", reflect.ValueOf(&when).Elem())
+	require.EqualError(t, err, `not a valid time, expected a value like "100% 2006"`)
 }
 
-func TestValidateVariableTypeThing(t *testing.T) {
+func TestUnixTime(t *testing.T) {
+	data := []byte(`{"created":1551675967,"updated":1551675967123}`)
+
+	v := &ThingWithTimestamps{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC), v.Created)
+	require.Equal(t, time.Date(2019, 3, 4, 5, 6, 7, 123000000, time.UTC), v.Updated)
+
+	marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(marshaled))
+
 	expected := `Validation Errors: 
-/inner_thing: invalid type identifier: 'unknown'
+/created: timestamp out of range
+/updated: not a valid Unix timestamp, expected an integer
 `
-	v := &OuterVariableThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"created":9223372036854775807,"updated":"2019-03-04"}`), v, UseNumber())
 	require.EqualError(t, err, expected)
+
+	for _, ts := range []time.Time{
+		{},
+		time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1600, 6, 7, 8, 9, 10, 500000000, time.UTC),
+	} {
+		v := &ThingWithTimestamps{Created: ts, Updated: ts}
+		marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+		require.NoError(t, err)
+
+		roundTripped := &ThingWithTimestamps{}
+		err = TestTypeMapper.Unmarshal(EmptyContext, marshaled, roundTripped, UseNumber())
+		require.NoError(t, err, string(marshaled))
+		require.Equal(t, ts.Truncate(time.Second), roundTripped.Created, string(marshaled))
+		require.Equal(t, ts, roundTripped.Updated, string(marshaled))
+	}
+
+	marshaled, err = TestTypeMapper.Marshal(EmptyContext, &ThingWithTimestamps{})
+	require.NoError(t, err)
+	require.Equal(t, `{"created":-62135596800,"updated":-62135596800000}`, string(marshaled))
 }
 
-func TestValidateVariableTypeWithSwitchFieldValidationError(t *testing.T) {
+func TestDurationInUnits(t *testing.T) {
+	data := []byte(`{"interval":1500000000,"delay_ms":250}`)
+
+	v := &ThingWithIntervals{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.NoError(t, err)
+	require.Equal(t, 1500*time.Millisecond, v.Interval)
+	require.Equal(t, 250*time.Millisecond, v.Delay)
+
+	marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(marshaled))
+
 	expected := `Validation Errors: 
-/inner_type: Value must be one of: ["these","are","allowed"]
-/inner_thing: cannot validate, invalid input for 'inner_type'
+/delay_ms: too long, may not be longer than 1h0m0s
+/interval: not an integer
 `
-	v := &OuterVariableThingInnerTypeOneOf{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"interval":"1s","delay_ms":3600001}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateVariableTypeSwitchFieldNoJsonTag(t *testing.T) {
+func TestBytes(t *testing.T) {
+	v := &ThingWithBlob{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"blob":"3q2+7w==","token":"-_8="}`), v)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, v.Blob)
+	require.Equal(t, []byte{0xfb, 0xff}, v.Token)
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"blob":"3q2+7w==","token":"-_8="}`, string(data))
+
+	data, err = TestTypeMapper.Marshal(EmptyContext, &ThingWithBlob{})
+	require.NoError(t, err)
+	require.Equal(t, `{"blob":null,"token":null}`, string(data))
+
 	expected := `Validation Errors: 
-/inner_type: Value must be one of: ["these","are","allowed"]
-/inner_thing: invalid type identifier
+/blob: too large, may not be more than 4 bytes
+/token: not valid base64
 `
-	v := &OuterVariableThingInnerTypeNoJsonTag{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"blob":"AAAAAAA=","token":"3q2+7w=="}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateVariableTypeSwitchFieldIgnoredJsonTag(t *testing.T) {
+func TestBigNumbers(t *testing.T) {
+	data := []byte(`{"balance":"123456789012345678901234567890","supply":340282366920938463463374607431768211456,"ratio":"0.1"}`)
+
+	v := &ThingWithBigNumbers{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v, UseNumber())
+	require.NoError(t, err)
+	require.Equal(t, "123456789012345678901234567890", v.Balance.String())
+	require.Equal(t, "340282366920938463463374607431768211456", v.Supply.String())
+	require.Equal(t, uint(128), v.Ratio.Prec())
+
+	marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(marshaled))
+
+	marshaled, err = TestTypeMapper.Marshal(EmptyContext, ThingWithBigNumbers{})
+	require.NoError(t, err)
+	require.Equal(t, `{"balance":null,"supply":0,"ratio":null}`, string(marshaled))
+
 	expected := `Validation Errors: 
-/inner_type: Value must be one of: ["these","are","allowed"]
-/inner_thing: invalid type identifier
+/balance: too small, must be at least 0
+/ratio: not a valid number
+/supply: not an integer
 `
-	v := &OuterVariableThingInnerTypeIgnoredJsonTag{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"foo":"bar"}}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"balance":"-1","supply":340282366920938463463374607431768211456,"ratio":"Inf"}`), v)
 	require.EqualError(t, err, expected)
 }
 
-func TestValidateNotAnObject(t *testing.T) {
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`[1, 2, 3]`), v)
-	require.EqualError(t, err, "json: cannot unmarshal, not an object")
-}
+func TestArray(t *testing.T) {
+	data := []byte(`{"box":[-122.5,37.7,-122.3,37.9]}`)
 
-func TestUnmarshalList(t *testing.T) {
-	v := &InnerThing{}
-	err := InnerThingTypeMap.Unmarshal(EmptyContext, nil, []interface{}{}, reflect.ValueOf(v))
-	if err == nil {
-		t.Fatal("Unexpected success")
-	}
-	if err.Error() != "expected an object" {
-		t.Fatal("Unexpected error message:", err.Error())
-	}
+	v := &ThingWithBoundingBox{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.NoError(t, err)
+	require.Equal(t, [4]float64{-122.5, 37.7, -122.3, 37.9}, v.Box)
+
+	marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(marshaled))
+
+	v = &ThingWithBoundingBox{}
+	err = TestTypeMapper.Decode(EmptyContext, bytes.NewReader(data), v)
+	require.NoError(t, err)
+	require.Equal(t, [4]float64{-122.5, 37.7, -122.3, 37.9}, v.Box)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"box":[1,2,3]}`), v)
+	require.EqualError(t, err, "Validation Errors: \n/box: must have 4 elements\n")
+
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader(`{"box":[1,2,3,4,5]}`), v)
+	require.EqualError(t, err, "Validation Errors: \n/box: must have 4 elements\n")
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"box":[1,2,3,200]}`), v)
+	require.EqualError(t, err, "Validation Errors: \n/box/3: not a valid longitude, must be between -180 and 180\n")
 }
 
-func TestUnmarshalMissingRequiredField(t *testing.T) {
+func TestTuple(t *testing.T) {
+	data := []byte(`{"location":[37.7,-122.5],"top":[["a",3],["b",1]]}`)
+
+	v := &ThingWithTuples{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.NoError(t, err)
+	require.Equal(t, GeoPoint{Latitude: 37.7, Longitude: -122.5}, v.Location)
+	require.Equal(t, []LabelCount{{"a", 3}, {"b", 1}}, v.Top)
+
+	marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(marshaled))
+
 	expected := `Validation Errors: 
-/inner_thing: missing required field
+/location: must have 2 elements
+/top/1/1: too large, may not be larger than 100
 `
-	v := &OuterThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"location":[37.7],"top":[["a",3],["b",101]]}`), v)
 	require.EqualError(t, err, expected)
+	require.Equal(t, "ThingWithTuples.Top[1].Count", err.(*MultiValidationError).NestedErrors[1].GoPath)
 }
 
-func TestUnmarshalNonPointer(t *testing.T) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			t.Fatal("No panic")
-		}
-		if r != "cannot unmarshal to non-pointer" {
-			t.Fatal("Incorrect panic message", r)
-		}
-	}()
-	v := InnerThing{}
-	TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), v)
-}
+func TestSetOf(t *testing.T) {
+	data := []byte(`{"tags":["b","a","b","c","a"],"ratings":[5,1],"users":[{"foo":"x","an_int":2},{"foo":"y","an_int":1},{"foo":"x","an_int":2}]}`)
 
-func TestMarshalInnerThing(t *testing.T) {
-	v := &InnerThing{
-		Foo:   "bar",
-		AnInt: 7,
-		ABool: true,
-	}
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != `{"foo":"bar","an_int":7,"a_bool":true}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
-	}
-}
+	v := &ThingWithTags{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "a", "c"}, v.Tags)
+	require.Equal(t, []int64{5, 1}, v.Ratings)
+	require.Len(t, v.Users, 2)
 
-func TestMarshalOuterThing(t *testing.T) {
-	v := &OuterThing{
-		InnerThing: InnerThing{
-			Foo:   "bar",
-			AnInt: 3,
-			ABool: false,
-		},
-	}
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != `{"inner_thing":{"foo":"bar","an_int":3,"a_bool":false}}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
+	marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"tags":["a","b","c"],"ratings":[1,5],"users":[{"foo":"y","an_int":1,"a_bool":false},{"foo":"x","an_int":2,"a_bool":false}]}`, string(marshaled))
+	require.Equal(t, []string{"b", "a", "c"}, v.Tags)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"tags":[],"ratings":[1,1]}`), &ThingWithTags{})
+	require.EqualError(t, err, "Validation Errors: \n/ratings/1: duplicate of element 0\n")
+}
+
+func TestSetOfUnhashableElements(t *testing.T) {
+	values := []interface{}{}
+	partial := []interface{}{
+		[]interface{}{"a"},
+		map[string]interface{}{"k": "v"},
+		[]interface{}{"a"},
+		nil,
+		map[string]interface{}{"k": "v"},
+		nil,
 	}
+	err := SetOf(NewPrimitiveMap(Interface())).Unmarshal(EmptyContext, nil, partial, reflect.ValueOf(&values).Elem())
+	require.NoError(t, err)
+	require.Equal(t, partial[:2], values[:2])
+	require.Len(t, values, 3)
+	require.Nil(t, values[2])
+
+	things := []*InnerThing{}
+	partial = []interface{}{nil, map[string]interface{}{"foo": "a"}, nil}
+	err = SetOf(InnerThingTypeMap).Unmarshal(EmptyContext, nil, partial, reflect.ValueOf(&things).Elem())
+	require.NoError(t, err)
+	require.Len(t, things, 2)
+	require.Nil(t, things[0])
+	require.Equal(t, "a", things[1].Foo)
 }
 
-func TestMarshalOuterPointerThing(t *testing.T) {
-	v := &OuterPointerThing{
-		InnerThing: &InnerThing{
-			Foo:   "bar",
-			AnInt: 3,
-			ABool: false,
-		},
-	}
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != `{"inner_thing":{"foo":"bar","an_int":3,"a_bool":false}}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
+func TestNestedContainers(t *testing.T) {
+	data := []byte(`{"groups":{"a":[{"foo":"x","an_int":1,"a_bool":false}]},"labels":[{"k":"v"}],"pointers":[{"foo":"y","an_int":2,"a_bool":true}],"counts":{"a":{"b":3}}}`)
+
+	v := &ThingWithNestedContainers{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, data, v)
+	require.NoError(t, err)
+	require.Equal(t, []InnerThing{{Foo: "x", AnInt: 1}}, v.Groups["a"])
+	require.Equal(t, []map[string]string{{"k": "v"}}, v.Labels)
+	require.Equal(t, []InnerThing{{Foo: "y", AnInt: 2, ABool: true}}, *v.Pointers)
+	require.Equal(t, map[string]map[string]int64{"a": {"b": 3}}, *v.Counts)
+
+	marshaled, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(marshaled))
+
+	marshaled, err = TestTypeMapper.Marshal(EmptyContext, &ThingWithNestedContainers{})
+	require.NoError(t, err)
+	require.Equal(t, `{"groups":null,"labels":null,"pointers":null,"counts":null}`, string(marshaled))
+
+	expected := `Validation Errors: 
+/counts/a/b: too large, may not be larger than 5
+/groups/a/1/an_int: too large, may not be larger than 10
+/labels/0/k: too long, may not be more than 8 characters
+/pointers/0/foo: not a string
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"groups":{"a":[{},{"an_int":11}]},"labels":[{"k":"much too long"}],"pointers":[{"foo":1}],"counts":{"a":{"b":6}}}`), &ThingWithNestedContainers{})
+	require.EqualError(t, err, expected)
+
+	goPaths := []string{}
+	for _, e := range err.(*MultiValidationError).NestedErrors {
+		goPaths = append(goPaths, e.GoPath)
 	}
+	require.Equal(t, []string{
+		`ThingWithNestedContainers.Counts["a"]["b"]`,
+		`ThingWithNestedContainers.Groups["a"][1].AnInt`,
+		`ThingWithNestedContainers.Labels[0]["k"]`,
+		`ThingWithNestedContainers.Pointers[0].Foo`,
+	}, goPaths)
 }
 
-func TestUnmarshalOuterPointerThingWithNull(t *testing.T) {
-	v := &OuterPointerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": null}`), v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if v.InnerThing != nil {
-		t.Fatal("Expected InnerThing to be nil")
-	}
+func TestNilPolicy(t *testing.T) {
+	data, err := TestTypeMapper.Marshal(EmptyContext, &ThingWithNilPolicies{})
+	require.NoError(t, err)
+	require.Equal(t, `{"tags":[],"inner":null}`, string(data))
+
+	data, err = TestTypeMapper.Marshal(EmptyContext, &ThingWithNilPolicies{Meta: map[string]string{}})
+	require.NoError(t, err)
+	require.Equal(t, `{"tags":[],"meta":{},"inner":null}`, string(data))
+
+	tm := NewTypeMapper(ThingWithNilPoliciesSchema, ThingWithNestedContainersSchema, InnerThingTypeMap)
+	tm.NilPolicy = NilOmitted
+
+	data, err = tm.Marshal(EmptyContext, &ThingWithNilPolicies{})
+	require.NoError(t, err)
+	require.Equal(t, `{"tags":[]}`, string(data))
+
+	tm.NilPolicy = NilAsEmpty
+	data, err = tm.Marshal(EmptyContext, &ThingWithNestedContainers{})
+	require.NoError(t, err)
+	require.Equal(t, `{"groups":{},"labels":[],"pointers":[],"counts":{}}`, string(data))
+
+	// The policy of a field takes precedence
+	tm.NilPolicy = NilAsNull
+	data, err = tm.Marshal(EmptyContext, &ThingWithNilPolicies{})
+	require.NoError(t, err)
+	require.Equal(t, `{"tags":[],"inner":null}`, string(data))
 }
 
-func TestMarshalOuterInterfaceThing(t *testing.T) {
-	v := &OuterInterfaceThing{
-		InnerThing: &InnerThing{
-			Foo:   "bar",
-			AnInt: 3,
-			ABool: false,
+func TestEmptyAsArray(t *testing.T) {
+	tm := NewTypeMapper(StructMap{
+		ThingWithNestedContainers{},
+		[]MappedField{
+			{
+				StructFieldName: "Groups",
+				JSONFieldName:   "groups",
+				Contains:        MapOf(SliceOf(InnerThingTypeMap)),
+				EmptyAsObject:   true,
+			},
+			{
+				StructFieldName: "Labels",
+				JSONFieldName:   "labels",
+				Contains:        SliceOf(MapOf(NewPrimitiveMap(String(1, 8)))),
+				EmptyAsArray:    true,
+			},
+			{
+				StructFieldName: "Pointers",
+				JSONFieldName:   "pointers",
+				Contains:        SliceOf(InnerThingTypeMap),
+				EmptyAsArray:    true,
+			},
+			{
+				StructFieldName: "Counts",
+				JSONFieldName:   "counts",
+				Contains:        MapOf(MapOf(NewPrimitiveMap(Integer(0, 5)))),
+				// Only applies to slices
+				EmptyAsArray: true,
+			},
 		},
-	}
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != `{"inner_thing":{"foo":"bar","an_int":3,"a_bool":false}}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
-	}
+	}, InnerThingTypeMap)
+
+	data, err := tm.Marshal(EmptyContext, &ThingWithNestedContainers{})
+	require.NoError(t, err)
+	require.Equal(t, `{"groups":{},"labels":[],"pointers":[],"counts":null}`, string(data))
+
+	data, err = tm.Marshal(EmptyContext, &ThingWithNestedContainers{
+		Groups: map[string][]InnerThing{"a": nil},
+		Labels: []map[string]string{nil},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `{"groups":{"a":null},"labels":[null],"pointers":[],"counts":null}`, string(data))
 }
 
-func TestUnmarshalOuterInterfaceThing(t *testing.T) {
-	v := &OuterInterfaceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": {"foo":"bar","an_int":3,"a_bool":false}}`), v)
-	if err != nil {
-		t.Fatal(err)
+func TestEncodeArray(t *testing.T) {
+	things := []*InnerThing{
+		{Foo: "a", AnInt: 1},
+		{Foo: "b", ABool: true},
+		{Foo: "c", AnInt: 3},
 	}
+	expected, err := TestTypeMapper.Marshal(EmptyContext, things)
+	require.NoError(t, err)
 
-	innerThing, ok := v.InnerThing.(*InnerThing)
-	if !ok {
-		t.Fatal("InnerThing has an unexpected type")
-	}
+	ch := make(chan *InnerThing)
+	go func() {
+		for _, thing := range things {
+			ch <- thing
+		}
+		close(ch)
+	}()
 
-	if innerThing.Foo != "bar" {
-		t.Fatal("InnerThing.Bar has an unexpected value")
-	}
+	buf := &bytes.Buffer{}
+	err = TestTypeMapper.EncodeArray(EmptyContext, buf, ch)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), buf.String())
 
-	if innerThing.AnInt != 3 {
-		t.Fatal("InnerThing.AnInt has an unexpected value")
-	}
+	empty := make(chan InnerThing)
+	close(empty)
+	buf.Reset()
+	err = TestTypeMapper.EncodeArray(EmptyContext, buf, empty)
+	require.NoError(t, err)
+	require.Equal(t, `[]`, buf.String())
+
+	i := 0
+	next := IteratorFunc(func() (interface{}, error) {
+		i++
+		switch i {
+		case 1:
+			return InnerThing{Foo: "a"}, nil
+		case 2:
+			return nil, nil
+		default:
+			return nil, io.EOF
+		}
+	})
+	buf.Reset()
+	err = TestTypeMapper.EncodeArray(EmptyContext, buf, next)
+	require.NoError(t, err)
+	require.Equal(t, `[{"foo":"a","an_int":0,"a_bool":false},null]`, buf.String())
 
-	if innerThing.ABool != false {
-		t.Fatal("InnerThing.ABool has an unexpected value")
-	}
+	failure := errors.New("connection reset")
+	next = IteratorFunc(func() (interface{}, error) {
+		return nil, failure
+	})
+	err = TestTypeMapper.EncodeArray(EmptyContext, &bytes.Buffer{}, next)
+	require.Equal(t, failure, err)
+
+	require.Panics(t, func() {
+		TestTypeMapper.EncodeArray(EmptyContext, buf, things)
+	})
 }
 
-func TestUnmarshalOuterInterfaceThingWithNull(t *testing.T) {
-	v := &OuterInterfaceThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing": null}`), v)
-	if err != nil {
-		t.Fatal(err)
+func TestLines(t *testing.T) {
+	things := []*InnerThing{
+		{Foo: "a", AnInt: 1},
+		{Foo: "b", ABool: true},
 	}
-	if v.InnerThing != nil {
-		t.Fatal("Expected InnerThing to be nil")
+	ch := make(chan *InnerThing, len(things))
+	for _, thing := range things {
+		ch <- thing
 	}
+	close(ch)
+
+	buf := &bytes.Buffer{}
+	err := TestTypeMapper.EncodeLines(EmptyContext, buf, ch)
+	require.NoError(t, err)
+	require.Equal(t, `{"foo":"a","an_int":1,"a_bool":false}
+{"foo":"b","an_int":0,"a_bool":true}
+`, buf.String())
+
+	input := buf.String() + "\n" + `{"foo":"this is too long"}` + "\n" + `{"foo":` + "\n" + `{"foo":"c"}`
+
+	var decoded []*InnerThing
+	var errs []string
+	err = TestTypeMapper.DecodeLines(EmptyContext, strings.NewReader(input), func() interface{} {
+		return &InnerThing{}
+	}, func(dest interface{}, err error) error {
+		if err != nil {
+			errs = append(errs, err.Error())
+			return nil
+		}
+		decoded = append(decoded, dest.(*InnerThing))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, append(things, &InnerThing{Foo: "c"}), decoded)
+	require.Equal(t, []string{
+		"line 4: Validation Errors: \n/foo: too long, may not be more than 12 characters\n",
+		"line 5: unexpected end of JSON input (line 1, column 7)",
+	}, errs)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = TestTypeMapper.DecodeLines(EmptyContext, strings.NewReader(input), func() interface{} {
+		return &InnerThing{}
+	}, func(dest interface{}, err error) error {
+		calls++
+		return stop
+	})
+	require.Equal(t, stop, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestUnmarshalSlice(t *testing.T) {
+	var things []InnerThing
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`[{"foo":"a","an_int":1},{"foo":"b"}]`), &things)
+	require.NoError(t, err)
+	require.Equal(t, []InnerThing{{Foo: "a", AnInt: 1}, {Foo: "b"}}, things)
+
+	var pointers []*InnerThing
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`[{"foo":"this is too long"},{"an_int":"1"}]`), &pointers)
+	require.EqualError(t, err, `Validation Errors: 
+/0/foo: too long, may not be more than 12 characters
+/1/an_int: not an integer
+`)
+	fe := err.(*MultiValidationError).Errors()[0]
+	require.Equal(t, "[]*jsonmap.InnerThing[0].Foo", fe.GoPath)
+
+	var empty []InnerThing
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`null`), &empty)
+	require.NoError(t, err)
+	require.Nil(t, empty)
+
+	// Like json.Unmarshal(), null replaces any existing elements with nil
+	existing := []InnerThing{{Foo: "x"}}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`null`), &existing)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+
+	existing = []InnerThing{{Foo: "x"}}
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader(`null`), &existing)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo":"a"}`), &empty)
+	require.EqualError(t, err, "json: cannot unmarshal, not a list")
+
+	var decoded []*InnerThing
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader(`[{"foo":"a"}]`), &decoded)
+	require.NoError(t, err)
+	require.Equal(t, []*InnerThing{{Foo: "a"}}, decoded)
+
+	data, err := TestTypeMapper.Marshal(EmptyContext, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, `[{"foo":"a","an_int":0,"a_bool":false}]`, string(data))
 }
 
-func TestMarshalOuterSliceThing(t *testing.T) {
-	v := &OuterSliceThing{
-		InnerThings: []InnerThing{
-			{
-				Foo:   "bar",
-				AnInt: 3,
-				ABool: false,
-			},
-		},
-	}
+func TestCustom(t *testing.T) {
+	v := &ThingWithColors{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"#ff8000","accent":"#000010"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &ThingWithColors{Color: Color{255, 128, 0}, Accent: &Color{0, 0, 16}}, v)
+
 	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != `{"inner_things":[{"foo":"bar","an_int":3,"a_bool":false}]}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
-	}
+	require.NoError(t, err)
+	require.Equal(t, `{"color":"#ff8000","accent":"#000010"}`, string(data))
+
+	v = &ThingWithColors{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"#ff80001","accent":"#zzzzzz"}`), v)
+	require.EqualError(t, err, `Validation Errors: 
+/accent: not a valid color: #zzzzzz
+/color: too long, may not be more than 7 characters
+`)
+	fe := err.(*MultiValidationError).Errors()[0]
+	require.Equal(t, CodeInvalidFormat, fe.Code)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"#ffffff","accent":"#%s%%"}`), &ThingWithColors{})
+	require.EqualError(t, err, "Validation Errors: \n/accent: not a valid color: #%s%%\n")
+
+	v = &ThingWithColors{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"color":"#ffffff","accent":null}`), v)
+	require.NoError(t, err)
+	require.Nil(t, v.Accent)
 
-}
+	data, err = TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"color":"#ffffff","accent":null}`, string(data))
 
-func TestMarshalOuterPointerSliceThing(t *testing.T) {
-	v := &OuterPointerSliceThing{
-		InnerThings: []*InnerThing{
+	require.Empty(t, ThingWithColorsSchema.CheckSchema())
+
+	broken := StructMap{
+		InnerThing{},
+		[]MappedField{
 			{
-				Foo:   "bar",
-				AnInt: 3,
-				ABool: false,
+				StructFieldName: "Foo",
+				JSONFieldName:   "foo",
+				Contains:        Custom(nil),
 			},
 		},
 	}
+	errs := broken.CheckSchema()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "target field for jsonmap.Custom() does not implement json.Unmarshaler")
+}
+
+func TestStringEncoded(t *testing.T) {
+	v := &ThingWithStringIDs{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"id":"9007199254740993","enabled":"true"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &ThingWithStringIDs{ID: 9007199254740993, Enabled: true}, v)
+
 	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
+	require.NoError(t, err)
+	require.Equal(t, `{"id":"9007199254740993","enabled":"true"}`, string(data))
+
+	v = &ThingWithStringIDs{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"id":42,"enabled":false}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &ThingWithStringIDs{ID: 42}, v)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"id":"0","enabled":"yes"}`), v)
+	require.EqualError(t, err, `Validation Errors: 
+/enabled: not a boolean
+/id: too small, must be at least 1
+`)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"id":"1.5","enabled":"[true]"}`), v)
+	require.EqualError(t, err, `Validation Errors: 
+/enabled: not a boolean
+/id: not an integer
+`)
+}
+
+func TestLenient(t *testing.T) {
+	input := `{
+	// The things
+	"inner_things": [
+		{"foo": "a//b", "an_int": 1,},
+		/* disabled: {"foo": "b"}, */
+		{"foo": "c\"/*"}, // trailing
+	],
+}`
+	expected := &OuterSliceThing{
+		InnerThings: []InnerThing{{Foo: "a//b", AnInt: 1}, {Foo: `c"/*`}},
 	}
-	if string(data) != `{"inner_things":[{"foo":"bar","an_int":3,"a_bool":false}]}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
+
+	v := &OuterSliceThing{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(input), v)
+	require.IsType(t, &SyntaxError{}, err)
+
+	v = &OuterSliceThing{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(input), v, Lenient())
+	require.NoError(t, err)
+	require.Equal(t, expected, v)
+
+	v = &OuterSliceThing{}
+	err = TestTypeMapper.Decode(EmptyContext, iotest.OneByteReader(strings.NewReader(input)), v, Lenient())
+	require.NoError(t, err)
+	require.Equal(t, expected, v)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte("{\n  /* ok */ \"foo\": 1 / 2\n}"), &InnerThing{}, Lenient())
+	require.EqualError(t, err, "invalid character '/' after object key:value pair (line 2, column 21)")
+
+	for _, invalid := range []string{`{"inner_things":[,]}`, `{"inner_things":[{},,]}`, `{,}`, `{"inner_things":[] /`} {
+		err = TestTypeMapper.Unmarshal(EmptyContext, []byte(invalid), &OuterSliceThing{}, Lenient())
+		require.IsType(t, &SyntaxError{}, err, invalid)
 	}
 }
 
-func TestMarshalOuterPointerToSliceThing(t *testing.T) {
-	v := &OuterPointerToSliceThing{
-		InnerThings: &[]InnerThing{
-			{
-				Foo:   "bar",
-				AnInt: 3,
-				ABool: false,
-			},
-		},
-	}
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
+func TestTrailingData(t *testing.T) {
+	for _, input := range []string{`{"foo":"a"} garbage`, `{"foo":"a"} {"foo":"b"}`, `{"foo":"a"}}`} {
+		err := TestTypeMapper.Unmarshal(EmptyContext, []byte(input), &InnerThing{})
+		require.EqualError(t, err, "unexpected data after the end of the JSON value", input)
+		require.Equal(t, CodeTrailingData, err.(*ValidationError).Code)
 	}
-	if string(data) != `{"inner_things":[{"foo":"bar","an_int":3,"a_bool":false}]}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
+
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"foo":"a",}`), &InnerThing{})
+	require.IsType(t, &SyntaxError{}, err)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte("{\"foo\":\"a\"}\n\t "), &InnerThing{})
+	require.NoError(t, err)
+
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader(`{"foo":"a"} garbage`), &InnerThing{})
+	require.NoError(t, err)
+
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader(`{"foo":"a"} garbage`), &InnerThing{}, DisallowTrailingData())
+	require.EqualError(t, err, "unexpected data after the end of the JSON value")
+
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader(`{"foo":"a"} {}`), &InnerThing{}, DisallowTrailingData())
+	require.EqualError(t, err, "unexpected data after the end of the JSON value")
+
+	err = TestTypeMapper.Decode(EmptyContext, strings.NewReader("{\"foo\":\"a\"}\n"), &InnerThing{}, DisallowTrailingData())
+	require.NoError(t, err)
+}
+
+func TestDecoder(t *testing.T) {
+	d := TestTypeMapper.NewDecoder(strings.NewReader(`{"foo":"a"} ["not an object"]
+{"foo":"this is too long"}{"foo":"b"}`))
+
+	var things []InnerThing
+	var errs []string
+	for d.More() {
+		v := InnerThing{}
+		if err := d.Decode(EmptyContext, &v); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		things = append(things, v)
 	}
+
+	require.Equal(t, []InnerThing{{Foo: "a"}, {Foo: "b"}}, things)
+	require.Equal(t, []string{
+		"json: cannot unmarshal, not an object",
+		"Validation Errors: \n/foo: too long, may not be more than 12 characters\n",
+	}, errs)
+
+	err := d.Decode(EmptyContext, &InnerThing{})
+	require.Equal(t, io.EOF, err)
 }
 
-func TestMarshalVariableTypeThing(t *testing.T) {
-	{
-		v := &OuterVariableThing{
-			InnerType: "foo",
-			InnerValue: &InnerThing{
-				Foo: "test",
-			},
-		}
+func TestPayloadLimits(t *testing.T) {
+	input := `{"inner_things":[{"foo":"a"},{"foo":"b","an_int":2,"a_bool":true}],"ignored":[1,2,3,"[,,,]"]}`
 
-		data, err := TestTypeMapper.Marshal(EmptyContext, v)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if string(data) != `{"inner_type":"foo","inner_thing":{"foo":"test","an_int":0,"a_bool":false}}` {
-			t.Fatal("Unexpected Marshal output:", string(data))
-		}
+	tests := []struct {
+		opts     []UnmarshalOption
+		expected string
+		code     string
+	}{
+		{[]UnmarshalOption{MaxBytes(int64(len(input)))}, "", ""},
+		{[]UnmarshalOption{MaxBytes(64)}, "payload too large, may not be more than 64 bytes", CodePayloadTooLarge},
+		{[]UnmarshalOption{MaxKeys(3)}, "", ""},
+		{[]UnmarshalOption{MaxKeys(2)}, "too many keys, objects may not have more than 2", CodeTooManyKeys},
+		{[]UnmarshalOption{MaxArrayLen(4)}, "", ""},
+		{[]UnmarshalOption{MaxArrayLen(3)}, "too many elements, arrays may not have more than 3", CodeTooManyElements},
 	}
-	{
-		v := &OuterVariableThing{
-			InnerType: "bar",
-			InnerValue: &OtherInnerThing{
-				Bar: "test",
-			},
-		}
 
-		data, err := TestTypeMapper.Marshal(EmptyContext, v)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if string(data) != `{"inner_type":"bar","inner_thing":{"bar":"test"}}` {
-			t.Fatal("Unexpected Marshal output:", string(data))
+	for _, test := range tests {
+		for _, decode := range []bool{false, true} {
+			var err error
+			if decode {
+				err = TestTypeMapper.Decode(EmptyContext, iotest.HalfReader(strings.NewReader(input)), &OuterSliceThing{}, test.opts...)
+			} else {
+				err = TestTypeMapper.Unmarshal(EmptyContext, []byte(input), &OuterSliceThing{}, test.opts...)
+			}
+			if test.expected == "" {
+				require.NoError(t, err)
+				continue
+			}
+			require.EqualError(t, err, test.expected)
+			require.Equal(t, test.code, err.(*ValidationError).Code)
 		}
 	}
+
+	// Comments are ignored in Lenient() mode
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things":[] /* [1,2] */}`), &OuterSliceThing{}, MaxArrayLen(1), Lenient())
+	require.NoError(t, err)
 }
 
-func TestMarshalVariableTypeThingIntegerInvalid(t *testing.T) {
-	v := &OuterVariableThingInnerTypeOneOf{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"these","inner_thing":15}`), v)
+func TestMarshalReusesBuffers(t *testing.T) {
+	first, err := TestTypeMapper.Marshal(EmptyContext, &OuterThing{InnerThing: InnerThing{Foo: "first"}})
+	require.NoError(t, err)
+	second, err := TestTypeMapper.Marshal(EmptyContext, &OuterThing{InnerThing: InnerThing{Foo: "second", AnInt: 1234567}})
+	require.NoError(t, err)
 
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != `{"inner_type":"these","inner_thing":null}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
+	require.Equal(t, `{"inner_thing":{"foo":"first","an_int":0,"a_bool":false}}`, string(first))
+	require.Equal(t, `{"inner_thing":{"foo":"second","an_int":1234567,"a_bool":false}}`, string(second))
+
+	escaped := StructMap{
+		InnerThing{},
+		[]MappedField{
+			{
+				StructFieldName: "Foo",
+				JSONFieldName:   "<föö>",
+				Validator:       String(0, 12),
+			},
+		},
 	}
+	data, err := escaped.Marshal(EmptyContext, nil, reflect.ValueOf(InnerThing{Foo: "a"}))
+	require.NoError(t, err)
+	b, err := data.MarshalJSON()
+	require.NoError(t, err)
+	require.Equal(t, `{"\u003cföö\u003e":"a"}`, string(b))
 }
 
-func TestMarshalVariableTypeThingIntegerValid(t *testing.T) {
-	v := &OuterVariableThingInnerTypeOneOf{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"these","inner_thing":5}`), v)
+func TestMarshalAppend(t *testing.T) {
+	v := &OuterThing{InnerThing: InnerThing{Foo: "a"}}
+	expected, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
 
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != `{"inner_type":"these","inner_thing":5}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
-	}
+	buf := make([]byte, 0, 256)
+	buf = append(buf, "data: "...)
+	buf, err = TestTypeMapper.MarshalAppend(buf, EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, "data: "+string(expected), string(buf))
+
+	buf, err = TestTypeMapper.MarshalAppend(buf[:0], EmptyContext, []InnerThing{{Foo: "b"}})
+	require.NoError(t, err)
+	require.Equal(t, `[{"foo":"b","an_int":0,"a_bool":false}]`, string(buf))
+
+	buf = append(buf[:0], "unchanged"...)
+	buf, err = TestTypeMapper.MarshalAppend(buf, EmptyContext, &OuterNonMarshalableThing{})
+	require.Error(t, err)
+	require.Equal(t, "unchanged", string(buf))
 }
 
-func TestMarshalVariableTypeThingIntegerValidZeroCase(t *testing.T) {
-	v := &OuterVariableThingInnerTypeOneOf{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"these","inner_thing":0}`), v)
+func TestMapKeys(t *testing.T) {
+	v := &ThingWithKeyedMaps{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"heights":{"1,2":10,"-3,4":20},"names":{"east":"a","west":"b"}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &ThingWithKeyedMaps{
+		Heights: map[Point]int64{{1, 2}: 10, {-3, 4}: 20},
+		Names:   map[Region]string{"east": "a", "west": "b"},
+	}, v)
 
 	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
+	require.NoError(t, err)
+	require.Equal(t, `{"heights":{"-3,4":20,"1,2":10},"names":{"west":"b","east":"a"}}`, string(data))
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"heights":{"1,2":10,"north":20},"names":{}}`), &ThingWithKeyedMaps{})
+	require.EqualError(t, err, `Validation Errors: 
+/heights/north: invalid key: not a valid point
+`)
+	require.Equal(t, CodeInvalidFormat, err.(*MultiValidationError).Errors()[0].Code)
+
+	require.Empty(t, ThingWithKeyedMapsSchema.CheckSchema())
+
+	broken := StructMap{
+		ThingWithIntKeys{},
+		[]MappedField{
+			{
+				StructFieldName: "Counts",
+				JSONFieldName:   "counts",
+				Contains:        MapOf(NewPrimitiveMap(Integer(0, 100))),
+			},
+		},
 	}
-	if string(data) != `{"inner_type":"these","inner_thing":0}` {
-		t.Fatal("Unexpected Marshal output:", string(data))
+	errs := broken.CheckSchema()
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "key must be a string or implement encoding.TextUnmarshaler")
+}
+
+type percentage int
+
+func (p *percentage) UnmarshalText(text []byte) error {
+	if _, err := fmt.Sscanf(string(text), "%d%%", (*int)(p)); err != nil {
+		return errors.New("not a percentage, e.g. 50%")
 	}
+	return nil
 }
 
-func TestMarshalBrokenVariableTypeThing(t *testing.T) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			t.Fatal("No panic")
-		}
-		if r != "no such underlying field: InnerTypeo" {
-			t.Fatal("Incorrect panic message", r)
-		}
-	}()
+func TestKeyErrorsAreNotFormatted(t *testing.T) {
+	_, err := keyFromString(reflect.TypeOf(percentage(0)), "half")
+	require.EqualError(t, err, "not a percentage, e.g. 50%")
 
-	v := &OtherOuterVariableThing{
-		InnerType: "foo",
-		InnerValue: &InnerThing{
-			Foo: "test",
-		},
+	errs := &ValidationError{}
+	collectKeyError(EmptyContext, errs, "half", errors.New("100%d wrong"))
+	require.EqualError(t, errs.Flatten(), "Validation Errors: \n/half: invalid key: 100%d wrong\n")
+}
+
+func TestDynamic(t *testing.T) {
+	v := &ThingWithDynamicPayload{
+		Payload: &OuterThing{InnerThing: InnerThing{Foo: "a"}},
+		Tagged:  InnerThing{Foo: "b"},
 	}
+	data, err := TestTypeMapper.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"payload":{"inner_thing":{"foo":"a","an_int":0,"a_bool":false}},"tagged":{"type":"inner","foo":"b","an_int":0,"a_bool":false}}`, string(data))
+
+	data, err = TestTypeMapper.Marshal(EmptyContext, &ThingWithDynamicPayload{})
+	require.NoError(t, err)
+	require.Equal(t, `{"payload":null,"tagged":null}`, string(data))
 
-	TestTypeMapper.Marshal(EmptyContext, v)
+	v = &ThingWithDynamicPayload{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"tagged":{"type":"outer","inner_thing":{"foo":"c"}}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &OuterThing{InnerThing: InnerThing{Foo: "c"}}, v.Tagged)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"tagged":{"type":"other"}}`), v)
+	require.EqualError(t, err, `Validation Errors: 
+/tagged/type: invalid type identifier: 'other'
+`)
+
+	_, err = TestTypeMapper.Marshal(EmptyContext, &ThingWithDynamicPayload{Payload: time.Time{}})
+	require.EqualError(t, err, "no TypeMap registered for type: time.Time")
+
+	_, err = TestTypeMapper.Marshal(EmptyContext, &ThingWithDynamicPayload{Tagged: &ThingWithColors{}})
+	require.EqualError(t, err, "no type identifier for type: jsonmap.ThingWithColors")
 }
 
-func TestMarshalVariableTypeThingInvalidTypeIdentifier(t *testing.T) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			t.Fatal("No panic")
-		}
-		if r != "variable type serialization error: invalid type identifier: 'wrong'" {
-			t.Fatal("Incorrect panic message", r)
+func TestValidatorWithContains(t *testing.T) {
+	for _, decode := range []bool{false, true} {
+		unmarshal := func(data string, v interface{}, opts ...UnmarshalOption) error {
+			if decode {
+				return TestTypeMapper.Decode(EmptyContext, strings.NewReader(data), v, opts...)
+			}
+			return TestTypeMapper.Unmarshal(EmptyContext, []byte(data), v, opts...)
 		}
-	}()
 
-	v := &OuterVariableThing{
-		InnerType: "wrong",
-		InnerValue: &InnerThing{
-			Foo: "test",
-		},
+		v := &ThingWithCheckedItems{}
+		err := unmarshal(`{"items":[{"foo":"a"}]}`, v)
+		require.NoError(t, err)
+		require.Equal(t, []InnerThing{{Foo: "a"}}, v.Items)
+
+		err = unmarshal(`{"items":[]}`, &ThingWithCheckedItems{})
+		require.EqualError(t, err, "Validation Errors: \n/items: must not be empty\n")
+
+		// Contains only sees values which pass the Validator
+		err = unmarshal(`{"items":{"foo":"this is too long"}}`, &ThingWithCheckedItems{})
+		require.EqualError(t, err, "Validation Errors: \n/items: expected a list\n")
+
+		err = unmarshal(`{"items":[{"foo":"this is too long"}]}`, &ThingWithCheckedItems{})
+		require.EqualError(t, err, "Validation Errors: \n/items/0/foo: too long, may not be more than 12 characters\n")
+
+		var warnings []*FlattenedPathError
+		v = &ThingWithCheckedItems{}
+		err = unmarshal(`{"items":[]}`, v, Downgrade(CodeTooFewElements), Warnings(&warnings))
+		require.NoError(t, err)
+		require.Len(t, warnings, 1)
+		require.Equal(t, "must not be empty", warnings[0].Message)
 	}
+}
+
+func TestPrimitiveConversion(t *testing.T) {
+	v := &ThingWithNarrowNumbers{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"counts":[1,2],"levels":{"a":-5},"latitudes":[45.5],"regions":["west"]}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &ThingWithNarrowNumbers{
+		Counts:    []int{1, 2},
+		Levels:    map[string]int8{"a": -5},
+		Latitudes: []float32{45.5},
+		Regions:   []Region{"west"},
+	}, v)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"levels":{"a":127,"b":128,"c":-129}}`), &ThingWithNarrowNumbers{})
+	require.EqualError(t, err, `Validation Errors: 
+/levels/b: out of range
+/levels/c: out of range
+`)
+	require.Equal(t, CodeOutOfRange, err.(*MultiValidationError).Errors()[0].Code)
+
+	_, err = convertPrimitive(int64(-1), reflect.TypeOf(uint(0)))
+	require.EqualError(t, err, "out of range")
+	_, err = convertPrimitive(1e40, reflect.TypeOf(float32(0)))
+	require.EqualError(t, err, "out of range")
+	_, err = convertPrimitive(1.5, reflect.TypeOf(0))
+	require.EqualError(t, err, "not an integer")
+	_, err = convertPrimitive("1", reflect.TypeOf(0))
+	require.EqualError(t, err, "cannot store string in a field of type int")
+	_, err = convertPrimitive([]interface{}{"a"}, reflect.TypeOf([]string{}))
+	require.EqualError(t, err, "cannot store []interface {} in a field of type []string")
+
+	var strs []string
+	err = NewPrimitiveMap(Interface()).Unmarshal(EmptyContext, nil, []interface{}{"a"}, reflect.ValueOf(&strs).Elem())
+	require.IsType(t, &SchemaError{}, err)
+	require.Nil(t, strs)
+}
+
+func TestVariableTypeWithDefault(t *testing.T) {
+	tm := NewTypeMapper(OuterVariableThingWithDefaultTypeMap, InnerThingTypeMap)
+
+	v := &OtherOuterVariableThing{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"inner_type":"foo","inner_thing":{"foo":"a"}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &InnerThing{Foo: "a"}, v.InnerValue)
+
+	v = &OtherOuterVariableThing{}
+	err = tm.Unmarshal(EmptyContext, []byte(`{"inner_type":"unknown","inner_thing":{"anything":[1,2]}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"anything": []interface{}{1.0, 2.0}}, v.InnerValue)
+
+	data, err := tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"inner_type":"unknown","inner_thing":{"anything":[1,2]}}`, string(data))
 
-	TestTypeMapper.Marshal(EmptyContext, v)
+	require.Empty(t, OuterVariableThingWithDefaultTypeMap.CheckSchema())
 }
 
-func TestMarshalNoSuchStructField(t *testing.T) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			t.Fatal("No panic")
-		}
-		if r != "no such underlying field: Incorrect" {
-			t.Fatal("Incorrect panic message", r)
-		}
-	}()
-	v := &TypoedThing{
-		Correct: false,
-	}
-	TestTypeMapper.Marshal(EmptyContext, v)
+func TestVariableTypeFieldOrder(t *testing.T) {
+	tm := NewTypeMapper(ReorderedVariableThingTypeMap, InnerThingTypeMap, OtherInnerThingTypeMap)
+
+	v := &ReorderedVariableThing{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"inner_thing":{"bar":"a"},"inner_type":"bar"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "bar", v.InnerType)
+	require.Equal(t, &OtherInnerThing{Bar: "a"}, v.InnerValue)
+
+	v = &ReorderedVariableThing{}
+	err = tm.Decode(EmptyContext, strings.NewReader(`{"inner_type":"foo","inner_thing":{"foo":"b"}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &InnerThing{Foo: "b"}, v.InnerValue)
+
+	expected := `Validation Errors: 
+/inner_thing: cannot validate, missing 'inner_type'
+/inner_type: missing required field
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"inner_thing":{"foo":"b"}}`), &ReorderedVariableThing{})
+	require.EqualError(t, err, expected)
+
+	err = tm.Decode(EmptyContext, strings.NewReader(`{"inner_thing":{"foo":"b"}}`), &ReorderedVariableThing{})
+	require.EqualError(t, err, expected)
+
+	expected = `Validation Errors: 
+/inner_thing: invalid type identifier
+/inner_type: not a string
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"inner_thing":{"foo":"b"},"inner_type":5}`), &ReorderedVariableThing{})
+	require.EqualError(t, err, expected)
 }
 
-func TestUnmarshalNoSuchStructField(t *testing.T) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			t.Fatal("No panic")
-		}
-		if r != "no such underlying field: Incorrect" {
-			t.Fatal("Incorrect panic message", r)
-		}
-	}()
-	v := &TypoedThing{}
-	TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"correct": false}`), v)
+func TestContextType(t *testing.T) {
+	tm := NewTypeMapper(VersionedThingSchema, InnerThingTypeMap, OtherInnerThingTypeMap)
+
+	v := &VersionedThing{}
+	err := tm.Unmarshal(Context("v1"), []byte(`{"body":{"foo":"a"}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &InnerThing{Foo: "a"}, v.Body)
+
+	data, err := tm.Marshal(Context("v1"), v)
+	require.NoError(t, err)
+	require.Equal(t, `{"body":{"foo":"a","an_int":0,"a_bool":false}}`, string(data))
+
+	v = &VersionedThing{}
+	err = tm.Decode(Context("v2"), strings.NewReader(`{"body":{"bar":"b"}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &OtherInnerThing{Bar: "b"}, v.Body)
+
+	expected := `Validation Errors: 
+/body: invalid type identifier: 'v3', must be one of: v1, v2
+`
+	err = tm.Unmarshal(Context("v3"), []byte(`{"body":{"foo":"a"}}`), &VersionedThing{})
+	require.EqualError(t, err, expected)
+
+	require.Empty(t, VersionedThingSchema.CheckSchema())
 }
 
-func TestUnmarshalInvalidJSON(t *testing.T) {
-	v := &InnerThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"this is": "definitely invalid JSON]`), v)
-	if err == nil {
-		t.Fatal("Unexpected success")
-	}
-	if err.Error() != "unexpected end of JSON input" {
-		t.Fatal("Unexpected error message:", err.Error())
-	}
+func TestInlineType(t *testing.T) {
+	tm := NewTypeMapper(ThingWithPetSchema, DogSchema, CatSchema)
+
+	v := &ThingWithPet{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"pet":{"barks":true,"type":"dog"}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &Dog{Barks: true}, v.Pet)
+
+	data, err := tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"pet":{"type":"dog","barks":true}}`, string(data))
+
+	v = &ThingWithPet{}
+	err = tm.Decode(EmptyContext, strings.NewReader(`{"pet":{"type":"cat","lives":9}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &Cat{Kind: "cat", Lives: 9}, v.Pet)
+
+	data, err = tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"pet":{"type":"cat","lives":9}}`, string(data))
+
+	expected := `Validation Errors: 
+/pet/type: invalid type identifier: 'fish', must be one of: cat, dog
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"pet":{"type":"fish"}}`), &ThingWithPet{})
+	require.EqualError(t, err, expected)
+
+	require.Empty(t, ThingWithPetSchema.CheckSchema())
 }
 
-func TestMarshalNonMarshalableThing(t *testing.T) {
-	v := &OuterNonMarshalableThing{}
-	_, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err == nil {
-		t.Fatal("Unexpected success")
-	}
-	if err.Error() != "json: error calling MarshalJSON for type jsonmap.NonMarshalableType: oops" {
-		t.Fatal(err.Error())
-	}
+func TestOneOfTypes(t *testing.T) {
+	tm := NewTypeMapper(ThingWithUntaggedPetSchema, DogSchema, CatSchema)
+
+	v := &ThingWithUntaggedPet{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"pet":{"type":"tabby","lives":3}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &Cat{Kind: "tabby", Lives: 3}, v.Pet)
+
+	data, err := tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"pet":{"type":"tabby","lives":3}}`, string(data))
+
+	v = &ThingWithUntaggedPet{}
+	err = tm.Decode(EmptyContext, strings.NewReader(`{"pet":{"barks":true}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &Dog{Barks: true}, v.Pet)
+
+	expected := `Validation Errors: 
+/pet: did not match any variant
+/pet/barks: missing required field
+/pet/lives: too large, may not be larger than 9
+/pet/type: missing required field
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"pet":{"lives":10}}`), &ThingWithUntaggedPet{})
+	require.EqualError(t, err, expected)
+
+	// Errors from rejected variants don't count towards MaxErrors(), and a
+	// value matching no variant counts once
+	err = tm.Unmarshal(EmptyContext, []byte(`{"pet":{"lives":10}}`), &ThingWithUntaggedPet{}, MaxErrors(1))
+	require.EqualError(t, err, expected)
+	err = tm.Unmarshal(EmptyContext, []byte(`{"pet":{"barks":true,"lives":10}}`), &ThingWithUntaggedPet{}, MaxErrors(1))
+	require.NoError(t, err)
+
+	expected = `Validation Errors: 
+/pet: ambiguous, matched 2 variants
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"pet":{"barks":true,"type":"tabby","lives":3}}`), &ThingWithUntaggedPet{})
+	require.EqualError(t, err, expected)
+	require.Equal(t, CodeAmbiguousVariant, err.(*MultiValidationError).Errors()[0].Code)
+
+	require.Empty(t, ThingWithUntaggedPetSchema.CheckSchema())
+}
+
+func TestNestedVariableType(t *testing.T) {
+	tm := NewTypeMapper(ClassifiedThingSchema, DogSchema, CatSchema, InnerThingTypeMap)
+
+	v := &ClassifiedThing{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"value":{"barks":true},"category":"animal","subcategory":"dog"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &Dog{Barks: true}, v.Value)
+
+	data, err := tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"value":{"barks":true},"category":"animal","subcategory":"dog"}`, string(data))
+
+	v = &ClassifiedThing{}
+	err = tm.Decode(EmptyContext, strings.NewReader(`{"value":{"foo":"a"},"category":"other"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &InnerThing{Foo: "a"}, v.Value)
+
+	expected := `Validation Errors: 
+/value: 'animal': invalid type identifier: 'fish', must be one of: cat, dog
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"value":{},"category":"animal","subcategory":"fish"}`), &ClassifiedThing{})
+	require.EqualError(t, err, expected)
+	require.Equal(t, []string{"animal"}, err.(*MultiValidationError).Errors()[0].Params["path"])
+
+	expected = `Validation Errors: 
+/value: 'animal': cannot validate, missing 'subcategory'
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"value":{},"category":"animal"}`), &ClassifiedThing{})
+	require.EqualError(t, err, expected)
+	require.Empty(t, ClassifiedThingSchema.CheckSchema())
+}
+
+func TestRegisterVariant(t *testing.T) {
+	vt := VariableType("InnerType", map[string]TypeMap{
+		"foo": InnerThingTypeMap,
+	}).(*Discriminator)
+	vt.RegisterVariant("bar", OtherInnerThingTypeMap)
+
+	tm := NewTypeMapper(StructMap{
+		ReorderedVariableThing{},
+		[]MappedField{
+			{
+				StructFieldName: "InnerType",
+				JSONFieldName:   "inner_type",
+				Validator:       String(1, 255),
+			},
+			{
+				StructFieldName: "InnerValue",
+				JSONFieldName:   "inner_thing",
+				Contains:        vt,
+			},
+		},
+	})
+
+	v := &ReorderedVariableThing{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"inner_type":"bar","inner_thing":{"bar":"a"}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &OtherInnerThing{Bar: "a"}, v.InnerValue)
+
+	require.PanicsWithValue(t, "variant already registered: foo", func() {
+		vt.RegisterVariant("foo", OtherInnerThingTypeMap)
+	})
+
+	empty := &Discriminator{PropertyName: "InnerType"}
+	empty.RegisterVariant("foo", InnerThingTypeMap)
+	require.Contains(t, empty.Mapping, "foo")
 }
 
-func TestMarshalSliceOfNonMarshalableThing(t *testing.T) {
-	v := []OuterNonMarshalableThing{
-		{},
-	}
-	_, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err == nil {
-		t.Fatal("Unexpected success")
-	}
-	if err.Error() != "json: error calling MarshalJSON for type jsonmap.NonMarshalableType: oops" {
-		t.Fatal(err.Error())
-	}
+func TestEnvelope(t *testing.T) {
+	tm := NewTypeMapper(EnvelopeOf("type", "payload", map[string]TypeMap{
+		"dog": DogSchema,
+		"cat": CatSchema,
+	}))
+
+	v := &Envelope{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"payload":{"barks":true},"type":"dog"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &Envelope{Type: "dog", Payload: &Dog{Barks: true}}, v)
+
+	data, err := tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"dog","payload":{"barks":true}}`, string(data))
+
+	expected := `Validation Errors: 
+/payload: invalid type identifier: 'fish', must be one of: cat, dog
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"type":"fish","payload":{}}`), &Envelope{})
+	require.EqualError(t, err, expected)
+
+	require.Empty(t, tm.CheckSchema())
 }
 
-func TestMarshalIndent(t *testing.T) {
-	v := &OuterThing{
-		InnerThing: InnerThing{
-			Foo:   "bar",
-			AnInt: 3,
-			ABool: false,
-		},
-	}
-	expected := "{\n" +
-		"    \"inner_thing\": {\n" +
-		"        \"foo\": \"bar\",\n" +
-		"        \"an_int\": 3,\n" +
-		"        \"a_bool\": false\n" +
-		"    }\n" +
-		"}"
-	data, err := TestTypeMapper.MarshalIndent(EmptyContext, v, "", "    ")
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != expected {
-		t.Fatal("Unexpected Marshal output:", string(data), expected)
-	}
+func TestVariableTypeSliceElements(t *testing.T) {
+	tm := NewTypeMapper(ThingWithPetsSchema, DogSchema, CatSchema)
+
+	v := &ThingWithPets{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"pets":[{"type":"dog","barks":true},{"type":"cat","lives":2}]}`), v)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{&Dog{Barks: true}, &Cat{Kind: "cat", Lives: 2}}, v.Pets)
+
+	data, err := tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"pets":[{"type":"dog","barks":true},{"type":"cat","lives":2}]}`, string(data))
+
+	expected := `Validation Errors: 
+/pets/1/lives: too large, may not be larger than 9
+/pets/2/type: invalid type identifier: 'fish', must be one of: cat, dog
+`
+	input := `{"pets":[{"type":"dog","barks":true},{"type":"cat","lives":10},{"type":"fish"}]}`
+	err = tm.Unmarshal(EmptyContext, []byte(input), &ThingWithPets{})
+	require.EqualError(t, err, expected)
+
+	err = tm.Decode(EmptyContext, strings.NewReader(input), &ThingWithPets{})
+	require.EqualError(t, err, expected)
+
+	require.Empty(t, ThingWithPetsSchema.CheckSchema())
 }
 
-func TestMarshalSlice(t *testing.T) {
-	v := []InnerThing{
-		{
-			Foo:   "bar",
-			AnInt: 3,
-			ABool: false,
-		},
-		{
-			Foo:   "bam",
-			AnInt: 4,
-			ABool: true,
+func TestDiscriminatorAliases(t *testing.T) {
+	vt := InlineType("type", map[string]TypeMap{
+		"dog": DogSchema,
+		"cat": CatSchema,
+	}).(*Discriminator).Alias("dog", "puppy", "hound")
+	schema := StructMap{
+		ThingWithPet{},
+		[]MappedField{
+			{
+				StructFieldName: "Pet",
+				JSONFieldName:   "pet",
+				Contains:        vt,
+			},
 		},
 	}
-	expected := `[{"foo":"bar","an_int":3,"a_bool":false},{"foo":"bam","an_int":4,"a_bool":true}]`
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != expected {
-		t.Fatal("Unexpected Marshal output:", string(data), expected)
-	}
+	tm := NewTypeMapper(schema, DogSchema, CatSchema)
+
+	v := &ThingWithPet{}
+	err := tm.Unmarshal(EmptyContext, []byte(`{"pet":{"type":"puppy","barks":true}}`), v)
+	require.NoError(t, err)
+	require.Equal(t, &Dog{Barks: true}, v.Pet)
+
+	data, err := tm.Marshal(EmptyContext, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"pet":{"type":"dog","barks":true}}`, string(data))
+
+	expected := `Validation Errors: 
+/pet/type: invalid type identifier: 'fish', must be one of: cat, dog, hound, puppy
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{"pet":{"type":"fish"}}`), &ThingWithPet{})
+	require.EqualError(t, err, expected)
+
+	require.Empty(t, schema.CheckSchema())
+
+	vt.Alias("fish", "goldfish")
+	require.Len(t, schema.CheckSchema(), 1)
+	require.EqualError(t, schema.CheckSchema()[0], "alias goldfish refers to an unknown type identifier: fish")
 }
 
-func TestMarshalSliceOfPointers(t *testing.T) {
-	v := []*InnerThing{
-		&InnerThing{
-			Foo:   "bar",
-			AnInt: 3,
-			ABool: false,
-		},
-		&InnerThing{
-			Foo:   "bam",
-			AnInt: 4,
-			ABool: true,
-		},
+func TestMarshalVariableTypeDerivesTypeIdentifier(t *testing.T) {
+	v := &OuterVariableThing{
+		InnerValue: &OtherInnerThing{Bar: "x"},
 	}
-	expected := `[{"foo":"bar","an_int":3,"a_bool":false},{"foo":"bam","an_int":4,"a_bool":true}]`
 	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != expected {
-		t.Fatal("Unexpected Marshal output:", string(data), expected)
-	}
-}
+	require.NoError(t, err)
+	require.Equal(t, `{"inner_type":"bar","inner_thing":{"bar":"x"}}`, string(data))
+	require.Equal(t, "", v.InnerType)
 
-func TestMarshalTemplatableThing(t *testing.T) {
-	ctx := struct {
-		Foo string
-	}{
-		Foo: "foo",
-	}
+	// InnerThingTypeMap is used for both "foo" and "allowed"
+	_, err = TestTypeMapper.Marshal(EmptyContext, &OuterVariableThingInnerTypeOneOf{
+		InnerValue: &InnerThing{Foo: "x"},
+	})
+	require.EqualError(t, err, "variable type serialization error: cannot validate, invalid input for 'inner_type'")
+}
 
-	v := &TemplatableThing{
-		SomeField: "bar",
-	}
+func TestUnmarshalIncludeValuesRedaction(t *testing.T) {
+	expected := `Validation Errors: 
+/password: got number, expected string
+/username: got number 5, expected string
+`
+	v := &Credentials{}
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"username":5,"password":1234}`), v, IncludeValues())
+	require.EqualError(t, err, expected)
+	errs := err.(*MultiValidationError).Errors()
+	require.NotContains(t, errs[0].Params, "value")
+	require.Equal(t, 5.0, errs[1].Params["value"])
 
-	expected := `{"some_field":"foo:bar"}`
-	data, err := TestTypeMapper.Marshal(ctx, v)
-	if err != nil {
-		t.Fatal(err)
-	}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"username":"`+strings.Repeat("a", 100)+`","password":"`+strings.Repeat("b", 100)+`"}`), v, IncludeValues())
+	errs = err.(*MultiValidationError).Errors()
+	require.NotContains(t, errs[0].Params, "value")
+	require.Equal(t, strings.Repeat("a", 64)+"...", errs[1].Params["value"])
 
-	if string(data) != expected {
-		t.Fatal("Unexpected Marshal output:", string(data), expected)
-	}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"username":{"a":"`+strings.Repeat("a", 100)+`"},"password":"x"}`), v, IncludeValues())
+	require.Contains(t, err.Error(), `/username: got object {"a":"aaaaaaaa`)
+	require.Contains(t, err.Error(), `..., expected string`)
 }
 
-func TestMarshalThingWithSliceOfPrimitives(t *testing.T) {
-	v := ThingWithSliceOfPrimitives{
-		Strings: []string{"foo", "bar"},
+func TestQueryDecodeErrorRedaction(t *testing.T) {
+	qm := QueryMap{
+		UnderlyingType: requestFilter{},
+		ParameterMaps: []ParameterMap{
+			{
+				StructFieldName: "UUID",
+				ParameterName:   "uuid",
+				Mapper: StringQueryParameterMapper{
+					[]func(string) bool{
+						StringRegexValidator(uuidRegex),
+					},
+				},
+				Sensitive: true,
+			},
+			{
+				StructFieldName: "Search",
+				ParameterName:   "search",
+				Mapper: StringQueryParameterMapper{
+					[]func(string) bool{
+						StringRangeValidator(1, 10),
+					},
+				},
+			},
+		},
 	}
 
-	expected := `{"strings":["foo","bar"]}`
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != expected {
-		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	urlQuery := url.Values{
+		"uuid":   {"secret"},
+		"search": {strings.Repeat("x", 100)},
 	}
+	err := qm.Decode(urlQuery, &requestFilter{})
+	require.EqualError(t, err, "Validation Errors: \n"+
+		"/search: a validation test failed\n"+
+		"/uuid: invalid value\n")
+	require.NotContains(t, err.Error(), "secret")
+	errs := err.(*MultiValidationError).Errors()
+	require.Equal(t, []string{strings.Repeat("x", 64) + "..."}, errs[0].Params["value"])
+	require.NotContains(t, errs[1].Params, "value")
+}
+
+func TestQueryDecodeErrorPaths(t *testing.T) {
+	urlQuery, _ := url.ParseQuery(`age=old&name=Spot`)
+	err := dogParamMap.Decode(urlQuery, &dogStruct{})
+	require.EqualError(t, err, `Validation Errors: 
+/age: param could not be converted to integer: strconv.ParseInt: parsing "old": invalid syntax
+`)
+
+	errs := err.(*MultiValidationError).Errors()
+	require.Equal(t, "/age", errs[0].Path)
+	require.Equal(t, "Age", errs[0].GoPath)
+	require.Equal(t, CodeInvalidFormat, errs[0].Code)
+	require.Equal(t, []string{"old"}, errs[0].Params["value"])
+
+	header := http.Header{}
+	header.Set("is_dead", "maybe")
+	err = dogParamMap.DecodeHeader(header, &dogStruct{})
+	errs = err.(*MultiValidationError).Errors()
+	require.Equal(t, "/is_dead", errs[0].Path)
+	require.Equal(t, CodeInvalidFormat, errs[0].Code)
 }
 
-func TestMarshalThingWithNilSliceOfPrimitives(t *testing.T) {
-	v := ThingWithSliceOfPrimitives{}
+func TestUnwrapContext(t *testing.T) {
+	ctx := Context("ctx")
+	require.Equal(t, ctx, UnwrapContext(ctx))
+	require.Equal(t, ctx, UnwrapContext(&unmarshalState{Context: ctx}))
+}
 
-	expected := `{"strings":null}`
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != expected {
-		t.Fatal("Unexpected Marshal output:", string(data), expected)
-	}
+type requestContext struct {
+	user string
 }
 
-func TestValidateThingWithSliceOfPrimitives(t *testing.T) {
-	original := `{"strings":["foo","bar"]}`
-	v := &ThingWithSliceOfPrimitives{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
-	if err != nil {
-		t.Fatal(err)
-	}
+// contextAssertingMap is a custom TypeMap which requires the Context passed
+// by the caller.
+type contextAssertingMap struct{}
 
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != original {
-		t.Fatal("Unoriginal Marshal output:", string(data), original)
-	}
+func (contextAssertingMap) Unmarshal(ctx Context, parent *reflect.Value, partial interface{}, dstValue reflect.Value) error {
+	dstValue.SetString(ctx.(*requestContext).user)
+	return nil
 }
 
-func TestValidateOuterMapThingNotAMap(t *testing.T) {
-	expected := `Validation Errors: 
-/inner_map: expected a map
-`
+func (contextAssertingMap) Marshal(ctx Context, parent *reflect.Value, src reflect.Value) (json.Marshaler, error) {
+	data, err := json.Marshal(ctx.(*requestContext).user)
+	return RawMessage{data}, err
+}
 
-	v := &OuterMapThing{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_map": 3}`), v)
-	require.EqualError(t, err, expected)
+type ThingWithOwner struct {
+	Owner string
 }
 
-func TestMarshalThingWithMapOfInterfaces(t *testing.T) {
-	interfaces := map[string]interface{}{
-		"foo": "bar",
-		"baz": 10,
-		"qux": []string{"dang"},
-	}
+func TestContextNotWrapped(t *testing.T) {
+	tm := NewTypeMapper(StructMap{
+		ThingWithOwner{},
+		[]MappedField{
+			{
+				StructFieldName: "Owner",
+				JSONFieldName:   "owner",
+				Contains:        contextAssertingMap{},
+			},
+		},
+	})
+	ctx := &requestContext{user: "alice"}
 
-	v := ThingWithMapOfInterfaces{
-		Interfaces: interfaces,
-	}
+	v := &ThingWithOwner{}
+	err := tm.Unmarshal(ctx, []byte(`{"owner":"bob"}`), v)
+	require.NoError(t, err)
+	require.Equal(t, "alice", v.Owner)
 
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
+	data, err := tm.Marshal(ctx, v)
+	require.NoError(t, err)
+	require.Equal(t, `{"owner":"alice"}`, string(data))
+}
 
-	expected, err := json.Marshal(map[string]interface{}{"interfaces": interfaces})
-	if err != nil {
-		t.Fatal(err)
+func TestValidationErrorPaths(t *testing.T) {
+	v := OuterSliceThing{}
+	partial := map[string]interface{}{
+		"inner_things": []interface{}{
+			map[string]interface{}{"foo": "toooooooolong"},
+			5.0,
+		},
 	}
+	err := OuterSliceThingTypeMap.Unmarshal(EmptyContext, nil, partial, reflect.ValueOf(&v).Elem())
+	require.EqualError(t, err, "/inner_things/0/foo: too long, may not be more than 12 characters\n/inner_things/1: expected an object\n")
 
-	if string(data) != string(expected) {
-		t.Fatal("unexpected Marshal output", string(data), string(expected))
-	}
-}
+	expected := `Validation Errors: 
+/inner_thing_map/a~1b~0c/foo: too long, may not be more than 12 characters
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing_map":{"a/b~c":{"foo":"toooooooolong"}}}`), &OuterInnerThingMap{})
+	require.EqualError(t, err, expected)
 
-func TestValidateThingWithMapOfInterfaces(t *testing.T) {
-	original := `{"interfaces":{"baz":10,"dux":null,"foo":"bar","qux":["dang"]}}`
-	v := &ThingWithMapOfInterfaces{}
-	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(original), v)
-	if err != nil {
-		t.Fatal(err)
-	}
+	expected = `Validation Errors: 
+/inner_thing: invalid type identifier: 'baz', must be one of: bar, foo
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"baz","inner_thing":{}}`), &OuterVariableThing{})
+	require.EqualError(t, err, expected)
 
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != original {
-		t.Fatal("Unoriginal Marshal output:", string(data), original)
-	}
+	expected = `Validation Errors: 
+/inner_thing/foo: too long, may not be more than 12 characters
+`
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_type":"foo","inner_thing":{"foo":"toooooooolong"}}`), &OuterVariableThing{})
+	require.EqualError(t, err, expected)
 }
 
-func TestMarshalThingWithTime(t *testing.T) {
-	ts, err := time.Parse(time.RFC822, time.RFC822)
-	if err != nil {
-		panic(err)
+func TestUnmarshalErrorFormatter(t *testing.T) {
+	tm := NewTypeMapper(OuterThingTypeMap, InnerThingTypeMap)
+	tm.ErrorFormatter = func(code string, params map[string]interface{}) string {
+		switch code {
+		case CodeTooLong:
+			return fmt.Sprintf("please use %v characters or fewer", params["max"])
+		case CodeInvalidJSON:
+			return "that doesn't look like JSON"
+		}
+		return ""
 	}
 
-	v := ThingWithTime{
-		HappenedAt: ts,
-	}
+	expected := `Validation Errors: 
+/inner_thing/foo: please use 12 characters or fewer
+`
+	err := tm.Unmarshal(EmptyContext, []byte(`{"inner_thing":{"foo":"toooooooolong"}}`), &OuterThing{})
+	require.EqualError(t, err, expected)
 
-	expected := `{"happened_at":"2006-01-02T15:04:00Z"}`
-	data, err := TestTypeMapper.Marshal(EmptyContext, v)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if string(data) != expected {
-		t.Fatal("Unexpected Marshal output:", string(data), expected)
+	expected = `Validation Errors: 
+/inner_thing: missing required field
+`
+	err = tm.Unmarshal(EmptyContext, []byte(`{}`), &OuterThing{})
+	require.EqualError(t, err, expected)
+
+	err = tm.Unmarshal(EmptyContext, []byte(`{`), &OuterThing{})
+	require.EqualError(t, err, "that doesn't look like JSON (line 1, column 1)")
+	require.Equal(t, CodeInvalidJSON, err.(*SyntaxError).Code)
+}
+
+func TestUnmarshalWithLocale(t *testing.T) {
+	tm := NewTypeMapper(OuterThingTypeMap, InnerThingTypeMap)
+	tm.Catalog = MessageCatalog{
+		"de": {
+			CodeTooLong:              "zu lang, höchstens {max} Zeichen",
+			CodeMissingRequiredField: "Pflichtfeld fehlt",
+			CodeInvalidJSON:          "ungültiges JSON in Zeile {line}",
+		},
+		"fr": {
+			CodeTooLong: "trop long, {max} caractères maximum",
+		},
 	}
+
+	data := []byte(`{"inner_thing":{"foo":"toooooooolong"}}`)
+
+	err := tm.Unmarshal(EmptyContext, data, &OuterThing{})
+	require.EqualError(t, err, "Validation Errors: \n/inner_thing/foo: too long, may not be more than 12 characters\n")
+
+	err = tm.Unmarshal(WithLocale(EmptyContext, "de-CH"), data, &OuterThing{})
+	require.EqualError(t, err, "Validation Errors: \n/inner_thing/foo: zu lang, höchstens 12 Zeichen\n")
+
+	err = tm.Unmarshal(WithLocale(EmptyContext, "ja"), data, &OuterThing{})
+	require.EqualError(t, err, "Validation Errors: \n/inner_thing/foo: too long, may not be more than 12 characters\n")
+
+	err = tm.Unmarshal(WithLocale(EmptyContext, "de"), []byte("{\n\"inner_thing\": }"), &OuterThing{})
+	require.EqualError(t, err, "ungültiges JSON in Zeile 2 (line 2, column 16)")
+
+	// The same errors can be rendered in several languages
+	err = tm.Unmarshal(EmptyContext, data, &OuterThing{})
+	me := err.(*MultiValidationError)
+	require.EqualError(t, me.Localize(tm.Catalog, "fr"), "Validation Errors: \n/inner_thing/foo: trop long, 12 caractères maximum\n")
+	require.EqualError(t, me.Localize(tm.Catalog, "de"), "Validation Errors: \n/inner_thing/foo: zu lang, höchstens 12 Zeichen\n")
+	require.EqualError(t, me, "Validation Errors: \n/inner_thing/foo: too long, may not be more than 12 characters\n")
+
+	ctx := WithLocale("ctx", "de")
+	require.Equal(t, "de", LocaleFromContext(ctx))
+	require.Equal(t, Context("ctx"), UnwrapContext(ctx))
 }
 
-func TestUnmarshalThingWithTime(t *testing.T) {
-	ts, err := time.Parse(time.RFC822, time.RFC822)
-	if err != nil {
-		panic(err)
-	}
+func TestValidationErrorGoPaths(t *testing.T) {
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_things":[{"foo":"ok"},{"foo":"toooooooolong"}]}`), &OuterSliceThing{})
+	errs := err.(*MultiValidationError).Errors()
+	require.Len(t, errs, 1)
+	require.Equal(t, "/inner_things/1/foo", errs[0].Path)
+	require.Equal(t, "OuterSliceThing.InnerThings[1].Foo", errs[0].GoPath)
 
-	v := &ThingWithTime{}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"inner_thing_map":{"a/b":{"foo":"toooooooolong"}}}`), &OuterInnerThingMap{})
+	errs = err.(*MultiValidationError).Errors()
+	require.Len(t, errs, 1)
+	require.Equal(t, `OuterInnerThingMap.InnerThingMap["a/b"].Foo`, errs[0].GoPath)
 
-	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"happened_at":"2006-01-02T15:04:00Z"}`), v)
-	if err != nil {
-		t.Fatal(err)
-	}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{}`), &OuterThing{})
+	errs = err.(*MultiValidationError).Errors()
+	require.Equal(t, "OuterThing.InnerThing", errs[0].GoPath)
 
-	if !ts.Equal(v.HappenedAt) {
-		t.Fatal("Timestamp mismatch:", v.HappenedAt, ts)
-	}
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"card_number":"4111111111111111"}`), &PaymentDetails{})
+	errs = err.(*MultiValidationError).Errors()
+	require.Len(t, errs, 2)
+	require.Equal(t, "PaymentDetails.CVC", errs[0].GoPath)
+	require.Equal(t, "PaymentDetails.Expiry", errs[1].GoPath)
+
+	err = TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"email":"a@example.com","phone":"+14155552671"}`), &UserLookup{})
+	errs = err.(*MultiValidationError).Errors()
+	require.Equal(t, "UserLookup", errs[0].GoPath)
+}
+
+func TestMultiValidationErrorByPath(t *testing.T) {
+	err := TestTypeMapper.Unmarshal(EmptyContext, []byte(`{"lookup":{"user_id":"nope","email":"a@example.com"}}`), &OuterUserLookup{})
+	require.Equal(t, map[string][]string{
+		"/lookup/user_id": {"not a valid UUID"},
+		"/lookup":         {"only one of 'user_id', 'email', 'phone' may be present, got 'user_id', 'email'"},
+	}, err.(*MultiValidationError).ByPath())
+
+	me := &MultiValidationError{}
+	me.NestedErrors = append(me.NestedErrors, NewFlattenedPathError("/foo", "too short"), NewFlattenedPathError("/foo", "not a number"))
+	require.Equal(t, map[string][]string{"/foo": {"too short", "not a number"}}, me.ByPath())
+	require.Empty(t, (&MultiValidationError{}).ByPath())
 }
 
 func TestGenericUnmarshalInvalidInput(t *testing.T) {
@@ -1873,6 +5558,668 @@ func TestParamMapping(t *testing.T) {
 	require.Error(t, err, "a validation test failed")
 }
 
+type uuidBytes [16]byte
+
+type resourceFilter struct {
+	ID  string
+	Ref uuidBytes
+}
+
+var resourceFilterMapping = QueryMap{
+	UnderlyingType: resourceFilter{},
+	ParameterMaps: []ParameterMap{
+		{
+			StructFieldName: "ID",
+			ParameterName:   "id",
+			Mapper:          UUIDQueryParameterMapper{},
+		},
+		{
+			StructFieldName: "Ref",
+			ParameterName:   "ref",
+			Mapper:          UUIDQueryParameterMapper{Type: reflect.TypeOf(uuidBytes{})},
+			OmitEmpty:       true,
+		},
+	},
+}
+
+func TestUUIDParamMapping(t *testing.T) {
+	urlQuery, _ := url.ParseQuery(`id=00000000-0000-1000-9000-000000000000&ref=0123abcd-4567-4890-ABCD-ef0123456789`)
+	filter := resourceFilter{}
+	err := resourceFilterMapping.Decode(urlQuery, &filter)
+	require.NoError(t, err)
+	require.Equal(t, "00000000-0000-1000-9000-000000000000", filter.ID)
+	require.Equal(t, uuidBytes{0x01, 0x23, 0xab, 0xcd, 0x45, 0x67, 0x48, 0x90, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89}, filter.Ref)
+
+	newMap := make(map[string][]string)
+	err = resourceFilterMapping.Encode(filter, newMap)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0123abcd-4567-4890-abcd-ef0123456789"}, newMap["ref"])
+
+	urlQuery, _ = url.ParseQuery(`id=00000000-0000-1000-9000-000000000000`)
+	filter = resourceFilter{}
+	err = resourceFilterMapping.Decode(urlQuery, &filter)
+	require.NoError(t, err)
+	require.Equal(t, uuidBytes{}, filter.Ref)
+
+	urlQuery, _ = url.ParseQuery(`id=1234&ref=nope`)
+	err = resourceFilterMapping.Decode(urlQuery, &resourceFilter{})
+	require.EqualError(t, err, `Validation Errors: 
+/id: not a valid UUID
+/ref: not a valid UUID
+`)
+	require.Equal(t, CodeInvalidFormat, err.(*MultiValidationError).Errors()[0].Code)
+}
+
+func TestCommaSeparatedParamMapping(t *testing.T) {
+	qm := QueryMap{
+		UnderlyingType: requestFilter{},
+		ParameterMaps: []ParameterMap{
+			{
+				StructFieldName: "States",
+				ParameterName:   "states",
+				Mapper: StrSliceQueryParameterMapper{
+					[]func([]string) bool{
+						sliceRangeFactory(0, 3),
+					},
+					StringQueryParameterMapper{},
+				},
+				CommaSeparated: true,
+			},
+		},
+	}
+
+	urlQuery, _ := url.ParseQuery(`states=open,closed&states=pending`)
+	filter := requestFilter{}
+	err := qm.Decode(urlQuery, &filter)
+	require.NoError(t, err)
+	require.Equal(t, []string{"open", "closed", "pending"}, filter.States)
+
+	newMap := make(map[string][]string)
+	err = qm.Encode(filter, newMap)
+	require.NoError(t, err)
+	require.Equal(t, []string{"open,closed,pending"}, newMap["states"])
+
+	header := http.Header{}
+	err = qm.EncodeHeader(filter, header)
+	require.NoError(t, err)
+	require.Equal(t, "open,closed,pending", header.Get("States"))
+
+	filter = requestFilter{}
+	err = qm.DecodeHeader(header, &filter)
+	require.NoError(t, err)
+	require.Equal(t, []string{"open", "closed", "pending"}, filter.States)
+
+	urlQuery, _ = url.ParseQuery(`states=a,b,c,d`)
+	err = qm.Decode(urlQuery, &requestFilter{})
+	require.Error(t, err)
+}
+
+type optionalFilter struct {
+	Limit  *int
+	Active *bool
+	Since  *time.Time
+}
+
+var optionalFilterMapping = QueryMap{
+	UnderlyingType: optionalFilter{},
+	ParameterMaps: []ParameterMap{
+		{
+			StructFieldName: "Limit",
+			ParameterName:   "limit",
+			Mapper:          PointerOf(IntQueryParameterMapper{}, reflect.TypeOf(0)),
+			OmitEmpty:       true,
+		},
+		{
+			StructFieldName: "Active",
+			ParameterName:   "active",
+			Mapper:          PointerOf(BoolQueryParameterMapper{}, reflect.TypeOf(false)),
+			OmitEmpty:       true,
+		},
+		{
+			StructFieldName: "Since",
+			ParameterName:   "since",
+			Mapper:          PointerOf(TimeQueryParameterMapper{}, reflect.TypeOf(time.Time{})),
+			OmitEmpty:       true,
+		},
+	},
+}
+
+func TestPointerParamMapping(t *testing.T) {
+	urlQuery, _ := url.ParseQuery(`limit=0&active=false&since=2020-01-02T03:04:05Z`)
+	filter := optionalFilter{}
+	err := optionalFilterMapping.Decode(urlQuery, &filter)
+	require.NoError(t, err)
+	require.Equal(t, 0, *filter.Limit)
+	require.Equal(t, false, *filter.Active)
+	require.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), *filter.Since)
+
+	newMap := make(map[string][]string)
+	err = optionalFilterMapping.Encode(filter, newMap)
+	require.NoError(t, err)
+	require.EqualValues(t, urlQuery, newMap)
+
+	urlQuery, _ = url.ParseQuery(``)
+	filter = optionalFilter{}
+	err = optionalFilterMapping.Decode(urlQuery, &filter)
+	require.NoError(t, err)
+	require.Nil(t, filter.Limit)
+	require.Nil(t, filter.Active)
+	require.Nil(t, filter.Since)
+
+	newMap = make(map[string][]string)
+	err = optionalFilterMapping.Encode(filter, newMap)
+	require.NoError(t, err)
+	require.Empty(t, newMap)
+
+	urlQuery, _ = url.ParseQuery(`limit=ten`)
+	err = optionalFilterMapping.Decode(urlQuery, &optionalFilter{})
+	require.Error(t, err)
+	require.Equal(t, CodeInvalidFormat, err.(*MultiValidationError).Errors()[0].Code)
+}
+
+func TestEncodeQueryString(t *testing.T) {
+	location := "café & bar"
+	dog := dogStruct{
+		Age:      3,
+		Name:     "Spot Jr",
+		Owners:   []string{"Alice", "Bob"},
+		Location: &location,
+	}
+
+	values, err := dogParamMap.EncodeValues(dog)
+	require.NoError(t, err)
+	require.Equal(t, "Spot Jr", values.Get("name"))
+	require.Equal(t, []string{"Alice", "Bob"}, values["owners"])
+
+	qs, err := dogParamMap.EncodeQueryString(dog)
+	require.NoError(t, err)
+	require.Equal(t, "age=3&birthday=0001-01-01T00%3A00%3A00Z&is_dead=false&location=caf%C3%A9+%26+bar&name=Spot+Jr&owners=Alice&owners=Bob", qs)
+
+	decoded, err := url.ParseQuery(qs)
+	require.NoError(t, err)
+	roundTripped := dogStruct{}
+	err = dogParamMap.Decode(decoded, &roundTripped)
+	require.NoError(t, err)
+	require.Equal(t, dog, roundTripped)
+}
+
+type accountRequest struct {
+	AccountID string
+	Count     int
+	RequestID string
+}
+
+var accountRequestMapping = QueryMap{
+	UnderlyingType: accountRequest{},
+	ParameterMaps: []ParameterMap{
+		{
+			StructFieldName: "AccountID",
+			ParameterName:   "account_id",
+			Mapper:          UUIDQueryParameterMapper{},
+			In:              InPath,
+		},
+		{
+			StructFieldName: "Count",
+			ParameterName:   "count",
+			Mapper: IntQueryParameterMapper{
+				Validators: []func(int64) bool{
+					intRangeFactory(0, 500),
+				},
+			},
+		},
+		{
+			StructFieldName: "RequestID",
+			ParameterName:   "X-Request-Id",
+			Mapper:          StringQueryParameterMapper{},
+			In:              InHeader,
+		},
+	},
+	PathParameters: func(r *http.Request) map[string]string {
+		return map[string]string{"account_id": strings.TrimPrefix(r.URL.Path, "/accounts/")}
+	},
+}
+
+func TestDecodeRequest(t *testing.T) {
+	r, err := http.NewRequest("GET", "/accounts/00000000-0000-1000-9000-000000000000?count=10", nil)
+	require.NoError(t, err)
+	r.Header.Set("X-Request-ID", "abc")
+
+	dst := accountRequest{}
+	err = accountRequestMapping.DecodeRequest(r, &dst)
+	require.NoError(t, err)
+	require.Equal(t, accountRequest{
+		AccountID: "00000000-0000-1000-9000-000000000000",
+		Count:     10,
+		RequestID: "abc",
+	}, dst)
+
+	r, err = http.NewRequest("GET", "/accounts/nope?count=1000", nil)
+	require.NoError(t, err)
+	err = accountRequestMapping.DecodeRequest(r, &accountRequest{})
+	require.Len(t, err.(*MultiValidationError).Errors(), 2)
+	require.Contains(t, err.Error(), "/account_id: not a valid UUID")
+	require.Contains(t, err.Error(), "/count: a validation test failed")
+
+	err = accountRequestMapping.DecodeRequest(r, &requestFilter{})
+	require.EqualError(t, err, "attempting to decode into mismatched struct: expected jsonmap.accountRequest but got jsonmap.requestFilter")
+}
+
+func TestDecodeForm(t *testing.T) {
+	body := url.Values{"name": {"Spot"}, "owners": {"Alice", "Bob"}, "age": {"4"}}
+	r, err := http.NewRequest("POST", "/dogs?age=7", strings.NewReader(body.Encode()))
+	require.NoError(t, err)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	dog := dogStruct{}
+	err = dogParamMap.DecodeForm(r, &dog)
+	require.NoError(t, err)
+	require.Equal(t, 4, dog.Age)
+	require.Equal(t, "Spot", dog.Name)
+	require.Equal(t, []string{"Alice", "Bob"}, dog.Owners)
+
+	r, err = http.NewRequest("POST", "/dogs", strings.NewReader(`{"name":"Spot"}`))
+	require.NoError(t, err)
+	r.Header.Set("Content-Type", "application/json")
+	err = dogParamMap.DecodeForm(r, &dogStruct{})
+	require.EqualError(t, err, "expected a form-encoded body but got: application/json")
+
+	qm := QueryMap{
+		UnderlyingType: requestFilter{},
+		ParameterMaps: []ParameterMap{
+			{
+				StructFieldName: "Search",
+				ParameterName:   "search",
+				Mapper:          StringQueryParameterMapper{},
+				In:              InForm,
+			},
+			{
+				StructFieldName: "Count",
+				ParameterName:   "count",
+				Mapper:          IntQueryParameterMapper{},
+			},
+		},
+	}
+	r, err = http.NewRequest("POST", "/search?count=5&search=ignored", strings.NewReader("search=foo"))
+	require.NoError(t, err)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	filter := requestFilter{}
+	err = qm.DecodeRequest(r, &filter)
+	require.NoError(t, err)
+	require.Equal(t, requestFilter{Search: "foo", Count: 5}, filter)
+}
+
+type uploadRequest struct {
+	Title       string
+	Avatar      *multipart.FileHeader
+	Attachments []*multipart.FileHeader
+}
+
+var uploadRequestMapping = QueryMap{
+	UnderlyingType: uploadRequest{},
+	ParameterMaps: []ParameterMap{
+		{
+			StructFieldName: "Title",
+			ParameterName:   "title",
+			Mapper: StringQueryParameterMapper{
+				[]func(string) bool{
+					StringRangeValidator(1, 10),
+				},
+			},
+		},
+		{
+			StructFieldName: "Avatar",
+			ParameterName:   "avatar",
+			Mapper: FileParameterMapper{
+				MaxSize:      16,
+				ContentTypes: []string{"image/png"},
+			},
+		},
+		{
+			StructFieldName: "Attachments",
+			ParameterName:   "attachments",
+			Mapper:          FileParameterMapper{Multiple: true},
+		},
+	},
+}
+
+func newMultipartRequest(t *testing.T, title string, files map[string][]string, contentType string) *http.Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	require.NoError(t, w.WriteField("title", title))
+	for name, contents := range files {
+		for i, content := range contents {
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s%d"`, name, name, i))
+			h.Set("Content-Type", contentType)
+			part, err := w.CreatePart(h)
+			require.NoError(t, err)
+			_, err = part.Write([]byte(content))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, w.Close())
+
+	r, err := http.NewRequest("POST", "/upload", body)
+	require.NoError(t, err)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
+
+func TestDecodeMultipart(t *testing.T) {
+	r := newMultipartRequest(t, "holiday", map[string][]string{
+		"avatar":      {"png"},
+		"attachments": {"one", "two"},
+	}, "image/png")
+
+	dst := uploadRequest{}
+	err := uploadRequestMapping.DecodeMultipart(r, 1<<20, &dst)
+	require.NoError(t, err)
+	require.Equal(t, "holiday", dst.Title)
+	require.Equal(t, "avatar0", dst.Avatar.Filename)
+	require.Len(t, dst.Attachments, 2)
+
+	f, err := dst.Attachments[1].Open()
+	require.NoError(t, err)
+	content := &bytes.Buffer{}
+	_, err = content.ReadFrom(f)
+	require.NoError(t, err)
+	require.Equal(t, "two", content.String())
+
+	r = newMultipartRequest(t, "", map[string][]string{
+		"avatar": {"this file is far too large"},
+	}, "image/png")
+	err = uploadRequestMapping.DecodeMultipart(r, 1<<20, &uploadRequest{})
+	require.Len(t, err.(*MultiValidationError).Errors(), 2)
+	require.Contains(t, err.Error(), "/avatar: file too large, may not be larger than 16 bytes")
+
+	r = newMultipartRequest(t, "x", map[string][]string{
+		"avatar": {"gif"},
+	}, "image/gif")
+	err = uploadRequestMapping.DecodeMultipart(r, 1<<20, &uploadRequest{})
+	require.Contains(t, err.Error(), "/avatar: unsupported content type: image/gif")
+
+	r = newMultipartRequest(t, "x", nil, "")
+	dst = uploadRequest{}
+	err = uploadRequestMapping.DecodeMultipart(r, 1<<20, &dst)
+	require.NoError(t, err)
+	require.Nil(t, dst.Avatar)
+	require.Empty(t, dst.Attachments)
+}
+
+func TestPaginationParams(t *testing.T) {
+	qm := PaginationQueryMap(20, 100)
+
+	urlQuery, _ := url.ParseQuery(``)
+	params := PaginationParams{}
+	err := qm.Decode(urlQuery, &params)
+	require.NoError(t, err)
+	require.Equal(t, PaginationParams{Limit: 20}, params)
+
+	urlQuery, _ = url.ParseQuery(`limit=50&offset=100`)
+	err = qm.Decode(urlQuery, &params)
+	require.NoError(t, err)
+	require.Equal(t, PaginationParams{Limit: 50, Offset: 100}, params)
+
+	qs, err := qm.EncodeQueryString(params)
+	require.NoError(t, err)
+	require.Equal(t, "limit=50&offset=100", qs)
+
+	urlQuery, _ = url.ParseQuery(`limit=500&offset=-1`)
+	err = qm.Decode(urlQuery, &PaginationParams{})
+	require.EqualError(t, err, `Validation Errors: 
+/limit: must be between 1 and 100
+/offset: must be between 0 and 2147483647
+`)
+	require.Equal(t, CodeOutOfRange, err.(*MultiValidationError).Errors()[0].Code)
+
+	cqm := CursorPaginationQueryMap(10, 50)
+	urlQuery, _ = url.ParseQuery(`cursor=abc`)
+	cursorParams := CursorPaginationParams{}
+	err = cqm.Decode(urlQuery, &cursorParams)
+	require.NoError(t, err)
+	require.Equal(t, CursorPaginationParams{Limit: 10, Cursor: "abc"}, cursorParams)
+
+	qs, err = cqm.EncodeQueryString(CursorPaginationParams{Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, "limit=10", qs)
+
+	urlQuery, _ = url.ParseQuery(`limit=0&cursor=` + strings.Repeat("a", 2000))
+	err = cqm.Decode(urlQuery, &CursorPaginationParams{})
+	require.Len(t, err.(*MultiValidationError).Errors(), 2)
+}
+
+type listRequest struct {
+	Sort    []SortField
+	Filters []Filter
+}
+
+var listRequestMapping = QueryMap{
+	UnderlyingType: listRequest{},
+	ParameterMaps: []ParameterMap{
+		{
+			StructFieldName: "Sort",
+			ParameterName:   "sort",
+			Mapper: SortQueryParameterMapper{
+				Allowed:   []string{"name", "created_at"},
+				MaxFields: 2,
+			},
+			OmitEmpty: true,
+		},
+		{
+			StructFieldName: "Filters",
+			ParameterName:   "filter",
+			Mapper: FilterQueryParameterMapper{
+				Fields: map[string]FilterField{
+					"status": {
+						Operators: []FilterOperator{FilterEqual, FilterNotEqual},
+						Mapper:    StringQueryParameterMapper{},
+					},
+					"age": {
+						Operators: []FilterOperator{FilterEqual, FilterGreaterOrEqual, FilterLessThan},
+						Mapper:    IntQueryParameterMapper{},
+					},
+				},
+			},
+			OmitEmpty: true,
+		},
+	},
+}
+
+func TestSortParamMapping(t *testing.T) {
+	urlQuery, _ := url.ParseQuery(`sort=name:asc,created_at:desc`)
+	req := listRequest{}
+	err := listRequestMapping.Decode(urlQuery, &req)
+	require.NoError(t, err)
+	require.Equal(t, []SortField{{"name", SortAscending}, {"created_at", SortDescending}}, req.Sort)
+
+	qs, err := listRequestMapping.EncodeQueryString(req)
+	require.NoError(t, err)
+	require.Equal(t, "sort=name%3Aasc%2Ccreated_at%3Adesc", qs)
+
+	urlQuery, _ = url.ParseQuery(`sort=created_at`)
+	err = listRequestMapping.Decode(urlQuery, &req)
+	require.NoError(t, err)
+	require.Equal(t, []SortField{{"created_at", SortAscending}}, req.Sort)
+
+	for input, expected := range map[string]string{
+		"sort=age:asc":                  "cannot sort by 'age', must be one of: name, created_at",
+		"sort=name:up":                  "invalid sort direction 'up' for 'name', must be asc or desc",
+		"sort=name,name:desc":           "cannot sort by 'name' more than once",
+		"sort=name&sort=created_at,age": "cannot sort by 'age', must be one of: name, created_at",
+	} {
+		urlQuery, _ = url.ParseQuery(input)
+		err = listRequestMapping.Decode(urlQuery, &listRequest{})
+		require.Error(t, err, input)
+		require.Equal(t, expected, err.(*MultiValidationError).Errors()[0].Cause.Error(), input)
+	}
+}
+
+func TestFilterParamMapping(t *testing.T) {
+	urlQuery, _ := url.ParseQuery(`filter=status:eq:active,age:gte:21`)
+	req := listRequest{}
+	err := listRequestMapping.Decode(urlQuery, &req)
+	require.NoError(t, err)
+	require.Equal(t, []Filter{
+		{"status", FilterEqual, "active"},
+		{"age", FilterGreaterOrEqual, 21},
+	}, req.Filters)
+
+	values, err := listRequestMapping.EncodeValues(req)
+	require.NoError(t, err)
+	require.Equal(t, []string{"status:eq:active,age:gte:21"}, values["filter"])
+
+	for input, expected := range map[string]string{
+		"filter=status":           "invalid filter 'status', expected field:operator:value",
+		"filter=name:eq:spot":     "cannot filter by 'name', must be one of: age, status",
+		"filter=status:gt:active": "operator 'gt' is not allowed for 'status', must be one of: eq, ne",
+		"filter=age:lt:young":     `invalid value for 'age': param could not be converted to integer: strconv.ParseInt: parsing "young": invalid syntax`,
+	} {
+		urlQuery, _ = url.ParseQuery(input)
+		err = listRequestMapping.Decode(urlQuery, &listRequest{})
+		require.Error(t, err, input)
+		require.Equal(t, expected, err.(*MultiValidationError).Errors()[0].Cause.Error(), input)
+	}
+}
+
+type misconfiguredFilter struct {
+	Name   string
+	Count  int
+	hidden string
+}
+
+func TestQueryMapValidate(t *testing.T) {
+	for _, qm := range []QueryMap{
+		dogParamMap,
+		requestFilterMapping,
+		resourceFilterMapping,
+		optionalFilterMapping,
+		accountRequestMapping,
+		uploadRequestMapping,
+		listRequestMapping,
+		PaginationQueryMap(10, 100),
+		CursorPaginationQueryMap(10, 100),
+	} {
+		require.Empty(t, qm.Validate(), reflect.TypeOf(qm.UnderlyingType).String())
+	}
+
+	qm := QueryMap{
+		UnderlyingType: misconfiguredFilter{},
+		ParameterMaps: []ParameterMap{
+			{
+				StructFieldName: "Nmae",
+				ParameterName:   "name",
+				Mapper:          StringQueryParameterMapper{},
+			},
+			{
+				StructFieldName: "Name",
+				ParameterName:   "count",
+				Mapper:          IntQueryParameterMapper{},
+			},
+			{
+				StructFieldName: "Count",
+				ParameterName:   "count",
+			},
+			{
+				StructFieldName: "hidden",
+				ParameterName:   "hidden",
+				Mapper:          StringQueryParameterMapper{},
+			},
+			{
+				StructFieldName: "Name",
+				ParameterName:   "title",
+				Mapper:          StringQueryParameterMapper{},
+				OmitNil:         true,
+			},
+		},
+	}
+	errs := qm.Validate()
+	require.Len(t, errs, 6)
+	require.EqualError(t, errs[0], "jsonmap.misconfiguredFilter: no such underlying field: Nmae")
+	require.EqualError(t, errs[1], "jsonmap.misconfiguredFilter: parameter count decodes to int, which cannot be stored in field Name of type string")
+	require.EqualError(t, errs[2], "jsonmap.misconfiguredFilter: duplicate parameter: count")
+	require.EqualError(t, errs[3], "jsonmap.misconfiguredFilter: Mapper must be specified for parameter: count")
+	require.EqualError(t, errs[4], "jsonmap.misconfiguredFilter: cannot set unexported field: hidden")
+	require.EqualError(t, errs[5], "jsonmap.misconfiguredFilter: OmitNil set for parameter title, but field Name of type string cannot be nil")
+
+	require.EqualError(t, QueryMap{}.Validate()[0], "UnderlyingType must be a struct")
+}
+
+type patchRequest struct {
+	Name   *string
+	Count  int
+	Tags   []string
+	Labels []string
+}
+
+func TestEncodeOmitOptions(t *testing.T) {
+	stringPtr := PointerOf(StringQueryParameterMapper{}, reflect.TypeOf(""))
+	tags := StrSliceQueryParameterMapper{
+		UnderlyingQueryParameterMapper: StringQueryParameterMapper{},
+	}
+	paramMaps := func(omitNil, omitZero, omitEmpty bool) QueryMap {
+		qm := QueryMap{UnderlyingType: patchRequest{}}
+		for _, p := range []ParameterMap{
+			{StructFieldName: "Name", ParameterName: "name", Mapper: stringPtr},
+			{StructFieldName: "Count", ParameterName: "count", Mapper: IntQueryParameterMapper{}},
+			{StructFieldName: "Tags", ParameterName: "tags", Mapper: tags},
+			{StructFieldName: "Labels", ParameterName: "labels", Mapper: tags},
+		} {
+			if p.StructFieldName != "Count" {
+				p.OmitNil = omitNil
+			}
+			p.OmitZero = omitZero
+			p.OmitEmpty = omitEmpty
+			qm.ParameterMaps = append(qm.ParameterMaps, p)
+		}
+		return qm
+	}
+
+	empty := ""
+	req := patchRequest{
+		Name:   &empty,
+		Count:  0,
+		Tags:   []string{},
+		Labels: nil,
+	}
+
+	values, err := paramMaps(true, false, false).EncodeValues(req)
+	require.NoError(t, err)
+	require.Equal(t, url.Values{
+		"name":  {""},
+		"count": {"0"},
+		"tags":  nil,
+	}, values)
+
+	values, err = paramMaps(false, true, false).EncodeValues(req)
+	require.NoError(t, err)
+	require.Equal(t, url.Values{
+		"tags": nil,
+	}, values)
+
+	// OmitEmpty only skips values which reflect.Value.IsZero, so an empty
+	// but non-nil slice is still encoded
+	values, err = paramMaps(false, false, true).EncodeValues(req)
+	require.NoError(t, err)
+	require.Equal(t, url.Values{
+		"name": {""},
+		"tags": nil,
+	}, values)
+
+	require.Empty(t, paramMaps(true, false, false).Validate())
+
+	count := "3"
+	req = patchRequest{Name: &count, Count: 3, Tags: []string{"a"}}
+	header := http.Header{}
+	err = paramMaps(false, true, false).EncodeHeader(req, header)
+	require.NoError(t, err)
+	require.Equal(t, http.Header{
+		"Name":  {"3"},
+		"Count": {"3"},
+		"Tags":  {"a"},
+	}, header)
+}
+
 func TestHeaderMap(t *testing.T) {
 	header := http.Header{}
 	header.Add("name", "spot")
@@ -0,0 +1,199 @@
+package jsonmap
+
+import (
+	"io"
+)
+
+type lenientState int
+
+const (
+	lenientNormal lenientState = iota
+	lenientString
+	lenientEscape
+	lenientSlash
+	lenientLineComment
+	lenientBlockComment
+	lenientBlockStar
+)
+
+// lenientFilter rewrites the extensions accepted by Lenient() into strict
+// JSON. Comments and trailing commas are replaced with spaces rather than
+// removed, and newlines are kept, so that offsets in the output correspond to
+// offsets in the input.
+type lenientFilter struct {
+	state lenientState
+	// prev is the last significant byte seen outside of a string
+	prev byte
+	// A comma is held back, along with any whitespace and comments which
+	// follow it, until it is known whether it is a trailing comma.
+	comma   bool
+	pending []byte
+}
+
+// emit appends b to out, or holds it back behind a pending comma.
+func (f *lenientFilter) emit(out []byte, b byte) []byte {
+	if f.comma {
+		f.pending = append(f.pending, b)
+		return out
+	}
+	return append(out, b)
+}
+
+// resolve releases a pending comma, replacing it with a space if it turned out
+// to be a trailing comma.
+func (f *lenientFilter) resolve(out []byte, trailing bool) []byte {
+	if !f.comma {
+		return out
+	}
+	f.comma = false
+	if trailing {
+		out = append(out, ' ')
+	} else {
+		out = append(out, ',')
+	}
+	out = append(out, f.pending...)
+	f.pending = f.pending[:0]
+	return out
+}
+
+// comment emits the replacement for a byte within a comment.
+func (f *lenientFilter) comment(out []byte, b byte) []byte {
+	if b == '\n' {
+		return f.emit(out, '\n')
+	}
+	return f.emit(out, ' ')
+}
+
+func (f *lenientFilter) normal(out []byte, b byte) []byte {
+	switch b {
+	case ' ', '\t', '\r', '\n':
+		return f.emit(out, b)
+	case '/':
+		f.state = lenientSlash
+		return out
+	case ',':
+		out = f.resolve(out, false)
+		// A comma directly after an opening bracket is an error either way
+		prev := f.prev
+		f.prev = b
+		if prev == '{' || prev == '[' {
+			return append(out, b)
+		}
+		f.comma = true
+		return out
+	case '}', ']':
+		out = f.resolve(out, true)
+	case '"':
+		out = f.resolve(out, false)
+		f.state = lenientString
+	default:
+		out = f.resolve(out, false)
+	}
+	f.prev = b
+	return append(out, b)
+}
+
+// feed appends the rewritten form of in to out.
+func (f *lenientFilter) feed(out, in []byte) []byte {
+	for _, b := range in {
+		switch f.state {
+		case lenientString:
+			out = append(out, b)
+			if b == '\\' {
+				f.state = lenientEscape
+			} else if b == '"' {
+				f.state = lenientNormal
+			}
+		case lenientEscape:
+			out = append(out, b)
+			f.state = lenientString
+		case lenientSlash:
+			switch b {
+			case '/':
+				f.state = lenientLineComment
+				out = f.emit(f.emit(out, ' '), ' ')
+			case '*':
+				f.state = lenientBlockComment
+				out = f.emit(f.emit(out, ' '), ' ')
+			default:
+				// Not a comment after all, so leave the slash for the
+				// decoder to reject
+				f.state = lenientNormal
+				out = f.resolve(out, false)
+				out = append(out, '/')
+				out = f.normal(out, b)
+			}
+		case lenientLineComment:
+			if b == '\n' {
+				f.state = lenientNormal
+			}
+			out = f.comment(out, b)
+		case lenientBlockComment:
+			if b == '*' {
+				f.state = lenientBlockStar
+			}
+			out = f.comment(out, b)
+		case lenientBlockStar:
+			if b == '/' {
+				f.state = lenientNormal
+			} else if b != '*' {
+				f.state = lenientBlockComment
+			}
+			out = f.comment(out, b)
+		default:
+			out = f.normal(out, b)
+		}
+	}
+	return out
+}
+
+// flush appends anything still held back at the end of the input.
+func (f *lenientFilter) flush(out []byte) []byte {
+	if f.state == lenientSlash {
+		f.state = lenientNormal
+		out = f.resolve(out, false)
+		out = append(out, '/')
+	}
+	return f.resolve(out, false)
+}
+
+// stripLenient rewrites data, which may contain comments and trailing commas,
+// into strict JSON of the same length.
+func stripLenient(data []byte) []byte {
+	f := &lenientFilter{}
+	out := f.feed(make([]byte, 0, len(data)), data)
+	return f.flush(out)
+}
+
+// lenientReader applies a lenientFilter to everything read from r.
+type lenientReader struct {
+	r   io.Reader
+	f   lenientFilter
+	buf []byte
+	tmp []byte
+	eof bool
+}
+
+func (lr *lenientReader) Read(p []byte) (int, error) {
+	for len(lr.buf) == 0 && !lr.eof {
+		if lr.tmp == nil {
+			lr.tmp = make([]byte, 4096)
+		}
+		n, err := lr.r.Read(lr.tmp)
+		lr.buf = lr.f.feed(lr.buf, lr.tmp[:n])
+		if err == io.EOF {
+			lr.buf = lr.f.flush(lr.buf)
+			lr.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	if len(lr.buf) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, lr.buf)
+	lr.buf = lr.buf[n:]
+	return n, nil
+}
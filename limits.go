@@ -0,0 +1,116 @@
+package jsonmap
+
+import (
+	"io"
+)
+
+// limitScanner enforces MaxBytes(), MaxKeys() and MaxArrayLen() on raw JSON
+// input, so that oversized payloads are rejected before they're decoded. It
+// only tracks enough of the syntax to count the members of each object and
+// array, leaving malformed input for the decoder to reject.
+type limitScanner struct {
+	maxBytes    int64
+	maxKeys     int
+	maxArrayLen int
+
+	read     int64
+	inString bool
+	escape   bool
+	stack    []limitFrame
+}
+
+type limitFrame struct {
+	object bool
+	count  int
+	empty  bool
+}
+
+func newLimitScanner(state *unmarshalState) *limitScanner {
+	if state == nil || (state.maxBytes <= 0 && state.maxKeys <= 0 && state.maxArrayLen <= 0) {
+		return nil
+	}
+	return &limitScanner{
+		maxBytes:    state.maxBytes,
+		maxKeys:     state.maxKeys,
+		maxArrayLen: state.maxArrayLen,
+	}
+}
+
+func (ls *limitScanner) check(frame *limitFrame) error {
+	if frame.object && ls.maxKeys > 0 && frame.count > ls.maxKeys {
+		return NewValidationError("too many keys, objects may not have more than %d", ls.maxKeys).WithCode(CodeTooManyKeys).WithParam("max", ls.maxKeys)
+	}
+	if !frame.object && ls.maxArrayLen > 0 && frame.count > ls.maxArrayLen {
+		return NewValidationError("too many elements, arrays may not have more than %d", ls.maxArrayLen).WithCode(CodeTooManyElements).WithParam("max", ls.maxArrayLen)
+	}
+	return nil
+}
+
+// feed scans the next chunk of input.
+func (ls *limitScanner) feed(p []byte) error {
+	ls.read += int64(len(p))
+	if ls.maxBytes > 0 && ls.read > ls.maxBytes {
+		return NewValidationError("payload too large, may not be more than %d bytes", ls.maxBytes).WithCode(CodePayloadTooLarge).WithParam("max", ls.maxBytes)
+	}
+
+	for _, b := range p {
+		if ls.inString {
+			if ls.escape {
+				ls.escape = false
+			} else if b == '\\' {
+				ls.escape = true
+			} else if b == '"' {
+				ls.inString = false
+			}
+			continue
+		}
+
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '}', ']':
+			if len(ls.stack) > 0 {
+				ls.stack = ls.stack[:len(ls.stack)-1]
+			}
+			continue
+		}
+
+		// Anything else either separates the members of the enclosing
+		// container or begins its first member
+		if len(ls.stack) > 0 {
+			top := &ls.stack[len(ls.stack)-1]
+			if b == ',' {
+				top.count++
+			} else if top.empty {
+				top.empty = false
+				top.count = 1
+			}
+			if err := ls.check(top); err != nil {
+				return err
+			}
+		}
+
+		switch b {
+		case '"':
+			ls.inString = true
+		case '{', '[':
+			ls.stack = append(ls.stack, limitFrame{object: b == '{', empty: true})
+		}
+	}
+
+	return nil
+}
+
+// limitReader applies a limitScanner to everything read from r.
+type limitReader struct {
+	r  io.Reader
+	ls *limitScanner
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if scanErr := lr.ls.feed(p[:n]); scanErr != nil {
+		return 0, scanErr
+	}
+	return n, err
+}
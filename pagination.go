@@ -0,0 +1,108 @@
+package jsonmap
+
+import (
+	"math"
+	"reflect"
+)
+
+// maxCursorLen bounds the length of the opaque cursors accepted by
+// CursorPaginationQueryMap.
+const maxCursorLen = 1024
+
+// PaginationParams holds the parameters of a list request using limit/offset
+// pagination.
+type PaginationParams struct {
+	Limit  int
+	Offset int
+}
+
+// CursorPaginationParams holds the parameters of a list request using cursor
+// pagination, where Cursor is the opaque value returned with the previous
+// page, if any.
+type CursorPaginationParams struct {
+	Limit  int
+	Cursor string
+}
+
+// PaginationQueryMap returns a QueryMap for PaginationParams. "limit" must be
+// between 1 and maxLimit, defaulting to defaultLimit, and "offset" must not be
+// negative.
+func PaginationQueryMap(defaultLimit, maxLimit int) QueryMap {
+	return QueryMap{
+		UnderlyingType: PaginationParams{},
+		ParameterMaps: []ParameterMap{
+			limitParameter(defaultLimit, maxLimit),
+			{
+				StructFieldName: "Offset",
+				ParameterName:   "offset",
+				Mapper: boundedIntQueryParameterMapper{
+					Min: 0,
+					Max: math.MaxInt32,
+				},
+				OmitEmpty: true,
+			},
+		},
+	}
+}
+
+// CursorPaginationQueryMap returns a QueryMap for CursorPaginationParams.
+// "limit" must be between 1 and maxLimit, defaulting to defaultLimit.
+func CursorPaginationQueryMap(defaultLimit, maxLimit int) QueryMap {
+	return QueryMap{
+		UnderlyingType: CursorPaginationParams{},
+		ParameterMaps: []ParameterMap{
+			limitParameter(defaultLimit, maxLimit),
+			{
+				StructFieldName: "Cursor",
+				ParameterName:   "cursor",
+				Mapper: StringQueryParameterMapper{
+					[]func(string) bool{
+						StringRangeValidator(0, maxCursorLen),
+					},
+				},
+				OmitEmpty: true,
+			},
+		},
+	}
+}
+
+func limitParameter(defaultLimit, maxLimit int) ParameterMap {
+	return ParameterMap{
+		StructFieldName: "Limit",
+		ParameterName:   "limit",
+		Mapper: boundedIntQueryParameterMapper{
+			Min:     1,
+			Max:     maxLimit,
+			Default: defaultLimit,
+		},
+	}
+}
+
+// boundedIntQueryParameterMapper decodes an int between Min and Max, or
+// Default if the parameter is missing.
+type boundedIntQueryParameterMapper struct {
+	Min     int
+	Max     int
+	Default int
+}
+
+func (bqpm boundedIntQueryParameterMapper) Decode(src ...string) (interface{}, error) {
+	if len(src) == 0 {
+		return bqpm.Default, nil
+	}
+
+	v, err := IntQueryParameterMapper{}.Decode(src...)
+	if err != nil {
+		return nil, err
+	}
+
+	n := v.(int)
+	if n < bqpm.Min || n > bqpm.Max {
+		return nil, NewValidationError("must be between %d and %d", bqpm.Min, bqpm.Max).WithCode(CodeOutOfRange).WithParam("min", bqpm.Min).WithParam("max", bqpm.Max)
+	}
+	return n, nil
+}
+
+func (bqpm boundedIntQueryParameterMapper) Encode(src reflect.Value) ([]string, error) {
+	return IntQueryParameterMapper{}.Encode(src)
+}
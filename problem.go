@@ -0,0 +1,63 @@
+package jsonmap
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemContentType is the media type of an RFC 7807 Problem Details document.
+const ProblemContentType = "application/problem+json"
+
+// InvalidParam describes a single failure in the "invalid-params" extension
+// member of a Problem.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	Code   string `json:"code,omitempty"`
+}
+
+// Problem is an RFC 7807 Problem Details document describing a validation
+// failure. Type, Title, Detail and Instance may be customized before the
+// Problem is rendered.
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params"`
+}
+
+// NewProblem converts a MultiValidationError into a Problem with a 400 status.
+// Each error is listed in "invalid-params", named by its JSON pointer path.
+func NewProblem(err *MultiValidationError) *Problem {
+	params := make([]InvalidParam, len(err.NestedErrors))
+	for i, e := range err.NestedErrors {
+		params[i] = InvalidParam{
+			Name:   e.Path,
+			Reason: e.Message,
+			Code:   e.Code,
+		}
+	}
+
+	return &Problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(http.StatusBadRequest),
+		Status:        http.StatusBadRequest,
+		InvalidParams: params,
+	}
+}
+
+// WriteResponse writes the Problem to an HTTP response, setting the Content-Type
+// and status code.
+func (p *Problem) WriteResponse(w http.ResponseWriter) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_, err = w.Write(data)
+	return err
+}
@@ -1,12 +1,18 @@
 package jsonmap
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +21,9 @@ import (
 type QueryMap struct {
 	UnderlyingType interface{}
 	ParameterMaps  []ParameterMap
+	// PathParameters, if set, returns the variables parsed from the route of
+	// a request, such as mux.Vars(), for parameters which are InPath.
+	PathParameters func(r *http.Request) map[string]string
 }
 
 // Taking a struct and turning it into a url param. The precise mechanisms of doing
@@ -25,7 +34,7 @@ func (qm QueryMap) Encode(src interface{}, urlQuery map[string][]string) error {
 	for _, p := range qm.ParameterMaps {
 		fieldVal := srcVal.FieldByName(p.StructFieldName)
 
-		if fieldVal.IsZero() && p.OmitEmpty {
+		if p.omit(fieldVal) {
 			continue
 		}
 
@@ -34,12 +43,31 @@ func (qm QueryMap) Encode(src interface{}, urlQuery map[string][]string) error {
 			return errors.New("error in encoding struct: " + err.Error())
 		}
 
-		urlQuery[p.ParameterName] = strVal
+		urlQuery[p.ParameterName] = p.join(strVal)
 	}
 
 	return nil
 }
 
+// EncodeValues is like Encode, but returns a new url.Values.
+func (qm QueryMap) EncodeValues(src interface{}) (url.Values, error) {
+	values := url.Values{}
+	if err := qm.Encode(src, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// EncodeQueryString is like Encode, but returns an escaped query string, e.g.
+// "name=Spot&owners=Alice", sorted by parameter name.
+func (qm QueryMap) EncodeQueryString(src interface{}) (string, error) {
+	values, err := qm.EncodeValues(src)
+	if err != nil {
+		return "", err
+	}
+	return values.Encode(), nil
+}
+
 // Taking a URL Query (or any string->[]string struct) and shoving it into the struct
 // as specified by qm.UnderlyingType
 func (qm QueryMap) Decode(urlQuery map[string][]string, dst interface{}) error {
@@ -52,18 +80,36 @@ func (qm QueryMap) Decode(urlQuery map[string][]string, dst interface{}) error {
 		)
 	}
 
+	return qm.decodeFrom(dst, nil, func(param ParameterMap) []string {
+		return urlQuery[param.ParameterName]
+	})
+}
+
+// decodeFrom decodes each parameter into dst from the values returned by
+// lookup, or from files for a FileParameterMapper, returning all of the errors
+// found.
+func (qm QueryMap) decodeFrom(dst interface{}, files map[string][]*multipart.FileHeader, lookup func(param ParameterMap) []string) error {
 	errs := &MultiValidationError{}
 	dstVal := reflect.ValueOf(dst).Elem()
 	for _, param := range qm.ParameterMaps {
-		field := dstVal.FieldByName(param.StructFieldName)
+		var values []string
+		var decodedParam interface{}
+		var err error
+
+		if fm, ok := param.Mapper.(FileParameterMapper); ok {
+			fileHeaders := files[param.ParameterName]
+			for _, fh := range fileHeaders {
+				values = append(values, fh.Filename)
+			}
+			decodedParam, err = fm.DecodeFiles(fileHeaders...)
+		} else {
+			values = lookup(param)
+			decodedParam, err = param.Mapper.Decode(param.split(values)...)
+		}
 
-		decodedParam, err := param.Mapper.Decode(urlQuery[param.ParameterName]...)
+		field := dstVal.FieldByName(param.StructFieldName)
 		if err != nil {
-			errs.AddError(NewValidationError("error ocurred while reading value (%s) into param %s: %s",
-				urlQuery[param.ParameterName],
-				param.StructFieldName,
-				err.Error(),
-			))
+			errs.AddError(param.decodeError(values, err))
 			continue
 		}
 
@@ -84,7 +130,7 @@ func (qm QueryMap) EncodeHeader(src interface{}, headers http.Header) error {
 	for _, p := range qm.ParameterMaps {
 		fieldVal := srcVal.FieldByName(p.StructFieldName)
 
-		if fieldVal.IsZero() && p.OmitEmpty {
+		if p.omit(fieldVal) {
 			continue
 		}
 
@@ -94,7 +140,7 @@ func (qm QueryMap) EncodeHeader(src interface{}, headers http.Header) error {
 		}
 
 		// Not using .Set() because it only allows strings and not slices
-		headers[http.CanonicalHeaderKey(p.ParameterName)] = sliVal
+		headers[http.CanonicalHeaderKey(p.ParameterName)] = p.join(sliVal)
 	}
 
 	return nil
@@ -114,28 +160,102 @@ func (qm QueryMap) DecodeHeader(headers http.Header, dst interface{}) error {
 		)
 	}
 
-	errs := &MultiValidationError{}
-	dstVal := reflect.ValueOf(dst).Elem()
+	return qm.decodeFrom(dst, nil, func(param ParameterMap) []string {
+		return headers[http.CanonicalHeaderKey(param.ParameterName)]
+	})
+}
+
+// DecodeRequest decodes each parameter from the part of r given by its In,
+// returning the errors for all of them together.
+func (qm QueryMap) DecodeRequest(r *http.Request, dst interface{}) error {
+	if reflect.ValueOf(dst).Elem().Type() != reflect.TypeOf(qm.UnderlyingType) {
+		return fmt.Errorf("attempting to decode into mismatched struct: expected %s but got %s",
+			reflect.TypeOf(qm.UnderlyingType),
+			reflect.ValueOf(dst).Elem().Type(),
+		)
+	}
+
+	urlQuery := r.URL.Query()
+	var pathVars map[string]string
+	if qm.PathParameters != nil {
+		pathVars = qm.PathParameters(r)
+	}
 	for _, param := range qm.ParameterMaps {
-		headerVal := headers[http.CanonicalHeaderKey(param.ParameterName)]
-		field := dstVal.FieldByName(param.StructFieldName)
-		decodedHeader, err := param.Mapper.Decode(headerVal...)
-		if err != nil {
-			errs.AddError(NewValidationError("error ocurred while reading value (%s) into param %s: %s",
-				headerVal,
-				param.StructFieldName,
-				err.Error(),
-			))
-			continue
+		if param.In == InForm {
+			if err := parseForm(r); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	return qm.decodeFrom(dst, nil, func(param ParameterMap) []string {
+		switch param.In {
+		case InHeader:
+			return r.Header[http.CanonicalHeaderKey(param.ParameterName)]
+		case InPath:
+			if v, ok := pathVars[param.ParameterName]; ok {
+				return []string{v}
+			}
+			return nil
+		case InForm:
+			return r.PostForm[param.ParameterName]
+		default:
+			return urlQuery[param.ParameterName]
 		}
+	})
+}
 
-		field.Set(reflect.ValueOf(decodedHeader))
+// DecodeForm decodes an application/x-www-form-urlencoded request body, such
+// as an HTML form post, into dst.
+func (qm QueryMap) DecodeForm(r *http.Request, dst interface{}) error {
+	if reflect.ValueOf(dst).Elem().Type() != reflect.TypeOf(qm.UnderlyingType) {
+		return fmt.Errorf("attempting to decode into mismatched struct: expected %s but got %s",
+			reflect.TypeOf(qm.UnderlyingType),
+			reflect.ValueOf(dst).Elem().Type(),
+		)
 	}
 
-	if len(errs.Errors()) == 0 {
-		return nil
+	if err := parseForm(r); err != nil {
+		return err
 	}
-	return errs
+
+	return qm.decodeFrom(dst, nil, func(param ParameterMap) []string {
+		return r.PostForm[param.ParameterName]
+	})
+}
+
+// DecodeMultipart decodes a multipart/form-data request body into dst. Files
+// are decoded by parameters with a FileParameterMapper, and other fields are
+// decoded like query parameters. At most maxMemory bytes of files are held in
+// memory, with the remainder stored in temporary files.
+func (qm QueryMap) DecodeMultipart(r *http.Request, maxMemory int64, dst interface{}) error {
+	if reflect.ValueOf(dst).Elem().Type() != reflect.TypeOf(qm.UnderlyingType) {
+		return fmt.Errorf("attempting to decode into mismatched struct: expected %s but got %s",
+			reflect.TypeOf(qm.UnderlyingType),
+			reflect.ValueOf(dst).Elem().Type(),
+		)
+	}
+
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		return errors.New("error in parsing multipart form: " + err.Error())
+	}
+
+	return qm.decodeFrom(dst, r.MultipartForm.File, func(param ParameterMap) []string {
+		return r.MultipartForm.Value[param.ParameterName]
+	})
+}
+
+// parseForm reads the form-encoded body of r into r.PostForm.
+func parseForm(r *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return fmt.Errorf("expected a form-encoded body but got: %s", r.Header.Get("Content-Type"))
+	}
+	if err := r.ParseForm(); err != nil {
+		return errors.New("error in parsing form: " + err.Error())
+	}
+	return nil
 }
 
 // ParameterMap corresponds to each field in a specific struct,
@@ -144,7 +264,125 @@ type ParameterMap struct {
 	StructFieldName string
 	ParameterName   string
 	Mapper          QueryParameterMapper
-	OmitEmpty       bool
+	// OmitEmpty skips encoding the zero value of the field, as reported by
+	// reflect.Value.IsZero. A nil slice, map or pointer is skipped, but an
+	// empty slice or map, or a pointer to a zero value, is encoded.
+	OmitEmpty bool
+	// OmitNil skips encoding a nil pointer, slice, map or interface, so that
+	// a zero value such as 0 or "" is still encoded when it is set.
+	OmitNil bool
+	// OmitZero skips encoding the zero value of the field. Pointers are
+	// followed, so a pointer to 0 or "" is skipped as well as a nil pointer.
+	OmitZero bool
+	// Sensitive parameters never have their values echoed in errors.
+	Sensitive bool
+	// CommaSeparated parameters hold a list in a single value, e.g.
+	// ?ids=1,2,3, rather than repeating the parameter.
+	CommaSeparated bool
+	// In is where DecodeRequest reads the parameter from. It is ignored by
+	// the other methods.
+	In ParameterLocation
+}
+
+// ParameterLocation identifies the part of a request holding a parameter.
+type ParameterLocation int
+
+const (
+	InQuery ParameterLocation = iota
+	InHeader
+	InPath
+	// InForm parameters are read from a form-encoded request body.
+	InForm
+)
+
+// omit reports whether the field value v should be skipped when encoding.
+func (p ParameterMap) omit(v reflect.Value) bool {
+	if p.OmitEmpty && v.IsZero() {
+		return true
+	}
+
+	if p.OmitNil {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			if v.IsNil() {
+				return true
+			}
+		}
+	}
+
+	if p.OmitZero {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return true
+			}
+			v = v.Elem()
+		}
+		return v.IsZero()
+	}
+
+	return false
+}
+
+// split returns the elements of the comma-separated values of the parameter,
+// or values unchanged if it isn't CommaSeparated.
+func (p ParameterMap) split(values []string) []string {
+	if !p.CommaSeparated || values == nil {
+		return values
+	}
+
+	elems := []string{}
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		elems = append(elems, strings.Split(v, ",")...)
+	}
+	return elems
+}
+
+// join combines values into a single value if the parameter is
+// CommaSeparated.
+func (p ParameterMap) join(values []string) []string {
+	if !p.CommaSeparated || len(values) == 0 {
+		return values
+	}
+	return []string{strings.Join(values, ",")}
+}
+
+// decodeError describes a failure to decode values into the parameter, at the
+// path of the ParameterName, like the errors for a JSON body. The values are
+// included in the "value" param, truncated if long. The values of Sensitive
+// parameters are omitted entirely, along with the message of the underlying
+// error which may quote them.
+func (p ParameterMap) decodeError(values []string, err error) *ValidationError {
+	var ve *ValidationError
+	if p.Sensitive {
+		ve = NewValidationError("invalid value")
+	} else {
+		ve = NewValidationError("%s", truncateString(err.Error(), maxDescribedValueLen*2))
+	}
+
+	ve.Cause = err
+	ve.Code = CodeInvalidFormat
+	if e, ok := err.(*ValidationError); ok {
+		if e.Code != "" {
+			ve.Code = e.Code
+		}
+		for k, v := range e.Params {
+			ve.WithParam(k, v)
+		}
+	}
+
+	if !p.Sensitive && len(values) != 0 {
+		truncated := make([]string, len(values))
+		for i, v := range values {
+			truncated[i] = truncateString(v, maxDescribedValueLen)
+		}
+		ve.WithParam("value", truncated)
+	}
+
+	ve.SetField(p.ParameterName)
+	return ve.withGoField(p.StructFieldName)
 }
 
 // QueryParameterMapper defines how url.Values value ([]string) and struct are to be
@@ -164,7 +402,7 @@ type StringQueryParameterMapper struct {
 
 func (sqpm StringQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 	if len(src) > 1 {
-		return nil, NewValidationError("too many values")
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
 	}
 
 	if len(src) == 0 {
@@ -174,7 +412,7 @@ func (sqpm StringQueryParameterMapper) Decode(src ...string) (interface{}, error
 	str := src[0]
 	for _, v := range sqpm.Validators {
 		if !v(str) {
-			return nil, NewValidationError("a validation test failed")
+			return nil, NewValidationError("a validation test failed").WithCode(CodeValidationFailed)
 		}
 	}
 
@@ -210,7 +448,7 @@ type BoolQueryParameterMapper struct {
 
 func (bqpm BoolQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 	if len(src) > 1 {
-		return nil, NewValidationError("too many values")
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
 	}
 
 	if len(src) == 0 || src[0] == "" {
@@ -238,7 +476,7 @@ type IntQueryParameterMapper struct {
 
 func (iqpm IntQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 	if len(src) > 1 {
-		return nil, NewValidationError("too many values")
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
 	}
 
 	// This mildly weird flow is to ensure that 0 gets casted properly and avoids
@@ -250,12 +488,12 @@ func (iqpm IntQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 		if err != nil {
 			return nil, NewValidationError("param could not be converted to integer: %s",
 				err.Error(),
-			)
+			).WithCode(CodeInvalidFormat)
 		}
 
 		for _, v := range iqpm.Validators {
 			if !v(num) {
-				return nil, NewValidationError("a validation test failed")
+				return nil, NewValidationError("a validation test failed").WithCode(CodeValidationFailed)
 			}
 		}
 	}
@@ -290,7 +528,7 @@ type UintQueryParameterMapper struct {
 
 func (uqpm UintQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 	if len(src) > 1 {
-		return nil, NewValidationError("too many values")
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
 	}
 
 	num := uint64(0)
@@ -300,12 +538,12 @@ func (uqpm UintQueryParameterMapper) Decode(src ...string) (interface{}, error)
 		if err != nil {
 			return nil, NewValidationError("param could not be converted to integer: %s",
 				err.Error(),
-			)
+			).WithCode(CodeInvalidFormat)
 		}
 
 		for _, v := range uqpm.Validators {
 			if !v(num) {
-				return nil, NewValidationError("a validation test failed")
+				return nil, NewValidationError("a validation test failed").WithCode(CodeValidationFailed)
 			}
 		}
 	}
@@ -339,7 +577,7 @@ type TimeQueryParameterMapper struct {
 
 func (tqpm TimeQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 	if len(src) > 1 {
-		return nil, NewValidationError("too many values")
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
 	}
 
 	t := time.Time{}
@@ -349,12 +587,12 @@ func (tqpm TimeQueryParameterMapper) Decode(src ...string) (interface{}, error)
 
 	err := t.UnmarshalText([]byte(src[0]))
 	if err != nil {
-		return nil, NewValidationError("param could not be marshalled to time.Time: %s", err.Error())
+		return nil, NewValidationError("param could not be marshalled to time.Time: %s", err.Error()).WithCode(CodeInvalidFormat)
 	}
 
 	for _, v := range tqpm.Validators {
 		if !v(t) {
-			return nil, NewValidationError("a validation test failed")
+			return nil, NewValidationError("a validation test failed").WithCode(CodeValidationFailed)
 		}
 	}
 	return t, nil
@@ -384,7 +622,7 @@ type StrSliceQueryParameterMapper struct {
 func (sqpm StrSliceQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 	for _, val := range sqpm.Validators {
 		if !val(src) {
-			return nil, NewValidationError("A validation test failed")
+			return nil, NewValidationError("A validation test failed").WithCode(CodeValidationFailed)
 		}
 	}
 
@@ -392,7 +630,7 @@ func (sqpm StrSliceQueryParameterMapper) Decode(src ...string) (interface{}, err
 	for _, s := range src {
 		v, err := sqpm.UnderlyingQueryParameterMapper.Decode(s)
 		if err != nil {
-			return nil, NewValidationError("decoding a slice element failed: %s", err.Error())
+			return nil, NewValidationError("decoding a slice element failed: %s", err.Error()).WithCode(CodeInvalidFormat)
 		}
 		retVal = append(retVal, v.(string))
 	}
@@ -421,12 +659,12 @@ type StrPointerQueryParameterMapper struct {
 
 func (pqpm StrPointerQueryParameterMapper) Decode(src ...string) (interface{}, error) {
 	if len(src) > 1 {
-		return nil, NewValidationError("too many values")
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
 	}
 
 	v, err := pqpm.UnderlyingQueryParameterMapper.Decode(src...)
 	if err != nil {
-		return nil, NewValidationError("error occurred while decoding struct")
+		return nil, NewValidationError("error occurred while decoding struct").WithCode(CodeInvalidFormat)
 	}
 	v2 := v.(string)
 	return &v2, nil
@@ -438,3 +676,382 @@ func (pqpm StrPointerQueryParameterMapper) Encode(src reflect.Value) ([]string,
 	}
 	return []string{src.Elem().String()}, nil
 }
+
+// UUIDQueryParameterMapper decodes a UUID into a string, or into a [16]byte
+// such as uuid.UUID.
+type UUIDQueryParameterMapper struct {
+	// Type is the type of the field, which must be a string or a [16]byte.
+	// If nil, it is a string.
+	Type reflect.Type
+}
+
+func (uqpm UUIDQueryParameterMapper) Decode(src ...string) (interface{}, error) {
+	if len(src) > 1 {
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
+	}
+
+	t := uqpm.Type
+	if t == nil {
+		t = reflect.TypeOf("")
+	}
+
+	dst := reflect.New(t).Elem()
+	if len(src) == 0 {
+		return dst.Interface(), nil
+	}
+
+	id, err := UUIDString().ValidateString(src[0])
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t.Kind() == reflect.String:
+		dst.SetString(id)
+	case t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8:
+		b, err := hex.DecodeString(strings.Replace(id, "-", "", -1))
+		if err != nil {
+			return nil, NewValidationError("not a valid UUID").WithCode(CodeInvalidFormat)
+		}
+		reflect.Copy(dst.Slice(0, 16), reflect.ValueOf(b))
+	default:
+		return nil, fmt.Errorf("cannot decode a UUID into: %s", t)
+	}
+
+	return dst.Interface(), nil
+}
+
+func (uqpm UUIDQueryParameterMapper) Encode(src reflect.Value) ([]string, error) {
+	switch {
+	case src.Kind() == reflect.String:
+		return []string{src.String()}, nil
+	case src.Kind() == reflect.Array && src.Len() == 16 && src.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, 16)
+		reflect.Copy(reflect.ValueOf(b), src)
+		h := hex.EncodeToString(b)
+		return []string{h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]}, nil
+	default:
+		return nil, fmt.Errorf("expected string or [16]byte but got: %s", src.Type())
+	}
+}
+
+// PointerQueryParameterMapper decodes into a pointer using another mapper, so
+// that a missing parameter, which is left nil, can be told apart from a zero
+// value.
+type PointerQueryParameterMapper struct {
+	UnderlyingQueryParameterMapper QueryParameterMapper
+	// Type is the type pointed to.
+	Type reflect.Type
+}
+
+func (pqpm PointerQueryParameterMapper) Decode(src ...string) (interface{}, error) {
+	ptr := reflect.New(pqpm.Type)
+	if len(src) == 0 {
+		return reflect.Zero(ptr.Type()).Interface(), nil
+	}
+
+	v, err := pqpm.UnderlyingQueryParameterMapper.Decode(src...)
+	if err != nil {
+		return nil, err
+	}
+
+	val := reflect.ValueOf(v)
+	if !val.Type().ConvertibleTo(pqpm.Type) {
+		return nil, fmt.Errorf("cannot convert %s to %s", val.Type(), pqpm.Type)
+	}
+	ptr.Elem().Set(val.Convert(pqpm.Type))
+	return ptr.Interface(), nil
+}
+
+func (pqpm PointerQueryParameterMapper) Encode(src reflect.Value) ([]string, error) {
+	if src.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("expected pointer but got: %s", src.Kind())
+	}
+	if src.IsNil() {
+		return nil, nil
+	}
+	return pqpm.UnderlyingQueryParameterMapper.Encode(src.Elem())
+}
+
+// PointerOf decodes a parameter into a pointer to targetType with underlying,
+// leaving it nil if the parameter is missing.
+func PointerOf(underlying QueryParameterMapper, targetType reflect.Type) PointerQueryParameterMapper {
+	return PointerQueryParameterMapper{
+		UnderlyingQueryParameterMapper: underlying,
+		Type:                           targetType,
+	}
+}
+
+// FileParameterMapper decodes the files uploaded for a part of a multipart
+// form into a *multipart.FileHeader, or a []*multipart.FileHeader if Multiple
+// is set. Files can only be decoded by QueryMap.DecodeMultipart.
+type FileParameterMapper struct {
+	Multiple bool
+	// MaxSize, if non-zero, limits the size of each file in bytes.
+	MaxSize int64
+	// ContentTypes, if set, lists the allowed media types of each file.
+	ContentTypes []string
+}
+
+func (fpm FileParameterMapper) DecodeFiles(src ...*multipart.FileHeader) (interface{}, error) {
+	if len(src) > 1 && !fpm.Multiple {
+		return nil, NewValidationError("too many values").WithCode(CodeTooManyValues)
+	}
+
+	for _, fh := range src {
+		if fpm.MaxSize > 0 && fh.Size > fpm.MaxSize {
+			return nil, NewValidationError("file too large, may not be larger than %d bytes", fpm.MaxSize).WithCode(CodeTooLarge).WithParam("max", fpm.MaxSize)
+		}
+		if len(fpm.ContentTypes) != 0 && !fpm.allowsContentType(fh.Header.Get("Content-Type")) {
+			return nil, NewValidationError("unsupported content type: %s", fh.Header.Get("Content-Type")).WithCode(CodeInvalidFormat)
+		}
+	}
+
+	if fpm.Multiple {
+		return src, nil
+	}
+	if len(src) == 0 {
+		return (*multipart.FileHeader)(nil), nil
+	}
+	return src[0], nil
+}
+
+func (fpm FileParameterMapper) allowsContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range fpm.ContentTypes {
+		if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (fpm FileParameterMapper) Decode(src ...string) (interface{}, error) {
+	return nil, errors.New("files can only be decoded from a multipart form")
+}
+
+func (fpm FileParameterMapper) Encode(src reflect.Value) ([]string, error) {
+	return nil, errors.New("files cannot be encoded as parameters")
+}
+
+// SortDirection is the order of a SortField.
+type SortDirection string
+
+const (
+	SortAscending  SortDirection = "asc"
+	SortDescending SortDirection = "desc"
+)
+
+// SortField is one term of a sort expression such as "name:asc".
+type SortField struct {
+	Field     string
+	Direction SortDirection
+}
+
+// SortQueryParameterMapper decodes a sort expression such as
+// "name:asc,created_at:desc" into a []SortField. The direction of each term
+// defaults to ascending.
+type SortQueryParameterMapper struct {
+	// Allowed lists the fields which may be sorted by.
+	Allowed []string
+	// MaxFields, if non-zero, limits the number of terms.
+	MaxFields int
+}
+
+func (sqpm SortQueryParameterMapper) Decode(src ...string) (interface{}, error) {
+	var fields []SortField
+	seen := map[string]bool{}
+
+	for _, s := range src {
+		if s == "" {
+			continue
+		}
+		for _, term := range strings.Split(s, ",") {
+			sf := SortField{Field: term, Direction: SortAscending}
+			if i := strings.LastIndex(term, ":"); i >= 0 {
+				sf.Field = term[:i]
+				sf.Direction = SortDirection(term[i+1:])
+			}
+
+			if !sqpm.allows(sf.Field) {
+				return nil, NewValidationError("cannot sort by '%s', must be one of: %s", sf.Field, strings.Join(sqpm.Allowed, ", ")).WithCode(CodeNotOneOf).WithParam("allowed", sqpm.Allowed)
+			}
+			if sf.Direction != SortAscending && sf.Direction != SortDescending {
+				return nil, NewValidationError("invalid sort direction '%s' for '%s', must be asc or desc", sf.Direction, sf.Field).WithCode(CodeInvalidFormat)
+			}
+			if seen[sf.Field] {
+				return nil, NewValidationError("cannot sort by '%s' more than once", sf.Field).WithCode(CodeDuplicateElement)
+			}
+			seen[sf.Field] = true
+
+			fields = append(fields, sf)
+		}
+	}
+
+	if sqpm.MaxFields > 0 && len(fields) > sqpm.MaxFields {
+		return nil, NewValidationError("cannot sort by more than %d fields", sqpm.MaxFields).WithCode(CodeTooManyElements).WithParam("max", sqpm.MaxFields)
+	}
+
+	return fields, nil
+}
+
+func (sqpm SortQueryParameterMapper) allows(field string) bool {
+	for _, allowed := range sqpm.Allowed {
+		if field == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (sqpm SortQueryParameterMapper) Encode(src reflect.Value) ([]string, error) {
+	fields, ok := src.Interface().([]SortField)
+	if !ok {
+		return nil, fmt.Errorf("expected []SortField but got: %s", src.Type())
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	terms := make([]string, len(fields))
+	for i, sf := range fields {
+		direction := sf.Direction
+		if direction == "" {
+			direction = SortAscending
+		}
+		terms[i] = sf.Field + ":" + string(direction)
+	}
+	return []string{strings.Join(terms, ",")}, nil
+}
+
+// FilterOperator compares a field with the value of a Filter.
+type FilterOperator string
+
+const (
+	FilterEqual          FilterOperator = "eq"
+	FilterNotEqual       FilterOperator = "ne"
+	FilterLessThan       FilterOperator = "lt"
+	FilterLessOrEqual    FilterOperator = "lte"
+	FilterGreaterThan    FilterOperator = "gt"
+	FilterGreaterOrEqual FilterOperator = "gte"
+)
+
+// Filter is one term of a filter expression such as "age:gte:21". Value is
+// decoded by the Mapper of the field's FilterField.
+type Filter struct {
+	Field    string
+	Operator FilterOperator
+	Value    interface{}
+}
+
+// FilterField describes a field which may be filtered on.
+type FilterField struct {
+	// Operators lists the operators allowed for the field.
+	Operators []FilterOperator
+	// Mapper decodes the value compared with the field.
+	Mapper QueryParameterMapper
+}
+
+// FilterQueryParameterMapper decodes a filter expression such as
+// "status:eq:active,age:gte:21" into a []Filter. Values may not contain
+// commas.
+type FilterQueryParameterMapper struct {
+	Fields map[string]FilterField
+}
+
+func (fqpm FilterQueryParameterMapper) Decode(src ...string) (interface{}, error) {
+	var filters []Filter
+
+	for _, s := range src {
+		if s == "" {
+			continue
+		}
+		for _, term := range strings.Split(s, ",") {
+			parts := strings.SplitN(term, ":", 3)
+			if len(parts) != 3 {
+				return nil, NewValidationError("invalid filter '%s', expected field:operator:value", term).WithCode(CodeInvalidFormat)
+			}
+
+			f := Filter{
+				Field:    parts[0],
+				Operator: FilterOperator(parts[1]),
+			}
+
+			field, ok := fqpm.Fields[f.Field]
+			if !ok {
+				allowed := fqpm.fieldNames()
+				return nil, NewValidationError("cannot filter by '%s', must be one of: %s", f.Field, strings.Join(allowed, ", ")).WithCode(CodeNotOneOf).WithParam("allowed", allowed)
+			}
+			if !field.allows(f.Operator) {
+				allowed := make([]string, len(field.Operators))
+				for i, op := range field.Operators {
+					allowed[i] = string(op)
+				}
+				return nil, NewValidationError("operator '%s' is not allowed for '%s', must be one of: %s", f.Operator, f.Field, strings.Join(allowed, ", ")).WithCode(CodeNotOneOf).WithParam("allowed", allowed)
+			}
+
+			v, err := field.Mapper.Decode(parts[2])
+			if err != nil {
+				ve := NewValidationError("invalid value for '%s': %s", f.Field, err.Error()).WithCode(CodeInvalidFormat)
+				if e, ok := err.(*ValidationError); ok && e.Code != "" {
+					ve.Code = e.Code
+				}
+				ve.Cause = err
+				return nil, ve
+			}
+			f.Value = v
+
+			filters = append(filters, f)
+		}
+	}
+
+	return filters, nil
+}
+
+func (fqpm FilterQueryParameterMapper) fieldNames() []string {
+	names := make([]string, 0, len(fqpm.Fields))
+	for name := range fqpm.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ff FilterField) allows(op FilterOperator) bool {
+	for _, allowed := range ff.Operators {
+		if op == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (fqpm FilterQueryParameterMapper) Encode(src reflect.Value) ([]string, error) {
+	filters, ok := src.Interface().([]Filter)
+	if !ok {
+		return nil, fmt.Errorf("expected []Filter but got: %s", src.Type())
+	}
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	terms := make([]string, len(filters))
+	for i, f := range filters {
+		field, ok := fqpm.Fields[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("no such filter field: %s", f.Field)
+		}
+		v, err := field.Mapper.Encode(reflect.ValueOf(f.Value))
+		if err != nil {
+			return nil, err
+		}
+		if len(v) != 1 {
+			return nil, fmt.Errorf("expected a single value for filter field: %s", f.Field)
+		}
+		terms[i] = f.Field + ":" + string(f.Operator) + ":" + v[0]
+	}
+	return []string{strings.Join(terms, ",")}, nil
+}
@@ -0,0 +1,384 @@
+package jsonmap
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// schemaChecker is implemented by TypeMaps which can verify ahead of time that
+// they're compatible with the Go type they'll be used with. parent is the type
+// of the enclosing value, if any.
+type schemaChecker interface {
+	checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error
+}
+
+func checkTypeMap(tm TypeMap, parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if sc, ok := tm.(schemaChecker); ok {
+		return sc.checkSchema(parent, t, seen)
+	}
+	return nil
+}
+
+// CheckSchema detects misconfigurations of the StructMap and any TypeMaps it
+// contains, which would otherwise only be reported when data is marshaled or
+// unmarshaled.
+func (sm StructMap) CheckSchema() []error {
+	return sm.checkSchema(nil, sm.GetUnderlyingType(), map[reflect.Type]bool{})
+}
+
+func (sm StructMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	underlying := sm.GetUnderlyingType()
+	if underlying == nil || underlying.Kind() != reflect.Struct {
+		return []error{newSchemaError("UnderlyingType must be a struct")}
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Interface && t != underlying {
+		return []error{&SchemaError{
+			Type:    underlying.String(),
+			Message: "wrong type: " + t.String() + ", expected: " + underlying.String(),
+		}}
+	}
+
+	if seen[underlying] {
+		return nil
+	}
+	seen[underlying] = true
+
+	errs := []error{}
+	fail := func(format string, a ...interface{}) {
+		e := newSchemaError(format, a...)
+		e.Type = underlying.String()
+		errs = append(errs, e)
+	}
+
+	for _, field := range sm.Fields {
+		var fieldType reflect.Type
+
+		if field.StructFieldName != "" {
+			f, ok := underlying.FieldByName(field.StructFieldName)
+			if !ok {
+				fail("no such underlying field: %s", field.StructFieldName)
+				continue
+			}
+			fieldType = f.Type
+		} else if field.StructGetterName != "" {
+			m, ok := reflect.PtrTo(underlying).MethodByName(field.StructGetterName)
+			if !ok {
+				fail("no such underlying getter method: %s", field.StructGetterName)
+				continue
+			}
+			if m.Type.NumIn() != 1 || m.Type.NumOut() != 2 {
+				fail("invalid getter, should return (interface{}, error): %s", field.StructGetterName)
+				continue
+			}
+			fieldType = m.Type.Out(0)
+		} else {
+			fail("either StructFieldName or StructGetterName must be specified")
+			continue
+		}
+
+		// Fields without a Contains or Validator are marshaled as-is, but
+		// can't be unmarshaled
+		if field.Contains == nil && field.Validator == nil && !field.ReadOnly {
+			fail("Field must have Contains or Validator: %s", field.JSONFieldName)
+			continue
+		}
+
+		if field.Contains != nil {
+			errs = append(errs, checkTypeMap(field.Contains, underlying, fieldType, seen)...)
+		}
+	}
+
+	return errs
+}
+
+func (sm SliceMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return []error{newSchemaError("SliceOf() requires a slice or an array, got %s", t)}
+	}
+
+	elem := t.Elem()
+	indirect := elem
+	if indirect.Kind() == reflect.Ptr {
+		indirect = indirect.Elem()
+	}
+	if (sm.Unique || sm.Dedupe) && sm.UniqueKey == nil && !indirect.Comparable() {
+		return []error{newSchemaError("cannot compare elements of type %s, a UniqueKey function is required", indirect)}
+	}
+	if sm.Sorted && sm.Less == nil {
+		if err := sm.sortOrder(reflect.MakeSlice(reflect.SliceOf(elem), 0, 0), nil); err != nil {
+			return []error{err}
+		}
+	}
+
+	return checkTypeMap(sm.Contains, t, elem, seen)
+}
+
+func (tm TupleMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || t.NumField() < len(tm.Elems) {
+		return []error{newSchemaError("Tuple() of %d elements requires a struct with at least %d fields", len(tm.Elems), len(tm.Elems))}
+	}
+
+	errs := []error{}
+	for i, elem := range tm.Elems {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			errs = append(errs, newSchemaError("cannot set unexported field: %s", f.Name))
+			continue
+		}
+		errs = append(errs, checkTypeMap(elem, t, f.Type, seen)...)
+	}
+	return errs
+}
+
+func (mm MapMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Map {
+		return []error{newSchemaError("MapOf() requires a map, got %s", t)}
+	}
+
+	key := t.Key()
+	if key.Kind() != reflect.String && !reflect.PtrTo(key).Implements(textUnmarshalerType) {
+		return []error{newSchemaError("key must be a string or implement encoding.TextUnmarshaler")}
+	}
+	if key.Kind() != reflect.String && !key.Implements(textMarshalerType) {
+		return []error{newSchemaError("key must be a string or implement encoding.TextMarshaler")}
+	}
+
+	return checkTypeMap(mm.Contains, t, t.Elem(), seen)
+}
+
+func (vt *Discriminator) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	errs := []error{}
+
+	if vt.SelectType != nil {
+		// The type doesn't depend on the parent
+	} else if vt.InlineProperty != "" || (parent != nil && (parent.Kind() == reflect.Slice || parent.Kind() == reflect.Array)) {
+		for _, k := range sortedKeys(vt.Mapping) {
+			if _, ok := vt.Mapping[k].(RegisterableTypeMap); !ok {
+				errs = append(errs, newSchemaError("an inline Discriminator requires a TypeMap with an underlying type for: %s", k))
+			}
+		}
+	} else if parent == nil || parent.Kind() != reflect.Struct {
+		errs = append(errs, newSchemaError("VariableType() must be used within a StructMap"))
+	} else if f, ok := parent.FieldByName(vt.PropertyName); !ok {
+		errs = append(errs, &SchemaError{
+			Type:    parent.String(),
+			Message: "no such underlying field: " + vt.PropertyName,
+		})
+	} else if f.Type.Kind() != reflect.String && !f.Type.Implements(reflect.TypeOf((*toStringable)(nil)).Elem()) {
+		errs = append(errs, &SchemaError{
+			Type:    parent.String(),
+			Message: "cannot convert underlying field to string: " + vt.PropertyName,
+		})
+	}
+
+	for _, k := range sortedKeys(vt.Mapping) {
+		errs = append(errs, checkTypeMap(vt.Mapping[k], parent, t, seen)...)
+	}
+	aliases := make([]string, 0, len(vt.Aliases))
+	for alias := range vt.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if _, ok := vt.Mapping[vt.Aliases[alias]]; !ok {
+			errs = append(errs, newSchemaError("alias %s refers to an unknown type identifier: %s", alias, vt.Aliases[alias]))
+		}
+	}
+	if vt.Default != nil {
+		errs = append(errs, checkTypeMap(vt.Default, parent, t, seen)...)
+	}
+
+	return errs
+}
+
+func sortedKeys(mapping map[string]TypeMap) []string {
+	keys := make([]string, 0, len(mapping))
+	for k := range mapping {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *UnionMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if len(m.Variants) == 0 {
+		return []error{newSchemaError("jsonmap.OneOfTypes() requires at least one variant")}
+	}
+
+	errs := []error{}
+	for _, variant := range m.Variants {
+		errs = append(errs, checkTypeMap(variant, parent, t, seen)...)
+	}
+	return errs
+}
+
+func (m *TimeMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t != reflect.TypeOf(time.Time{}) {
+		return []error{newSchemaError("target field for jsonmap.Time() is not a time.Time")}
+	}
+	return nil
+}
+
+func (m *DurationMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t != reflect.TypeOf(time.Duration(0)) {
+		return []error{newSchemaError("target field for jsonmap.Duration() is not a time.Duration")}
+	}
+	return nil
+}
+
+func (m *BytesMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t != reflect.TypeOf([]byte(nil)) {
+		return []error{newSchemaError("target field for jsonmap.Bytes() is not a []byte")}
+	}
+	return nil
+}
+
+func (m *BigIntMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t != bigIntType && t != reflect.PtrTo(bigIntType) {
+		return []error{newSchemaError("target field for jsonmap.BigInt() is not a big.Int")}
+	}
+	return nil
+}
+
+func (m *BigFloatMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t != bigFloatType && t != reflect.PtrTo(bigFloatType) {
+		return []error{newSchemaError("target field for jsonmap.BigFloat() is not a big.Float")}
+	}
+	return nil
+}
+
+func (m *CustomMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	ptr := reflect.PtrTo(t)
+	if !ptr.Implements(jsonUnmarshalerType) {
+		return []error{newSchemaError("target field for jsonmap.Custom() does not implement json.Unmarshaler")}
+	}
+	if !ptr.Implements(jsonMarshalerType) {
+		return []error{newSchemaError("target field for jsonmap.Custom() does not implement json.Marshaler")}
+	}
+	return nil
+}
+
+func (m *DynamicMap) checkSchema(parent, t reflect.Type, seen map[reflect.Type]bool) []error {
+	if t.Kind() != reflect.Interface {
+		return []error{newSchemaError("target field for jsonmap.Dynamic() is not an interface")}
+	}
+	return nil
+}
+
+// CheckSchema checks every registered TypeMap, returning all of the
+// misconfigurations found. It is intended to be called once at startup, or
+// from a test.
+func (tm *TypeMapper) CheckSchema() []error {
+	types := make([]reflect.Type, 0, len(tm.typeMaps))
+	for t := range tm.typeMaps {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+
+	errs := []error{}
+	seen := map[reflect.Type]bool{}
+	for _, t := range types {
+		errs = append(errs, checkTypeMap(tm.typeMaps[t], nil, t, seen)...)
+	}
+	return errs
+}
+
+// Validate detects misconfigurations of the QueryMap, such as a ParameterMap
+// naming a struct field which doesn't exist, which would otherwise only be
+// reported, or cause a panic, when a request is decoded.
+func (qm QueryMap) Validate() []error {
+	underlying := reflect.TypeOf(qm.UnderlyingType)
+	if underlying == nil || underlying.Kind() != reflect.Struct {
+		return []error{newSchemaError("UnderlyingType must be a struct")}
+	}
+
+	errs := []error{}
+	fail := func(format string, a ...interface{}) {
+		e := newSchemaError(format, a...)
+		e.Type = underlying.String()
+		errs = append(errs, e)
+	}
+
+	seen := map[ParameterLocation]map[string]bool{}
+	for _, param := range qm.ParameterMaps {
+		if param.ParameterName == "" {
+			fail("ParameterName must be specified for field: %s", param.StructFieldName)
+		} else {
+			name := param.ParameterName
+			if param.In == InHeader {
+				name = http.CanonicalHeaderKey(name)
+			}
+			if seen[param.In] == nil {
+				seen[param.In] = map[string]bool{}
+			}
+			if seen[param.In][name] {
+				fail("duplicate parameter: %s", param.ParameterName)
+			}
+			seen[param.In][name] = true
+		}
+
+		f, ok := underlying.FieldByName(param.StructFieldName)
+		if !ok {
+			fail("no such underlying field: %s", param.StructFieldName)
+			continue
+		}
+		if f.PkgPath != "" {
+			fail("cannot set unexported field: %s", param.StructFieldName)
+			continue
+		}
+
+		if param.OmitNil {
+			switch f.Type.Kind() {
+			case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			default:
+				fail("OmitNil set for parameter %s, but field %s of type %s cannot be nil", param.ParameterName, param.StructFieldName, f.Type)
+			}
+		}
+
+		if param.Mapper == nil {
+			fail("Mapper must be specified for parameter: %s", param.ParameterName)
+			continue
+		}
+
+		// The value decoded for a missing parameter shows the type produced
+		// by the Mapper
+		var zero interface{}
+		var err error
+		if fm, ok := param.Mapper.(FileParameterMapper); ok {
+			zero, err = fm.DecodeFiles()
+		} else {
+			zero, err = param.Mapper.Decode()
+		}
+		if err != nil || zero == nil {
+			continue
+		}
+		if t := reflect.TypeOf(zero); !t.AssignableTo(f.Type) {
+			fail("parameter %s decodes to %s, which cannot be stored in field %s of type %s", param.ParameterName, t, param.StructFieldName, f.Type)
+		}
+	}
+
+	return errs
+}
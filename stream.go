@@ -0,0 +1,649 @@
+package jsonmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Decode reads the next JSON object, or array if dest is a slice, from r into
+// dest, validating it exactly as Unmarshal() would. StructMaps and SliceMaps
+// are populated directly from the decoder's tokens rather than from an
+// intermediate map[string]interface{}, so that large payloads aren't held in
+// memory twice. Other TypeMaps receive their value decoded as usual.
+//
+// Any data following the value is left unread, unless DisallowTrailingData()
+// is used. The Column of a SyntaxError is counted in bytes rather than
+// characters.
+func (tm *TypeMapper) Decode(ctx Context, r io.Reader, dest interface{}, opts ...UnmarshalOption) error {
+	d := tm.NewDecoder(r, opts...)
+	err := d.Decode(ctx, dest)
+	if !d.disallowTrailingData {
+		return err
+	}
+
+	switch err.(type) {
+	case nil, *MultiValidationError:
+		// The value was read in full
+	default:
+		return err
+	}
+
+	if _, tokErr := d.dec.Token(); tokErr != io.EOF {
+		return newTrailingDataError()
+	}
+	return err
+}
+
+// A Decoder reads a sequence of JSON values from a stream, such as
+// concatenated or whitespace separated objects, validating each one exactly as
+// Decode() would.
+type Decoder struct {
+	tm   *TypeMapper
+	opts []UnmarshalOption
+	pr   *positionReader
+	dec  *json.Decoder
+
+	disallowTrailingData bool
+}
+
+// NewDecoder returns a Decoder reading from r. opts apply to every value
+// decoded.
+func (tm *TypeMapper) NewDecoder(r io.Reader, opts ...UnmarshalOption) *Decoder {
+	_, state := withOptions(nil, nil, opts)
+
+	if state != nil && state.lenient {
+		r = &lenientReader{r: r}
+	}
+	if ls := newLimitScanner(state); ls != nil {
+		r = &limitReader{r: r, ls: ls}
+	}
+
+	pr := &positionReader{r: r}
+	dec := json.NewDecoder(pr)
+	if state != nil && state.useNumber {
+		dec.UseNumber()
+	}
+
+	return &Decoder{
+		tm:                   tm,
+		opts:                 opts,
+		pr:                   pr,
+		dec:                  dec,
+		disallowTrailingData: state != nil && state.disallowTrailingData,
+	}
+}
+
+// More reports whether there is another value to decode.
+func (d *Decoder) More() bool {
+	return d.dec.More()
+}
+
+// Decode reads the next value from the stream into dest. Once the stream is
+// exhausted io.EOF is returned.
+func (d *Decoder) Decode(ctx Context, dest interface{}) error {
+	locale := LocaleFromContext(ctx)
+	if locale != "" {
+		ctx = ctx.(*localeContext).Context
+	}
+
+	tm := d.tm
+	err := d.decode(ctx, dest)
+	if err != nil && (tm.ErrorFormatter != nil || (tm.Catalog != nil && locale != "")) {
+		tm.formatError(err, locale)
+	}
+	return err
+}
+
+func (d *Decoder) decode(ctx Context, dest interface{}) error {
+	if reflect.TypeOf(dest).Kind() != reflect.Ptr || dest == nil {
+		panic("cannot unmarshal to non-pointer")
+	}
+	m := d.tm.getTypeMap(dest)
+
+	ctx, state := withOptions(ctx, d.tm, d.opts)
+
+	pr := d.pr
+	dec := d.dec
+
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		return pr.wrapError(err)
+	}
+
+	dstValue := reflect.ValueOf(dest).Elem()
+	isList := dstValue.Kind() == reflect.Slice
+
+	if tok == nil && isList {
+		// Like json.Unmarshal(), null sets the slice to nil
+		dstValue.Set(reflect.Zero(dstValue.Type()))
+	} else if tok == nil {
+		// Equivalent to json.Unmarshal() of null into a map
+		err = m.Unmarshal(ctx, nil, map[string]interface{}(nil), dstValue)
+	} else if (isList && tok != json.Delim('[')) || (!isList && tok != json.Delim('{')) {
+		// Skip the value, so that a Decoder can move on to the next one
+		if err := skipValue(dec, tok); err != nil {
+			return pr.wrapError(err)
+		}
+		if isList {
+			return NewValidationError("json: cannot unmarshal, not a list").WithCode(CodeNotAList)
+		}
+		return NewValidationError("json: cannot unmarshal, not an object").WithCode(CodeNotAnObject)
+	} else {
+		_, err = unmarshalStreamed(ctx, m, nil, dec, tok, dstValue)
+		if se, ok := err.(*streamError); ok {
+			return pr.wrapError(se.err)
+		}
+	}
+
+	return finishUnmarshal(state, dest, err)
+}
+
+// Iterator yields the values written by EncodeArray(). Next returns io.EOF
+// once there are no more values; any other error aborts the encoding.
+type Iterator interface {
+	Next() (interface{}, error)
+}
+
+// IteratorFunc adapts a function to an Iterator.
+type IteratorFunc func() (interface{}, error)
+
+func (f IteratorFunc) Next() (interface{}, error) {
+	return f()
+}
+
+// EncodeArray writes the values received from src to w as a JSON array, one
+// element at a time, so that the array as a whole is never held in memory.
+// src must be an Iterator or a receivable channel, which is read until it is
+// closed. Each value is marshaled with the TypeMap registered for its type,
+// exactly as Marshal() would, and nil values are written as null.
+//
+// If an error occurs part way through, the elements written so far are not
+// retracted and a channel is not drained.
+func (tm *TypeMapper) EncodeArray(ctx Context, w io.Writer, src interface{}) error {
+	next := iterate(src)
+	ctx = tm.marshalContext(ctx)
+	bw := bufio.NewWriter(w)
+
+	if err := bw.WriteByte('['); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		val, err := next.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			if err := bw.WriteByte(','); err != nil {
+				return err
+			}
+		}
+
+		data, err := tm.marshalElement(ctx, val)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := bw.WriteByte(']'); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// EncodeLines writes the values received from src to w as JSON Lines, each
+// value followed by a newline. src is handled exactly as by EncodeArray().
+func (tm *TypeMapper) EncodeLines(ctx Context, w io.Writer, src interface{}) error {
+	next := iterate(src)
+	ctx = tm.marshalContext(ctx)
+	bw := bufio.NewWriter(w)
+
+	for {
+		val, err := next.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		data, err := tm.marshalElement(ctx, val)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// A LineError is passed to the callback of DecodeLines() when a line fails to
+// unmarshal.
+type LineError struct {
+	// Line is the number of the line in the input, counting from 1.
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeLines reads JSON Lines from r, unmarshaling each line into a new value
+// obtained from newDest exactly as Unmarshal() would. fn is called with each
+// value in turn, along with a *LineError if the line failed to unmarshal, and
+// may return an error to stop reading. Blank lines are skipped.
+//
+// The error returned by fn, or any error reading from r, is returned.
+func (tm *TypeMapper) DecodeLines(ctx Context, r io.Reader, newDest func() interface{}, fn func(dest interface{}, err error) error, opts ...UnmarshalOption) error {
+	br := bufio.NewReader(r)
+
+	for line := 1; ; line++ {
+		data, readErr := br.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		// Exclude the newline, so that SyntaxErrors are positioned within
+		// the line
+		data = bytes.TrimRight(data, "\r\n")
+
+		if len(bytes.TrimSpace(data)) != 0 {
+			dest := newDest()
+			var lineErr error
+			if err := tm.Unmarshal(ctx, data, dest, opts...); err != nil {
+				lineErr = &LineError{Line: line, Err: err}
+			}
+			if err := fn(dest, lineErr); err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// iterate returns an Iterator over src, which must be an Iterator or a
+// receivable channel.
+func iterate(src interface{}) Iterator {
+	if next, ok := src.(Iterator); ok {
+		return next
+	}
+
+	srcValue := reflect.ValueOf(src)
+	if srcValue.Kind() != reflect.Chan || srcValue.Type().ChanDir()&reflect.RecvDir == 0 {
+		panic("cannot iterate over " + srcValue.Kind().String())
+	}
+
+	return IteratorFunc(func() (interface{}, error) {
+		val, ok := srcValue.Recv()
+		if !ok {
+			return nil, io.EOF
+		}
+		return val.Interface(), nil
+	})
+}
+
+// marshalElement marshals val with the TypeMap registered for its type, or as
+// null if it is nil.
+func (tm *TypeMapper) marshalElement(ctx Context, val interface{}) ([]byte, error) {
+	if val == nil {
+		return nullRawMessage.Data, nil
+	}
+
+	data, err := tm.getTypeMap(val).Marshal(ctx, nil, reflect.ValueOf(val))
+	if err != nil {
+		return nil, err
+	}
+	return data.MarshalJSON()
+}
+
+// streamError wraps an error encountered while reading from a json.Decoder,
+// so that it can be told apart from the errors returned by TypeMaps.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+// streams reports whether the value beginning with tok can be unmarshaled by
+// tm into a value of type t directly from a json.Decoder. SliceMaps with a
+// length limit, or which unmarshal into an array, need the whole array up
+// front in order to check its length before its elements.
+func streams(tm TypeMap, tok json.Token, t reflect.Type) bool {
+	switch m := tm.(type) {
+	case StructMap:
+		return tok == json.Delim('{')
+	case SliceMap:
+		return tok == json.Delim('[') && m.MinLen == nil && m.MaxLen == nil && t.Kind() == reflect.Slice
+	default:
+		return false
+	}
+}
+
+// unmarshalStreamed unmarshals the value beginning with tok into dstValue. If
+// the value had to be decoded in full it is returned, for use in errors.
+// Errors reading from dec are returned as a *streamError.
+func unmarshalStreamed(ctx Context, tm TypeMap, parent *reflect.Value, dec *json.Decoder, tok json.Token, dstValue reflect.Value) (interface{}, error) {
+	switch m := tm.(type) {
+	case StructMap:
+		if streams(m, tok, dstValue.Type()) {
+			return nil, m.unmarshalStream(ctx, dec, dstValue)
+		}
+	case SliceMap:
+		if streams(m, tok, dstValue.Type()) {
+			return nil, m.unmarshalStream(ctx, dec, dstValue)
+		}
+	}
+
+	val, err := readValue(dec, tok)
+	if err != nil {
+		return nil, &streamError{err}
+	}
+	return val, tm.Unmarshal(ctx, parent, val, dstValue)
+}
+
+// streamedField records what was found for a MappedField while reading an
+// object from a json.Decoder.
+type streamedField struct {
+	val      interface{}
+	present  bool
+	streamed bool
+	err      error
+}
+
+// unmarshalStream is equivalent to Unmarshal(), reading the members of an
+// object from dec after its opening brace. Fields which can be streamed are
+// unmarshaled as they're encountered, the rest once the whole object has been
+// read. Either way the same errors are collected as with Unmarshal(), to be
+// sorted by path, and Discriminators see the same sibling fields.
+func (sm StructMap) unmarshalStream(ctx Context, dec *json.Decoder, dstValue reflect.Value) error {
+	dstValue = sm.allocate(dstValue)
+
+	index := make(map[string][]int, len(sm.Fields))
+	for i, field := range sm.Fields {
+		if !field.ReadOnly {
+			index[field.JSONFieldName] = append(index[field.JSONFieldName], i)
+		}
+	}
+
+	fields := make([]streamedField, len(sm.Fields))
+
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return &streamError{err}
+		}
+		key := keyTok.(string)
+
+		tok, err := dec.Token()
+		if err != nil {
+			return &streamError{err}
+		}
+
+		indices := index[key]
+		if len(indices) == 0 {
+			if err := skipValue(dec, tok); err != nil {
+				return &streamError{err}
+			}
+			continue
+		}
+
+		if len(indices) == 1 {
+			field := sm.Fields[indices[0]]
+			// A Validator needs the whole value, so can't be streamed
+			if dstField := dstValue.FieldByName(field.StructFieldName); dstField.IsValid() && field.Validator == nil && streams(field.Contains, tok, dstField.Type()) {
+				// The last of any duplicate keys wins, as with json.Unmarshal()
+				dstField.Set(reflect.Zero(dstField.Type()))
+				_, err := unmarshalStreamed(ctx, field.Contains, &dstValue, dec, tok, dstField)
+				if se, ok := err.(*streamError); ok {
+					return se
+				}
+				fields[indices[0]] = streamedField{present: true, streamed: true, err: err}
+				continue
+			}
+		}
+
+		val, err := readValue(dec, tok)
+		if err != nil {
+			return &streamError{err}
+		}
+		for _, i := range indices {
+			// Undo an earlier duplicate which was streamed, so that this one
+			// is unmarshaled into an empty field as with Unmarshal()
+			if fields[i].streamed {
+				if dstField := dstValue.FieldByName(sm.Fields[i].StructFieldName); dstField.IsValid() {
+					dstField.Set(reflect.Zero(dstField.Type()))
+				}
+			}
+			fields[i] = streamedField{val: val, present: true}
+		}
+	}
+
+	// Consume the closing brace
+	if _, err := dec.Token(); err != nil {
+		return &streamError{err}
+	}
+
+	// Discriminators need the raw values of their siblings, which are never
+	// streamed
+	siblings := make(map[string]interface{}, len(sm.Fields))
+	for i, field := range sm.Fields {
+		if fields[i].present && !fields[i].streamed {
+			siblings[field.JSONFieldName] = fields[i].val
+		}
+	}
+
+	errs := &ValidationError{}
+
+	for i, field := range sm.Fields {
+		if failingFast(ctx, errs) {
+			break
+		}
+		if field.ReadOnly {
+			continue
+		}
+
+		f := fields[i]
+		var err error
+		if f.streamed {
+			err = sm.collectFieldError(ctx, field, nil, f.err, errs)
+		} else {
+			err = sm.unmarshalField(ctx, dstValue, field, siblings, f.val, f.present, errs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(errs.NestedErrors) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// unmarshalStream is equivalent to Unmarshal(), reading the elements of an
+// array from dec after its opening bracket.
+func (sm SliceMap) unmarshalStream(ctx Context, dec *json.Decoder, dstValue reflect.Value) error {
+	result := dstValue
+	elementType := dstValue.Type().Elem()
+
+	errs := &ValidationError{}
+
+	for i := 0; dec.More(); i++ {
+		tok, err := dec.Token()
+		if err != nil {
+			return &streamError{err}
+		}
+
+		if failingFast(ctx, errs) {
+			if err := skipValue(dec, tok); err != nil {
+				return &streamError{err}
+			}
+			continue
+		}
+
+		dstElem := reflect.New(elementType).Elem()
+
+		val, err := unmarshalStreamed(ctx, sm.Contains, &dstValue, dec, tok, dstElem)
+		if se, ok := err.(*streamError); ok {
+			return se
+		}
+
+		accepted, err := sm.collectElementError(ctx, i, val, err, errs)
+		if err != nil {
+			return err
+		}
+		if accepted {
+			result = reflect.Append(result, dstElem)
+		}
+	}
+
+	// Consume the closing bracket
+	if _, err := dec.Token(); err != nil {
+		return &streamError{err}
+	}
+
+	return sm.finish(ctx, dstValue, result, errs)
+}
+
+// readValue decodes the value beginning with tok, exactly as json.Unmarshal()
+// would into an interface{}.
+func readValue(dec *json.Decoder, tok json.Token) (interface{}, error) {
+	switch tok {
+	case json.Delim('{'):
+		obj := map[string]interface{}{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			valTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := readValue(dec, valTok)
+			if err != nil {
+				return nil, err
+			}
+			obj[key.(string)] = val
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			elemTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			elem, err := readValue(dec, elemTok)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, elem)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	default:
+		return tok, nil
+	}
+}
+
+// skipValue discards the value beginning with tok.
+func skipValue(dec *json.Decoder, tok json.Token) error {
+	depth := 0
+	for {
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+
+		var err error
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// positionReader records the offset of each newline read, so that the line
+// and column of a syntax error can be reported without retaining the input.
+type positionReader struct {
+	r        io.Reader
+	offset   int64
+	newlines []int64
+}
+
+func (pr *positionReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			pr.newlines = append(pr.newlines, pr.offset+int64(i))
+		}
+	}
+	pr.offset += int64(n)
+	return n, err
+}
+
+func (pr *positionReader) wrapError(err error) error {
+	e, ok := err.(*json.SyntaxError)
+	if !ok {
+		return err
+	}
+
+	line := sort.Search(len(pr.newlines), func(i int) bool {
+		return pr.newlines[i] >= e.Offset
+	})
+	lineStart := int64(0)
+	if line > 0 {
+		lineStart = pr.newlines[line-1] + 1
+	}
+
+	return &SyntaxError{
+		Offset:  e.Offset,
+		Line:    line + 1,
+		Column:  int(e.Offset - lineStart),
+		Code:    CodeInvalidJSON,
+		Message: e.Error(),
+		Err:     e,
+	}
+}
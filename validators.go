@@ -1,11 +1,18 @@
 package jsonmap
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var uuidRegex = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[1-5][0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
@@ -19,19 +26,19 @@ type StringValidator struct {
 
 func (v *StringValidator) ValidateString(s string) (string, error) {
 	if len(s) < v.MinLen {
-		return "", NewValidationError("too short, must be at least %d characters", v.MinLen)
+		return "", NewValidationError("too short, must be at least %d characters", v.MinLen).WithCode(CodeTooShort).WithParam("min", v.MinLen)
 	}
 
 	if len(s) > v.MaxLen {
-		return "", NewValidationError("too long, may not be more than %d characters", v.MaxLen)
+		return "", NewValidationError("too long, may not be more than %d characters", v.MaxLen).WithCode(CodeTooLong).WithParam("max", v.MaxLen)
 	}
 
 	if v.RE != nil && !v.RE.MatchString(s) {
 		if v.REErrMsg != "" {
-			return "", NewValidationError(v.REErrMsg)
+			return "", NewValidationError(v.REErrMsg).WithCode(CodePatternMismatch).WithParam("pattern", v.RE.String())
 		}
 
-		return "", NewValidationError("must match regular expression: %s", v.RE.String())
+		return "", NewValidationError("must match regular expression: %s", v.RE.String()).WithCode(CodePatternMismatch).WithParam("pattern", v.RE.String())
 	}
 	return s, nil
 }
@@ -39,7 +46,7 @@ func (v *StringValidator) ValidateString(s string) (string, error) {
 func (v *StringValidator) Validate(value interface{}) (interface{}, error) {
 	s, ok := value.(string)
 	if !ok {
-		return nil, NewValidationError("not a string")
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
 	}
 
 	return v.ValidateString(s)
@@ -63,126 +70,1255 @@ func String(minLen int, maxLen int) *StringValidator {
 	}
 }
 
-type BooleanValidator struct{}
+type BooleanValidator struct {
+	// If FromString is set, the strings "true", "false", "1" and "0" (in any
+	// case) are accepted as well.
+	FromString bool
+}
+
+func (v *BooleanValidator) Validate(value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok && v.FromString {
+		switch strings.ToLower(s) {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return nil, NewValidationError("not a boolean").WithCode(CodeNotABoolean)
+	}
+	return b, nil
+}
+
+func Boolean() Validator {
+	return &BooleanValidator{}
+}
+
+// BooleanFromString is like Boolean, but also accepts string representations
+// such as "true" or "0" from clients that can't send JSON booleans.
+func BooleanFromString() Validator {
+	return &BooleanValidator{
+		FromString: true,
+	}
+}
+
+// TODO: The spectrum of numeric types deserves more thought. Do we ship
+// independent validators for each?
+type IntegerValidator struct {
+	MinVal int64
+	MaxVal int64
+
+	// If FromString is set, integers encoded as strings such as "42" are
+	// accepted as well.
+	FromString bool
+
+	// Kind is the integer kind the value is converted to, so that it can be
+	// stored in struct fields narrower than int64. Defaults to reflect.Int64.
+	Kind reflect.Kind
+}
+
+func (v *IntegerValidator) Validate(value interface{}) (interface{}, error) {
+	var i int64
+
+	if s, ok := value.(string); ok && v.FromString {
+		parsed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, NewValidationError("not an integer").WithCode(CodeNotAnInteger)
+		}
+		i = parsed
+	} else {
+		parsed, ok := toInt64(value)
+		if !ok {
+			return nil, NewValidationError("not an integer").WithCode(CodeNotAnInteger)
+		}
+		i = parsed
+	}
+
+	if i < v.MinVal {
+		return nil, NewValidationError("too small, must be at least %d", v.MinVal).WithCode(CodeOutOfRange).WithParam("min", v.MinVal)
+	}
+
+	if i > v.MaxVal {
+		return nil, NewValidationError("too large, may not be larger than %d", v.MaxVal).WithCode(CodeOutOfRange).WithParam("max", v.MaxVal)
+	}
+
+	switch v.Kind {
+	case reflect.Int:
+		return int(i), nil
+	case reflect.Int8:
+		return int8(i), nil
+	case reflect.Int16:
+		return int16(i), nil
+	case reflect.Int32:
+		return int32(i), nil
+	case reflect.Uint:
+		return uint(i), nil
+	case reflect.Uint8:
+		return uint8(i), nil
+	case reflect.Uint16:
+		return uint16(i), nil
+	case reflect.Uint32:
+		return uint32(i), nil
+	default:
+		return i, nil
+	}
+}
+
+// toInt64 converts a JSON number to an int64, if it is an integer.
+func toInt64(value interface{}) (int64, bool) {
+	switch n := value.(type) {
+	case float64:
+		// Numeric values come in as a float64 unless UseNumber() is set. This
+		// almost certainly has some weird properties in extreme cases, but
+		// JSON probably isn't the right choice in those cases.
+		if float64(int64(n)) != n {
+			return 0, false
+		}
+		return int64(n), true
+	case json.Number:
+		if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			return i, true
+		}
+		// Integers may also be written like 1.0 or 1e3
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return toInt64(f)
+	default:
+		return 0, false
+	}
+}
+
+// toUint64 converts a JSON number to a uint64, if it is a non-negative
+// integer.
+func toUint64(value interface{}) (uint64, bool) {
+	switch n := value.(type) {
+	case float64:
+		if float64(uint64(n)) != n {
+			return 0, false
+		}
+		return uint64(n), true
+	case json.Number:
+		if i, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			return i, true
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return toUint64(f)
+	default:
+		return 0, false
+	}
+}
+
+// toFloat64 converts a JSON number to a float64.
+func toFloat64(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func Integer(minVal, maxVal int64) Validator {
+	return &IntegerValidator{
+		MinVal: minVal,
+		MaxVal: maxVal,
+	}
+}
+
+// IntegerFromString is like Integer, but also accepts integers encoded as
+// strings, e.g. "42". Bounds are enforced either way.
+func IntegerFromString(minVal, maxVal int64) Validator {
+	return &IntegerValidator{
+		MinVal:     minVal,
+		MaxVal:     maxVal,
+		FromString: true,
+	}
+}
+
+func sizedInteger(kind reflect.Kind, minVal, maxVal int64) Validator {
+	return &IntegerValidator{
+		MinVal: minVal,
+		MaxVal: maxVal,
+		Kind:   kind,
+	}
+}
+
+// Int is like Integer, but produces an int.
+func Int(minVal, maxVal int) Validator {
+	return sizedInteger(reflect.Int, int64(minVal), int64(maxVal))
+}
+
+// Int8 is like Integer, but produces an int8.
+func Int8(minVal, maxVal int8) Validator {
+	return sizedInteger(reflect.Int8, int64(minVal), int64(maxVal))
+}
+
+// Int16 is like Integer, but produces an int16.
+func Int16(minVal, maxVal int16) Validator {
+	return sizedInteger(reflect.Int16, int64(minVal), int64(maxVal))
+}
+
+// Int32 is like Integer, but produces an int32.
+func Int32(minVal, maxVal int32) Validator {
+	return sizedInteger(reflect.Int32, int64(minVal), int64(maxVal))
+}
+
+// Uint is like Integer, but produces a uint. Bounds larger than math.MaxInt64
+// are clamped; see LossyUint64 for the full uint64 range.
+func Uint(minVal, maxVal uint) Validator {
+	clamp := func(u uint) int64 {
+		if uint64(u) > math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return int64(u)
+	}
+	return sizedInteger(reflect.Uint, clamp(minVal), clamp(maxVal))
+}
+
+// Uint8 is like Integer, but produces a uint8.
+func Uint8(minVal, maxVal uint8) Validator {
+	return sizedInteger(reflect.Uint8, int64(minVal), int64(maxVal))
+}
+
+// Uint16 is like Integer, but produces a uint16.
+func Uint16(minVal, maxVal uint16) Validator {
+	return sizedInteger(reflect.Uint16, int64(minVal), int64(maxVal))
+}
+
+// Uint32 is like Integer, but produces a uint32.
+func Uint32(minVal, maxVal uint32) Validator {
+	return sizedInteger(reflect.Uint32, int64(minVal), int64(maxVal))
+}
+
+type InterfaceValidator struct{}
+
+func (v *InterfaceValidator) Validate(value interface{}) (interface{}, error) {
+	return value, nil
+}
+
+func Interface() *InterfaceValidator {
+	return &InterfaceValidator{}
+}
+
+type LossyUint64Validator struct {
+	MinVal uint64
+	MaxVal uint64
+}
+
+func (v *LossyUint64Validator) Validate(value interface{}) (interface{}, error) {
+	i, ok := toUint64(value)
+	if !ok {
+		return nil, NewValidationError("not an integer").WithCode(CodeNotAnInteger)
+	}
+
+	if i < v.MinVal {
+		return nil, NewValidationError("too small, must be at least %d", v.MinVal).WithCode(CodeOutOfRange).WithParam("min", v.MinVal)
+	}
+
+	if i > v.MaxVal {
+		return nil, NewValidationError("too large, may not be larger than %d", v.MaxVal).WithCode(CodeOutOfRange).WithParam("max", v.MaxVal)
+	}
+
+	return i, nil
+}
+
+func (v *LossyUint64Validator) Min(min uint64) {
+	v.MinVal = min
+}
+
+func (v *LossyUint64Validator) Max(max uint64) {
+	v.MaxVal = max
+}
+
+// Validate numbers as a uint64. In this process they will be stored as a
+// float64, which can lead to a loss of precision as high as 1024(?), unless
+// the UseNumber() option is passed to Unmarshal().
+func LossyUint64() *LossyUint64Validator {
+	return &LossyUint64Validator{
+		MinVal: 0,
+		MaxVal: math.MaxUint64,
+	}
+}
+
+type UUIDStringValidator struct{}
+
+func (v *UUIDStringValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+func (v *UUIDStringValidator) ValidateString(value string) (string, error) {
+	if !uuidRegex.MatchString(value) {
+		return "", NewValidationError("not a valid UUID").WithCode(CodeInvalidFormat)
+	}
+
+	return value, nil
+}
+
+func UUIDString() *UUIDStringValidator {
+	return &UUIDStringValidator{}
+}
+
+type Base64Validator struct {
+	MaxDecodedLen int
+	Encoding      *base64.Encoding
+	DecodeBytes   bool
+}
+
+func (v *Base64Validator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	// Reject oversized input before allocating a buffer for it. DecodedLen
+	// over-estimates by at most two bytes of padding.
+	if v.Encoding.DecodedLen(len(s))-2 > v.MaxDecodedLen {
+		return nil, NewValidationError("too large, may not be more than %d bytes", v.MaxDecodedLen).WithCode(CodeTooLarge).WithParam("max", v.MaxDecodedLen)
+	}
+
+	b, err := v.Encoding.DecodeString(s)
+	if err != nil {
+		return nil, NewValidationError("not valid base64").WithCode(CodeInvalidFormat)
+	}
+
+	if len(b) > v.MaxDecodedLen {
+		return nil, NewValidationError("too large, may not be more than %d bytes", v.MaxDecodedLen).WithCode(CodeTooLarge).WithParam("max", v.MaxDecodedLen)
+	}
+
+	if v.DecodeBytes {
+		return b, nil
+	}
+
+	return s, nil
+}
+
+// URLEncoding switches to the URL-safe base64 alphabet.
+func (v *Base64Validator) URLEncoding() *Base64Validator {
+	v.Encoding = base64.URLEncoding
+	return v
+}
+
+// Decoded causes the decoded []byte to be stored in the struct field instead
+// of the original string.
+func (v *Base64Validator) Decoded() *Base64Validator {
+	v.DecodeBytes = true
+	return v
+}
+
+// Validate standard, padded base64 whose decoded content is at most
+// maxDecodedLen bytes.
+func Base64(maxDecodedLen int) *Base64Validator {
+	return &Base64Validator{
+		MaxDecodedLen: maxDecodedLen,
+		Encoding:      base64.StdEncoding,
+	}
+}
+
+type EmbeddedJSONValidator struct {
+	Schema RegisterableTypeMap
+}
+
+func (v *EmbeddedJSONValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	var partial interface{}
+	if err := json.Unmarshal([]byte(s), &partial); err != nil {
+		return nil, NewValidationError("not valid JSON").WithCode(CodeInvalidFormat)
+	}
+
+	if v.Schema != nil {
+		dst := reflect.New(v.Schema.GetUnderlyingType()).Elem()
+		if err := v.Schema.Unmarshal(EmptyContext, nil, partial, dst); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Of validates the embedded document against a TypeMap. The field still
+// receives the original string.
+func (v *EmbeddedJSONValidator) Of(schema RegisterableTypeMap) *EmbeddedJSONValidator {
+	v.Schema = schema
+	return v
+}
+
+// Validate that a string contains a well-formed JSON document.
+func EmbeddedJSON() *EmbeddedJSONValidator {
+	return &EmbeddedJSONValidator{}
+}
+
+type CodeValidator struct {
+	codes      codeSet
+	invalidMsg string
+}
+
+func (v *CodeValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+func (v *CodeValidator) ValidateString(value string) (string, error) {
+	if !v.codes.contains(value) {
+		return "", NewValidationError(v.invalidMsg).WithCode(CodeInvalidFormat)
+	}
+
+	return value, nil
+}
+
+// Validate an upper case ISO 3166-1 alpha-2 country code such as "US".
+func CountryCode() *CodeValidator {
+	return &CodeValidator{
+		codes:      iso3166Alpha2Codes,
+		invalidMsg: "not a valid ISO 3166-1 alpha-2 country code",
+	}
+}
+
+// Validate an upper case ISO 4217 currency code such as "EUR".
+func CurrencyCode() *CodeValidator {
+	return &CodeValidator{
+		codes:      iso4217Codes,
+		invalidMsg: "not a valid ISO 4217 currency code",
+	}
+}
+
+// language[-extlang][-script][-region][-variant...][-extension...][-x-private]
+var languageTagRegex = regexp.MustCompile(`(?i)^([a-z]{2,3}(?:-[a-z]{3}){0,3}|[a-z]{4,8})` +
+	`(?:-([a-z]{4}))?` +
+	`(?:-([a-z]{2}|[0-9]{3}))?` +
+	`(?:-(?:[a-z0-9]{5,8}|[0-9][a-z0-9]{3}))*` +
+	`(?:-[a-wyz0-9](?:-[a-z0-9]{2,8})+)*` +
+	`(?:-x(?:-[a-z0-9]{1,8})+)?$`)
+
+type LanguageTagValidator struct{}
+
+func (v *LanguageTagValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+func (v *LanguageTagValidator) ValidateString(value string) (string, error) {
+	m := languageTagRegex.FindStringSubmatch(value)
+	if m == nil {
+		return "", NewValidationError("not a valid BCP 47 language tag").WithCode(CodeInvalidFormat)
+	}
+
+	// The structure is checked above; additionally make sure that the
+	// common two letter language and region subtags actually exist.
+	if len(m[1]) == 2 && !iso639Alpha2Codes.contains(strings.ToLower(m[1])) {
+		return "", NewValidationError("not a valid BCP 47 language tag").WithCode(CodeInvalidFormat)
+	}
+
+	if len(m[3]) == 2 && !iso3166Alpha2Codes.contains(strings.ToUpper(m[3])) {
+		return "", NewValidationError("not a valid BCP 47 language tag").WithCode(CodeInvalidFormat)
+	}
+
+	return value, nil
+}
+
+// Validate a BCP 47 language tag such as "en", "pt-BR" or "zh-Hant-TW".
+func LanguageTag() *LanguageTagValidator {
+	return &LanguageTagValidator{}
+}
+
+type PhoneE164Validator struct{}
+
+func (v *PhoneE164Validator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+func (v *PhoneE164Validator) ValidateString(value string) (string, error) {
+	if !strings.HasPrefix(value, "+") {
+		return "", NewValidationError("not a valid E.164 phone number, must start with '+' and a country code").WithCode(CodeInvalidFormat)
+	}
+
+	digits := value[1:]
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", NewValidationError("not a valid E.164 phone number, may only contain digits after '+'").WithCode(CodeInvalidFormat)
+		}
+	}
+
+	if strings.HasPrefix(digits, "0") {
+		return "", NewValidationError("not a valid E.164 phone number, country code may not start with 0").WithCode(CodeInvalidFormat)
+	}
+
+	// E.164 numbers are at most 15 digits long. The shortest numbers in
+	// practice have a one digit country code and a seven digit subscriber
+	// number.
+	if len(digits) < 8 {
+		return "", NewValidationError("not a valid E.164 phone number, too short").WithCode(CodeTooShort)
+	}
+
+	if len(digits) > 15 {
+		return "", NewValidationError("not a valid E.164 phone number, may not be more than 15 digits").WithCode(CodeTooLong)
+	}
+
+	return value, nil
+}
+
+// Validate a phone number in E.164 format, such as "+14155552671".
+func PhoneE164() *PhoneE164Validator {
+	return &PhoneE164Validator{}
+}
+
+const (
+	CardBrandVisa       = "visa"
+	CardBrandMastercard = "mastercard"
+	CardBrandAmex       = "amex"
+	CardBrandDiscover   = "discover"
+	CardBrandDiners     = "diners"
+	CardBrandJCB        = "jcb"
+	CardBrandUnknown    = ""
+)
+
+// CardBrand guesses the card network from the leading digits of a card number.
+// It returns CardBrandUnknown if the prefix isn't recognized.
+func CardBrand(number string) string {
+	prefix := func(n int) int {
+		if len(number) < n {
+			return -1
+		}
+		p, err := strconv.Atoi(number[:n])
+		if err != nil {
+			return -1
+		}
+		return p
+	}
+
+	switch p2, p3, p4, p6 := prefix(2), prefix(3), prefix(4), prefix(6); {
+	case strings.HasPrefix(number, "4"):
+		return CardBrandVisa
+	case p2 >= 51 && p2 <= 55, p4 >= 2221 && p4 <= 2720:
+		return CardBrandMastercard
+	case p2 == 34, p2 == 37:
+		return CardBrandAmex
+	case p4 == 6011, p2 == 65, p3 >= 644 && p3 <= 649, p6 >= 622126 && p6 <= 622925:
+		return CardBrandDiscover
+	case p3 >= 300 && p3 <= 305, p2 == 36, p2 == 38:
+		return CardBrandDiners
+	case p4 >= 3528 && p4 <= 3589:
+		return CardBrandJCB
+	}
+
+	return CardBrandUnknown
+}
+
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+type CardNumberValidator struct {
+	AllowedBrands []string
+}
+
+func (v *CardNumberValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+// ValidateString returns the card number with any spaces and dashes removed.
+func (v *CardNumberValidator) ValidateString(value string) (string, error) {
+	b := strings.Builder{}
+	for _, c := range value {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == ' ' || c == '-':
+		default:
+			return "", NewValidationError("not a valid card number, may only contain digits").WithCode(CodeInvalidFormat)
+		}
+	}
+	number := b.String()
+
+	if len(number) < 12 || len(number) > 19 {
+		return "", NewValidationError("not a valid card number, must be between 12 and 19 digits").WithCode(CodeInvalidFormat)
+	}
+
+	if !luhnValid(number) {
+		return "", NewValidationError("not a valid card number").WithCode(CodeInvalidFormat)
+	}
+
+	if len(v.AllowedBrands) != 0 {
+		brand := CardBrand(number)
+		allowed := false
+		for _, b := range v.AllowedBrands {
+			if b == brand {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", NewValidationError("card brand not accepted, must be one of: %s", strings.Join(v.AllowedBrands, ", ")).WithCode(CodeUnsupportedCardBrand)
+		}
+	}
+
+	return number, nil
+}
+
+// Brands restricts accepted cards to the given CardBrand values.
+func (v *CardNumberValidator) Brands(brands ...string) *CardNumberValidator {
+	v.AllowedBrands = brands
+	return v
+}
+
+// Validate a payment card number using the Luhn checksum. Spaces and dashes
+// are accepted as separators and stripped from the result.
+func CardNumber() *CardNumberValidator {
+	return &CardNumberValidator{}
+}
+
+// A short list of passwords that show up at the top of every breach corpus.
+var commonPasswords = []string{
+	"password", "password1", "password123", "passw0rd", "123456", "1234567",
+	"12345678", "123456789", "1234567890", "qwerty", "qwerty123", "abc123",
+	"111111", "123123", "letmein", "welcome", "welcome1", "iloveyou",
+	"admin", "admin123", "monkey", "dragon", "football", "baseball",
+	"sunshine", "princess", "trustno1", "000000", "changeme", "secret",
+}
+
+type PasswordValidator struct {
+	MinLen          int
+	MaxLen          int
+	MinClasses      int
+	DeniedPasswords map[string]struct{}
+}
+
+func (v *PasswordValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+func (v *PasswordValidator) ValidateString(value string) (string, error) {
+	n := utf8.RuneCountInString(value)
+	if n < v.MinLen {
+		return "", NewValidationError("must be at least %d characters long", v.MinLen).WithCode(CodeTooShort).WithParam("min", v.MinLen)
+	}
+
+	if v.MaxLen > 0 && n > v.MaxLen {
+		return "", NewValidationError("may not be more than %d characters long", v.MaxLen).WithCode(CodeTooLong).WithParam("max", v.MaxLen)
+	}
+
+	var lower, upper, digit, other bool
+	for _, c := range value {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+
+	if classes < v.MinClasses {
+		return "", NewValidationError("must contain at least %d of the following: lowercase letters, uppercase letters, numbers, symbols", v.MinClasses).WithCode(CodeWeakPassword)
+	}
+
+	if _, denied := v.DeniedPasswords[strings.ToLower(value)]; denied {
+		return "", NewValidationError("is too common, please choose a different password").WithCode(CodeCommonPassword)
+	}
 
-func (v *BooleanValidator) Validate(value interface{}) (interface{}, error) {
-	b, ok := value.(bool)
+	return value, nil
+}
+
+// Deny adds passwords which are rejected regardless of their strength, such
+// as the product or company name. Matching is case insensitive.
+func (v *PasswordValidator) Deny(passwords ...string) *PasswordValidator {
+	for _, p := range passwords {
+		v.DeniedPasswords[strings.ToLower(p)] = struct{}{}
+	}
+	return v
+}
+
+// Validate a new password. It must be at least minLen characters long and
+// contain characters from at least classes of the four character classes
+// (lowercase, uppercase, digits and symbols). A built-in list of very common
+// passwords is always rejected.
+func Password(minLen, classes int) *PasswordValidator {
+	v := &PasswordValidator{
+		MinLen:          minLen,
+		MaxLen:          256,
+		MinClasses:      classes,
+		DeniedPasswords: map[string]struct{}{},
+	}
+	return v.Deny(commonPasswords...)
+}
+
+var decimalRegex = regexp.MustCompile(`^-?([0-9]+)(?:\.([0-9]+))?$`)
+
+type DecimalStringValidator struct {
+	Precision int
+	Scale     int
+	ParseRat  bool
+}
+
+func (v *DecimalStringValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
 	if !ok {
-		return nil, NewValidationError("not a boolean")
+		return nil, NewValidationError("not a string, decimal values must be sent as strings").WithCode(CodeNotAString)
 	}
-	return b, nil
+
+	s, err := v.ValidateString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.ParseRat {
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, NewValidationError("not a valid decimal number").WithCode(CodeInvalidFormat)
+		}
+		return r, nil
+	}
+
+	return s, nil
 }
 
-func Boolean() Validator {
-	return &BooleanValidator{}
+func (v *DecimalStringValidator) ValidateString(value string) (string, error) {
+	m := decimalRegex.FindStringSubmatch(value)
+	if m == nil {
+		return "", NewValidationError("not a valid decimal number").WithCode(CodeInvalidFormat)
+	}
+
+	intDigits := len(strings.TrimLeft(m[1], "0"))
+	fracDigits := len(m[2])
+
+	if fracDigits > v.Scale {
+		return "", NewValidationError("may not have more than %d digits after the decimal point", v.Scale).WithCode(CodeTooManyDigits).WithParam("scale", v.Scale)
+	}
+
+	if intDigits+fracDigits > v.Precision {
+		return "", NewValidationError("may not have more than %d digits in total", v.Precision).WithCode(CodeTooManyDigits).WithParam("precision", v.Precision)
+	}
+
+	return value, nil
 }
 
-// TODO: The spectrum of numeric types deserves more thought. Do we ship
-// independent validators for each?
-type IntegerValidator struct {
+// Rat causes the value to be stored as a *big.Rat instead of a string.
+func (v *DecimalStringValidator) Rat() *DecimalStringValidator {
+	v.ParseRat = true
+	return v
+}
+
+// Validate a decimal number sent as a string, such as "19.99", with at most
+// precision significant digits of which at most scale follow the decimal
+// point. JSON numbers are rejected so that monetary amounts never pass
+// through a float64.
+func DecimalString(precision, scale int) *DecimalStringValidator {
+	return &DecimalStringValidator{
+		Precision: precision,
+		Scale:     scale,
+	}
+}
+
+type NullableValidator struct {
+	V Validator
+}
+
+func (v *NullableValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	return v.V.Validate(value)
+}
+
+// Nullable explicitly permits a JSON null, which leaves the field at its zero
+// value. Other values are passed on to v. Unlike Optional on a MappedField,
+// the field must still be present.
+func Nullable(v Validator) Validator {
+	return &NullableValidator{
+		V: v,
+	}
+}
+
+type DefaultValidator struct {
+	V       Validator
+	Default interface{}
+}
+
+func (v *DefaultValidator) Validate(value interface{}) (interface{}, error) {
+	if value == nil {
+		return v.Default, nil
+	}
+
+	return v.V.Validate(value)
+}
+
+// WithDefault substitutes def when the value is JSON null, and passes other
+// values on to v. def must be assignable to the struct field. Note that null
+// values of Optional fields are skipped before any validator runs.
+func WithDefault(v Validator, def interface{}) Validator {
+	return &DefaultValidator{
+		V:       v,
+		Default: def,
+	}
+}
+
+var byteSizeRegex = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?) ?([A-Za-z]*)$`)
+
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+type ByteSizeValidator struct {
 	MinVal int64
 	MaxVal int64
 }
 
-func (v *IntegerValidator) Validate(value interface{}) (interface{}, error) {
-	// Numeric values come in as a float64. This almost certainly has some weird
-	// properties in extreme cases, but JSON probably isn't the right choice in
-	// those cases.
-	f, ok := value.(float64)
-	if !ok || float64(int64(f)) != f {
-		return nil, NewValidationError("not an integer")
+func (v *ByteSizeValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	m := byteSizeRegex.FindStringSubmatch(s)
+	if m == nil {
+		return nil, NewValidationError("not a valid size, expected a number followed by a unit such as KB or MiB").WithCode(CodeInvalidFormat)
+	}
+
+	unit, ok := byteSizeUnits[strings.ToLower(m[2])]
+	if !ok {
+		return nil, NewValidationError("unknown size unit '%s'", m[2]).WithCode(CodeInvalidFormat)
+	}
+
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil, NewValidationError("not a valid size").WithCode(CodeInvalidFormat)
+	}
+
+	// math.MaxInt64 is rounded up to 2^63 as a float64, which doesn't fit in
+	// an int64
+	bytes := f * unit
+	if bytes >= math.MaxInt64 {
+		return nil, NewValidationError("too large, may not be larger than %d bytes", v.MaxVal).WithCode(CodeOutOfRange).WithParam("max", v.MaxVal)
 	}
 
-	i := int64(f)
+	i := int64(bytes)
 	if i < v.MinVal {
-		return nil, NewValidationError("too small, must be at least %d", v.MinVal)
+		return nil, NewValidationError("too small, must be at least %d bytes", v.MinVal).WithCode(CodeOutOfRange).WithParam("min", v.MinVal)
 	}
 
 	if i > v.MaxVal {
-		return nil, NewValidationError("too large, may not be larger than %d", v.MaxVal)
+		return nil, NewValidationError("too large, may not be larger than %d bytes", v.MaxVal).WithCode(CodeOutOfRange).WithParam("max", v.MaxVal)
 	}
 
 	return i, nil
 }
 
-func Integer(minVal, maxVal int64) Validator {
-	return &IntegerValidator{
+// Validate a human readable size such as "512KB" or "10 MiB" and convert it
+// to a number of bytes (int64). Decimal (KB, MB, ...) and binary (KiB, MiB,
+// ...) units are supported; a bare number is a number of bytes.
+func ByteSize(minVal, maxVal int64) Validator {
+	return &ByteSizeValidator{
 		MinVal: minVal,
 		MaxVal: maxVal,
 	}
 }
 
-type InterfaceValidator struct{}
+type CoordinateValidator struct {
+	Name             string
+	MinVal           float64
+	MaxVal           float64
+	MaxDecimalPlaces int
+}
 
-func (v *InterfaceValidator) Validate(value interface{}) (interface{}, error) {
-	return value, nil
+func (v *CoordinateValidator) Validate(value interface{}) (interface{}, error) {
+	f, ok := toFloat64(value)
+	if !ok {
+		return nil, NewValidationError("not a number").WithCode(CodeInvalidFormat)
+	}
+
+	if f < v.MinVal || f > v.MaxVal {
+		return nil, NewValidationError("not a valid %s, must be between %g and %g", v.Name, v.MinVal, v.MaxVal).WithCode(CodeOutOfRange).WithParam("min", v.MinVal).WithParam("max", v.MaxVal)
+	}
+
+	if v.MaxDecimalPlaces > 0 {
+		formatted := strconv.FormatFloat(f, 'f', -1, 64)
+		if i := strings.IndexByte(formatted, '.'); i >= 0 && len(formatted)-i-1 > v.MaxDecimalPlaces {
+			return nil, NewValidationError("may not have more than %d decimal places", v.MaxDecimalPlaces).WithCode(CodeTooManyDigits).WithParam("scale", v.MaxDecimalPlaces)
+		}
+	}
+
+	return f, nil
 }
 
-func Interface() *InterfaceValidator {
-	return &InterfaceValidator{}
+// Precision limits the number of decimal places. Six decimal places are
+// roughly 10cm at the equator.
+func (v *CoordinateValidator) Precision(decimalPlaces int) *CoordinateValidator {
+	v.MaxDecimalPlaces = decimalPlaces
+	return v
 }
 
-type LossyUint64Validator struct {
-	MinVal uint64
-	MaxVal uint64
+// Validate a latitude in degrees, between -90 and 90.
+func Latitude() *CoordinateValidator {
+	return &CoordinateValidator{
+		Name:   "latitude",
+		MinVal: -90,
+		MaxVal: 90,
+	}
 }
 
-func (v *LossyUint64Validator) Validate(value interface{}) (interface{}, error) {
-	f, ok := value.(float64)
-	if !ok || float64(uint64(f)) != f {
-		return nil, NewValidationError("not an integer")
+// Validate a longitude in degrees, between -180 and 180.
+func Longitude() *CoordinateValidator {
+	return &CoordinateValidator{
+		Name:   "longitude",
+		MinVal: -180,
+		MaxVal: 180,
 	}
+}
 
-	i := uint64(f)
-	if i < v.MinVal {
-		return nil, NewValidationError("too small, must be at least %d", v.MinVal)
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoPointTypeMap maps a GeoPoint to {"latitude": ..., "longitude": ...}.
+var GeoPointTypeMap = StructMap{
+	GeoPoint{},
+	[]MappedField{
+		{
+			StructFieldName: "Latitude",
+			JSONFieldName:   "latitude",
+			Validator:       Latitude(),
+		},
+		{
+			StructFieldName: "Longitude",
+			JSONFieldName:   "longitude",
+			Validator:       Longitude(),
+		},
+	},
+}
+
+var hexColorRegex = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+type HexColorValidator struct{}
+
+func (v *HexColorValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
 	}
 
-	if i > v.MaxVal {
-		return nil, NewValidationError("too large, may not be larger than %d", v.MaxVal)
+	return v.ValidateString(s)
+}
+
+// ValidateString returns the color in lower case.
+func (v *HexColorValidator) ValidateString(value string) (string, error) {
+	if !hexColorRegex.MatchString(value) {
+		return "", NewValidationError("not a valid hex color, expected #RGB, #RRGGBB or #RRGGBBAA").WithCode(CodeInvalidFormat)
 	}
 
-	return i, nil
+	return strings.ToLower(value), nil
 }
 
-func (v *LossyUint64Validator) Min(min uint64) {
-	v.MinVal = min
+// Validate a CSS style hex color such as "#0af" or "#00AAFF80".
+func HexColor() *HexColorValidator {
+	return &HexColorValidator{}
 }
 
-func (v *LossyUint64Validator) Max(max uint64) {
-	v.MaxVal = max
+type PathSafeValidator struct {
+	MaxLen int
 }
 
-// Validate numbers as a uint64. In this process they will be stored as a
-// float64, which can lead to a loss of precision as high as 1024(?).
-func LossyUint64() *LossyUint64Validator {
-	return &LossyUint64Validator{
-		MinVal: 0,
-		MaxVal: math.MaxUint64,
+func (v *PathSafeValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+func (v *PathSafeValidator) ValidateString(value string) (string, error) {
+	if value == "" {
+		return "", NewValidationError("may not be empty").WithCode(CodeTooShort)
+	}
+
+	if len(value) > v.MaxLen {
+		return "", NewValidationError("too long, may not be more than %d characters", v.MaxLen).WithCode(CodeTooLong).WithParam("max", v.MaxLen)
+	}
+
+	if value == "." || value == ".." {
+		return "", NewValidationError("may not be '.' or '..'").WithCode(CodeInvalidFormat)
+	}
+
+	if !utf8.ValidString(value) {
+		return "", NewValidationError("not valid UTF-8").WithCode(CodeInvalidFormat)
+	}
+
+	for _, c := range value {
+		if c == '/' || c == '\\' {
+			return "", NewValidationError("may not contain slashes").WithCode(CodeInvalidFormat)
+		}
+		if unicode.IsControl(c) {
+			return "", NewValidationError("may not contain control characters").WithCode(CodeInvalidFormat)
+		}
+	}
+
+	return value, nil
+}
+
+// Validate a string that is safe to use as a single URL path segment, file
+// name or object store key component: it may not be empty, "." or "..", and
+// may not contain slashes, backslashes or control characters.
+func PathSafe(maxLen int) *PathSafeValidator {
+	return &PathSafeValidator{
+		MaxLen: maxLen,
 	}
 }
 
-type UUIDStringValidator struct{}
+type cronField struct {
+	name   string
+	min    int
+	max    int
+	names  []string
+	anyAlt bool
+}
 
-func (v *UUIDStringValidator) Validate(value interface{}) (interface{}, error) {
+var (
+	cronSeconds    = cronField{name: "second", min: 0, max: 59}
+	cronMinutes    = cronField{name: "minute", min: 0, max: 59}
+	cronHours      = cronField{name: "hour", min: 0, max: 23}
+	cronDayOfMonth = cronField{name: "day of month", min: 1, max: 31, anyAlt: true}
+	cronMonth      = cronField{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}}
+	cronDayOfWeek  = cronField{name: "day of week", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}, anyAlt: true}
+
+	cronMacros = map[string]struct{}{
+		"@yearly": {}, "@annually": {}, "@monthly": {}, "@weekly": {},
+		"@daily": {}, "@midnight": {}, "@hourly": {},
+	}
+)
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", s)
+	}
+
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", n, f.min, f.max)
+	}
+
+	return n, nil
+}
+
+func (f cronField) validate(expr string) error {
+	if f.anyAlt && expr == "?" {
+		return nil
+	}
+
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rangeExpr = part[:i]
+			step, err := strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return fmt.Errorf("invalid step '%s'", part[i+1:])
+			}
+		}
+
+		if rangeExpr == "*" {
+			continue
+		}
+
+		bounds := strings.SplitN(rangeExpr, "-", 2)
+		lo, err := f.value(bounds[0])
+		if err != nil {
+			return err
+		}
+
+		if len(bounds) == 2 {
+			hi, err := f.value(bounds[1])
+			if err != nil {
+				return err
+			}
+			if hi < lo {
+				return fmt.Errorf("invalid range '%s'", rangeExpr)
+			}
+		}
+	}
+
+	return nil
+}
+
+type CronExprValidator struct {
+	AllowSeconds bool
+}
+
+func (v *CronExprValidator) Validate(value interface{}) (interface{}, error) {
 	s, ok := value.(string)
 	if !ok {
-		return nil, NewValidationError("not a string")
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
 	}
 
 	return v.ValidateString(s)
 }
 
-func (v *UUIDStringValidator) ValidateString(value string) (string, error) {
-	if !uuidRegex.MatchString(value) {
-		return "", NewValidationError("not a valid UUID")
+func (v *CronExprValidator) ValidateString(value string) (string, error) {
+	if _, ok := cronMacros[value]; ok {
+		return value, nil
+	}
+
+	fields := []cronField{cronMinutes, cronHours, cronDayOfMonth, cronMonth, cronDayOfWeek}
+	exprs := strings.Fields(value)
+
+	if v.AllowSeconds && len(exprs) == 6 {
+		fields = append([]cronField{cronSeconds}, fields...)
+	} else if len(exprs) != 5 {
+		if v.AllowSeconds {
+			return "", NewValidationError("not a valid cron expression, expected 5 or 6 fields").WithCode(CodeInvalidFormat)
+		}
+		return "", NewValidationError("not a valid cron expression, expected 5 fields").WithCode(CodeInvalidFormat)
+	}
+
+	for i, f := range fields {
+		if err := f.validate(exprs[i]); err != nil {
+			return "", NewValidationError("not a valid cron expression, field %d (%s): %s", i+1, f.name, err.Error()).WithCode(CodeInvalidFormat)
+		}
 	}
 
 	return value, nil
 }
 
-func UUIDString() *UUIDStringValidator {
-	return &UUIDStringValidator{}
+// Seconds additionally accepts 6 field expressions with a leading seconds
+// field.
+func (v *CronExprValidator) Seconds() *CronExprValidator {
+	v.AllowSeconds = true
+	return v
+}
+
+// Validate a standard 5 field cron expression (minute, hour, day of month,
+// month, day of week) or one of the @daily style macros.
+func CronExpr() *CronExprValidator {
+	return &CronExprValidator{}
+}
+
+var (
+	jsonPointerRegex = regexp.MustCompile(`^(?:/(?:[^~/]|~[01])*)*$`)
+	// A practical subset of JSONPath: $ followed by dot or bracket selectors,
+	// wildcards and recursive descent.
+	jsonPathRegex = regexp.MustCompile(`^\$(?:\.\.?(?:[A-Za-z_][A-Za-z0-9_-]*|\*)|\[(?:\*|-?[0-9]+|'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*")\])*$`)
+)
+
+type JSONPointerValidator struct {
+	AllowJSONPath bool
+}
+
+func (v *JSONPointerValidator) Validate(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
+	}
+
+	return v.ValidateString(s)
+}
+
+func (v *JSONPointerValidator) ValidateString(value string) (string, error) {
+	if jsonPointerRegex.MatchString(value) {
+		return value, nil
+	}
+
+	if v.AllowJSONPath {
+		if jsonPathRegex.MatchString(value) {
+			return value, nil
+		}
+		return "", NewValidationError("not a valid JSON Pointer or JSONPath expression").WithCode(CodeInvalidFormat)
+	}
+
+	return "", NewValidationError("not a valid JSON Pointer").WithCode(CodeInvalidFormat)
+}
+
+// OrJSONPath additionally accepts JSONPath expressions such as
+// "$.items[0].name".
+func (v *JSONPointerValidator) OrJSONPath() *JSONPointerValidator {
+	v.AllowJSONPath = true
+	return v
+}
+
+// Validate an RFC 6901 JSON Pointer such as "/items/0/name".
+func JSONPointer() *JSONPointerValidator {
+	return &JSONPointerValidator{}
 }
 
 type StringsSliceMapper struct {
@@ -211,7 +1347,7 @@ func (ss *StringsSliceMapper) Unmarshal(ctx Context, parent *reflect.Value, part
 
 	data, ok := partial.([]interface{})
 	if !ok {
-		return NewValidationError("expected a list")
+		return NewValidationError("expected a list").WithCode(CodeNotAList)
 	}
 
 	rv := make([]string, len(data))
@@ -255,34 +1391,101 @@ func (s *StringsSliceMapper) Marshal(ctx Context, parent *reflect.Value, src ref
 type EnumeratedValuesValidator struct {
 	AllowedSlice  []string
 	AllowedValues map[string]struct{}
+
+	// MaxListed limits how many allowed values are included in the error
+	// message. Zero lists all of them.
+	MaxListed int
+	// DocURL is appended to the error message if set.
+	DocURL string
+	// CustomMessage replaces the generated error message entirely.
+	CustomMessage string
+	// DeprecatedValues are accepted with a warning.
+	DeprecatedValues map[string]struct{}
 }
 
 func (v *EnumeratedValuesValidator) Validate(value interface{}) (interface{}, error) {
 	s, ok := value.(string)
 	if !ok {
-		return nil, NewValidationError("not a string")
+		return nil, NewValidationError("not a string").WithCode(CodeNotAString)
 	}
 	_, ok = v.AllowedValues[s]
 
-	if !ok {
-		serialized, err := json.Marshal(v.AllowedSlice)
-		if err != nil {
-			// AllowedSlice should be a static value provided by the programmer,
-			// so an error serializing it definitely represents a progrramming error.
-			panic(err)
-		}
+	if _, deprecated := v.DeprecatedValues[s]; !ok && deprecated {
+		return value, NewWarning("'%s' is deprecated", s).WithCode(CodeDeprecatedValue)
+	}
 
+	if !ok {
 		// If we want to use the invalid string value for error messages, return the string value instead of nil and in
 		// the calling function, check if the return value is valid instead of checking if an error was returned, when
 		// setting that value in the dest object (this valid check would handle if the input value is not a string)
 		// return s, NewValidationError("Value must be one of: %s", string(serialized))
-		return nil, NewValidationError("Value must be one of: %s", string(serialized))
+		return nil, NewValidationError("%s", v.errorMessage()).WithCode(CodeNotOneOf).WithParam("allowed", v.AllowedSlice)
 	}
 
 	return value, nil
 }
 
-func OneOf(allowed ...string) Validator {
+func (v *EnumeratedValuesValidator) errorMessage() string {
+	if v.CustomMessage != "" {
+		return v.CustomMessage
+	}
+
+	listed := v.AllowedSlice
+	if v.MaxListed > 0 && len(listed) > v.MaxListed {
+		listed = listed[:v.MaxListed]
+	}
+
+	serialized, err := json.Marshal(listed)
+	if err != nil {
+		// AllowedSlice should be a static value provided by the programmer,
+		// so an error serializing it definitely represents a progrramming error.
+		panic(err)
+	}
+
+	msg := "Value must be one of: " + string(serialized)
+	if omitted := len(v.AllowedSlice) - len(listed); omitted > 0 {
+		msg += fmt.Sprintf(" and %d more", omitted)
+	}
+	if v.DocURL != "" {
+		msg += ", see " + v.DocURL
+	}
+
+	return msg
+}
+
+// Truncate limits the error message to the first n allowed values.
+func (v *EnumeratedValuesValidator) Truncate(n int) *EnumeratedValuesValidator {
+	v.MaxListed = n
+	return v
+}
+
+// Documentation adds a URL documenting the allowed values to the error
+// message.
+func (v *EnumeratedValuesValidator) Documentation(url string) *EnumeratedValuesValidator {
+	v.DocURL = url
+	return v
+}
+
+// Deprecate accepts the given values in addition to the allowed ones, but
+// emits a warning when they are used. Deprecated values aren't listed in
+// error messages.
+func (v *EnumeratedValuesValidator) Deprecate(values ...string) *EnumeratedValuesValidator {
+	if v.DeprecatedValues == nil {
+		v.DeprecatedValues = map[string]struct{}{}
+	}
+	for _, value := range values {
+		v.DeprecatedValues[value] = struct{}{}
+	}
+	return v
+}
+
+// WithMessage replaces the error message with msg.
+func (v *EnumeratedValuesValidator) WithMessage(msg string) *EnumeratedValuesValidator {
+	v.CustomMessage = msg
+	return v
+}
+
+func OneOf(allowed ...string) *EnumeratedValuesValidator {
 	v := &EnumeratedValuesValidator{
 		AllowedSlice:  allowed,
 		AllowedValues: map[string]struct{}{},
@@ -301,6 +1504,7 @@ func KeyFromVariableTypeMap(m map[string]TypeMap) Validator {
 	for key := range m {
 		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
 	return OneOf(keys...)
 }